@@ -0,0 +1,203 @@
+package clientctl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//房间信息
+type RoomInfo struct {
+	RoomID int64 `json:"roomID"`
+	//房间成员数
+	Members int64 `json:"members"`
+	//待广播的消息数
+	BroadcastQueue int `json:"broadcastQueue"`
+	//超过广播上限排队等待的消息数
+	Backlog int64 `json:"backlog,omitempty"`
+	//慢速模式的发言间隔，为空不限制
+	SlowMode string `json:"slowMode,omitempty"`
+	//聊天消息处理管道的阶段，按执行顺序
+	ChatStages []string `json:"chatStages,omitempty"`
+}
+
+//会话信息
+type SessionInfo struct {
+	SessionID int64  `json:"sessionID"`
+	IP        string `json:"ip"`
+	UserName  string `json:"userName"`
+	//-1掉线,0大厅,1,2,3...房间id
+	RoomID int64 `json:"roomID"`
+	//发送管道中待发送的消息数
+	QueueDepth int   `json:"queueDepth"`
+	QueueCap   int   `json:"queueCap"`
+	LoginTime  int64 `json:"loginTime"`
+	//禁言截止时间 unix秒，0未禁言
+	MuteUntil int64 `json:"muteUntil,omitempty"`
+}
+
+//房间列表，按房间号排序
+func (s *ClientServer) RoomInfos() []*RoomInfo {
+	infos := make([]*RoomInfo, 0, len(s.Rooms))
+	for _, room := range s.Rooms {
+		info := &RoomInfo{
+			RoomID:         room.RoomID,
+			Members:        room.ClientCount(),
+			BroadcastQueue: len(room.Broadcast),
+			Backlog:        room.BacklogLen(),
+		}
+		if d := room.Limits().SlowMode; d > 0 {
+			info.SlowMode = d.String()
+		}
+		if p := s.Pipeline(room.RoomID); p != nil {
+			info.ChatStages = p.Stages()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].RoomID < infos[j].RoomID })
+	return infos
+}
+
+//在线会话列表，按会话id排序 roomID:<=0 不过滤房间
+func (s *ClientServer) SessionInfos(roomID int64) []*SessionInfo {
+	var infos []*SessionInfo
+	model.RangeSessions(func(clientAgent *model.ClientAgent) bool {
+		state := clientAgent.State.Load()
+		if roomID > 0 && state != roomID {
+			return true
+		}
+		info := &SessionInfo{
+			SessionID: clientAgent.Session.ID(),
+			IP:        clientAgent.Session.RemoteAddr().String(),
+			UserName:  clientAgent.Name(),
+			RoomID:    state,
+		}
+		info.QueueDepth, info.QueueCap = clientAgent.Session.QueueLen()
+		if lt := clientAgent.Session.LoginTime(); !lt.IsZero() {
+			info.LoginTime = lt.Unix()
+		}
+		if until := clientAgent.MuteUntil(time.Now()); !until.IsZero() {
+			info.MuteUntil = until.Unix()
+		}
+		infos = append(infos, info)
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool { return infos[i].SessionID < infos[j].SessionID })
+	return infos
+}
+
+//在线的会话
+func onlineClient(sessionID int64) (*model.ClientAgent, error) {
+	client := model.ClientAgentGet(sessionID)
+	if client == nil || client.Session.IsClosed() || client.State.Load() == -1 {
+		return nil, errors.New("no session found")
+	}
+	return client, nil
+}
+
+//踢下线，关闭原因通过websocket关闭帧发给客户端
+func (s *ClientServer) Kick(sessionID int64, reason string) error {
+	client, err := onlineClient(sessionID)
+	if err != nil {
+		return err
+	}
+	if reason == "" {
+		reason = "kicked by admin"
+	}
+	s.notifyModeration(client, model.FeedKick, reason)
+	client.Session.CloseWithReason(session.ClosePolicyViolation, reason)
+	return nil
+}
+
+//禁言 d:<=0 解除禁言
+func (s *ClientServer) Mute(sessionID int64, d time.Duration) error {
+	client, err := onlineClient(sessionID)
+	if err != nil {
+		return err
+	}
+	client.Mute(d)
+	client.Session.Eventf("admin mute:%s", d)
+	s.notifyModeration(client, model.FeedMute, d.String())
+	return nil
+}
+
+//将玩家移到其他房间
+//以玩家的名义提交切换房间请求，由玩家的消息协程处理，和玩家自己切换房间互不干扰
+func (s *ClientServer) MoveClient(sessionID, roomID int64) error {
+	client, err := onlineClient(sessionID)
+	if err != nil {
+		return err
+	}
+	if client.State.Load() <= 0 {
+		return errors.New("session not in room")
+	}
+	if s.Room(roomID) == nil {
+		return errors.New("no room found")
+	}
+	data, err := json.Marshal(&Request{
+		Type: RoomSwitchReq,
+		Data: &RoomSwitchRequest{
+			Room: roomID,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if !client.Session.Push(&session.NetPacket{MsgType: session.TextMessage, Data: data}) {
+		return errors.New("session busy")
+	}
+	client.Session.Eventf("admin move room:%d", roomID)
+	s.notifyModeration(client, model.FeedMove, fmt.Sprintf("room:%d", roomID))
+	return nil
+}
+
+//在玩家当前所在的房间发布管理事件
+func (s *ClientServer) notifyModeration(client *model.ClientAgent, eventType, reason string) {
+	if room := s.Room(client.State.Load()); room != nil {
+		room.Notify(&model.RoomEvent{
+			Type:      eventType,
+			SessionID: client.Session.ID(),
+			UserName:  client.Name(),
+			Reason:    reason,
+		})
+	}
+}
+
+//发送系统公告 roomID:<=0 发给全部房间，返回收到公告的房间数
+func (s *ClientServer) Announce(roomID int64, message string) (int, error) {
+	if message == "" {
+		return 0, errors.New("empty message")
+	}
+	rooms := make([]*model.ChatRoom, 0, len(s.Rooms))
+	if roomID > 0 {
+		room := s.Room(roomID)
+		if room == nil {
+			return 0, errors.New("no room found")
+		}
+		rooms = append(rooms, room)
+	} else {
+		for _, room := range s.Rooms {
+			rooms = append(rooms, room)
+		}
+	}
+	now := time.Now()
+	data := (&Response{
+		Type: SystemNtf,
+		Code: gerror.OK,
+		Data: &SystemNotify{
+			Notice:   message,
+			SendTime: now.Format("2006-01-02 15:04:05"),
+		},
+	}).toJson()
+	for _, room := range rooms {
+		//每个房间单独跟踪链路耗时，消息包不能共用
+		room.Announce(&session.NetPacket{MsgType: session.TextMessage, Data: data, ReceiveTime: now})
+	}
+	return len(rooms), nil
+}
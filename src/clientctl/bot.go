@@ -0,0 +1,71 @@
+package clientctl
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/zxfonline/IMDemo/core/badword"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//机器人单条消息的最大字数
+const BotMessageMaxLen = 1000
+
+//替换聊天消息中的脏字，命中时通知房间事件流
+func replaceBadword(room *model.ChatRoom, sessionID int64, userName, message string) (string, bool) {
+	replaced := badword.BadWordReplace(message)
+	if replaced == message {
+		return message, false
+	}
+	badwordHitsTotal.Inc()
+	room.Notify(&model.RoomEvent{
+		Type:      model.FeedBadword,
+		SessionID: sessionID,
+		UserName:  userName,
+		Message:   message,
+	})
+	return replaced, true
+}
+
+//机器人发送聊天消息，与玩家聊天一样过滤脏字并记录历史和热词，返回过滤后的消息
+func (s *ClientServer) PostBotMessage(roomID int64, botName, message string) (string, error) {
+	room := s.Room(roomID)
+	if room == nil {
+		return "", errors.New("no room found")
+	}
+	if botName == "" {
+		return "", errors.New("empty bot name")
+	}
+	if message == "" {
+		return "", errors.New("empty message")
+	}
+	if utf8.RuneCountInString(message) > BotMessageMaxLen {
+		return "", errors.New("message too long")
+	}
+	message, _ = replaceBadword(room, 0, botName, message)
+	roomReceivedTotal.With(strconv.FormatInt(roomID, 10)).Inc()
+	room.Publish(botChatPacket(botName, message, time.Now()))
+	return message, nil
+}
+
+//机器人聊天消息，客户端根据bot字段区分机器人
+func botChatPacket(botName, message string, now time.Time) *session.NetPacket {
+	return &session.NetPacket{
+		MsgType: session.TextMessage,
+		Data: (&Response{
+			Type: RoomChatNtf,
+			Code: gerror.OK,
+			Data: &ChatNotify{
+				Message:  message,
+				UserName: botName,
+				SendTime: now.Format("2006-01-02 15:04:05"),
+				Bot:      true,
+			},
+		}).toJson(),
+		ReceiveTime: now,
+	}
+}
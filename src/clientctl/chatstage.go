@@ -0,0 +1,203 @@
+package clientctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/core/gerror"
+)
+
+//聊天消息的默认最大字数
+const ChatMessageMaxLen = 500
+
+func init() {
+	RegisterChatStage("validate", PhaseValidate, staticChatStage(validateStage))
+	RegisterChatStage("roomlimit", PhaseLimit, staticChatStage(roomLimitStage))
+	RegisterChatStage("roomadmit", PhaseAdmit, staticChatStage(roomAdmitStage))
+	RegisterChatStage("length", PhaseLimit, newLengthStage)
+	RegisterChatStage("normalize", PhaseNormalize, newNormalizeStage)
+	RegisterChatStage("badword", PhaseFilter, staticChatStage(badwordStage))
+	RegisterChatStage("enrich", PhaseEnrich, staticChatStage(enrichStage))
+	RegisterChatStage("route", PhaseRoute, staticChatStage(routeStage))
+}
+
+//没有参数的处理阶段
+func staticChatStage(f ChatStageFunc) ChatStageFactory {
+	return func(options map[string]string) (ChatStageFunc, error) {
+		return f, nil
+	}
+}
+
+//读取整数参数，未配置时使用默认值
+func intOption(options map[string]string, key string, def int) (int, error) {
+	val, ok := options[key]
+	if !ok || val == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("bad option %s:%s", key, val)
+	}
+	return n, nil
+}
+
+//校验禁言和消息格式
+func validateStage(cc *ChatContext) *gerror.SysError {
+	if until := cc.Client.MuteUntil(cc.Now); !until.IsZero() {
+		return gerror.NewError(ERROR_MUTED, fmt.Sprintf("you are muted until %s", until.Format("2006-01-02 15:04:05")))
+	}
+	if message := cc.Request.Get("data", "message"); message == nil || message.Type() != fastjson.TypeString {
+		return gerror.NewError(gerror.SERVER_CDATA_ERROR, "message must be a string")
+	}
+	return nil
+}
+
+//检查房间慢速模式和广播上限(拒绝策略)，不占用额度，运行时由管理员修改
+func roomLimitStage(cc *ChatContext) *gerror.SysError {
+	if ok, retryAfter := cc.Room.CheckSlowMode(cc.Client, cc.Now); !ok {
+		return slowModeError(retryAfter)
+	}
+	if ok, retryAfter := cc.Room.CheckBroadcast(cc.Now); !ok {
+		return roomBusyError(retryAfter)
+	}
+	return nil
+}
+
+//投递前占用房间慢速模式和广播上限的额度，被之前的阶段拒绝的消息不占用额度
+func roomAdmitStage(cc *ChatContext) *gerror.SysError {
+	if ok, retryAfter := cc.Room.AllowSlowMode(cc.Client, cc.Now); !ok {
+		return slowModeError(retryAfter)
+	}
+	if ok, retryAfter := cc.Room.AdmitBroadcast(cc.Now); !ok {
+		return roomBusyError(retryAfter)
+	}
+	return nil
+}
+
+func slowModeError(retryAfter time.Duration) *gerror.SysError {
+	data, err := retryAfterError("slow mode", retryAfter)
+	return &gerror.SysError{Code: ERROR_SLOW_MODE, Content: err.Error(), Data: data}
+}
+
+func roomBusyError(retryAfter time.Duration) *gerror.SysError {
+	data, err := retryAfterError("room busy", retryAfter)
+	return &gerror.SysError{Code: ERROR_ROOM_BUSY, Content: err.Error(), Data: data}
+}
+
+//限制消息字数
+//	min: 最少字数(默认1)
+//	max: 最多字数(默认 ChatMessageMaxLen)
+func newLengthStage(options map[string]string) (ChatStageFunc, error) {
+	min, err := intOption(options, "min", 1)
+	if err != nil {
+		return nil, err
+	}
+	max, err := intOption(options, "max", ChatMessageMaxLen)
+	if err != nil {
+		return nil, err
+	}
+	if max < min {
+		return nil, fmt.Errorf("max:%d less than min:%d", max, min)
+	}
+	return func(cc *ChatContext) *gerror.SysError {
+		n := utf8.RuneCountInString(cc.Message)
+		if n < min {
+			if n == 0 {
+				return gerror.NewError(ERROR_MSG_EMPTY, "empty message")
+			}
+			return gerror.NewError(ERROR_MSG_EMPTY, fmt.Sprintf("message too short,min %d", min))
+		}
+		if n > max {
+			return gerror.NewError(ERROR_MSG_LONG, fmt.Sprintf("message too long,max %d", max))
+		}
+		return nil
+	}, nil
+}
+
+//不可见字符，常用于绕过脏字过滤
+func invisibleRune(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+		return true
+	}
+	return unicode.IsControl(r)
+}
+
+//去掉首尾空白和不可见字符，合并连续空白，规范化后为空则拒绝
+//	collapseSpace: 是否合并连续空白(默认true)
+func newNormalizeStage(options map[string]string) (ChatStageFunc, error) {
+	collapseSpace := true
+	if val := options["collapseSpace"]; val != "" {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("bad option collapseSpace:%s", val)
+		}
+		collapseSpace = b
+	}
+	return func(cc *ChatContext) *gerror.SysError {
+		var sb strings.Builder
+		sb.Grow(len(cc.Message))
+		space := false
+		for _, r := range strings.TrimSpace(cc.Message) {
+			if unicode.IsSpace(r) {
+				if collapseSpace {
+					if !space {
+						sb.WriteByte(' ')
+					}
+					space = true
+					continue
+				}
+				r = ' '
+			} else if invisibleRune(r) {
+				continue
+			}
+			space = false
+			sb.WriteRune(r)
+		}
+		cc.Message = strings.TrimSpace(sb.String())
+		if cc.Message == "" {
+			return gerror.NewError(ERROR_MSG_EMPTY, "empty message")
+		}
+		return nil
+	}, nil
+}
+
+//替换脏字
+func badwordStage(cc *ChatContext) *gerror.SysError {
+	if replaced, hit := replaceBadword(cc.Room, cc.Client.Session.ID(), cc.Client.UserName, cc.Message); hit {
+		cc.Client.Stats.BadwordHits.Inc()
+		cc.Message = replaced
+	}
+	return nil
+}
+
+//构建广播消息的用户名和发送时间
+func enrichStage(cc *ChatContext) *gerror.SysError {
+	data := cc.Request.Get("data")
+	data.Set("message", jsonString(cc.Message))
+	data.Set("userName", jsonString(cc.Client.UserName))
+	data.Set("sendTime", jsonString(cc.Now.Format("2006-01-02 15:04:05")))
+	cc.Request.Set("type", fastjson.MustParse(strconv.Itoa(int(RoomChatNtf))))
+	cc.Packet.Data = []byte(cc.Request.String())
+	return nil
+}
+
+//字符串转为json值，strconv.Quote 的转义(如\x01)不是合法json
+func jsonString(s string) *fastjson.Value {
+	b, _ := json.Marshal(s)
+	return fastjson.MustParseBytes(b)
+}
+
+//投递到房间广播
+func routeStage(cc *ChatContext) *gerror.SysError {
+	cc.Client.Stats.Messages.Inc()
+	roomReceivedTotal.With(strconv.FormatInt(cc.Room.RoomID, 10)).Inc()
+	cc.Room.Publish(cc.Packet)
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"sync"
 
-	"github.com/gorilla/websocket"
 	"github.com/zxfonline/IMDemo/core/log"
 	"github.com/zxfonline/IMDemo/core/session"
 	"github.com/zxfonline/IMDemo/model"
@@ -15,10 +14,10 @@ func handleMsg(ctx context.Context, wg *sync.WaitGroup, clientAgent *model.Clien
 	select {
 	case <-ctx.Done():
 		return
-	case <-clientAgent.Session.CloseState:
+	case <-clientAgent.Session.Closed():
 		return
 	default:
-		if msg.MsgType == websocket.TextMessage {
+		if msg.MsgType == session.TextMessage {
 			err, retMsgs := ProcessTextMessage(ctx, wg, clientAgent, msg)
 			if len(retMsgs) != 0 {
 				for _, retMsg := range retMsgs {
@@ -31,10 +30,7 @@ func handleMsg(ctx context.Context, wg *sync.WaitGroup, clientAgent *model.Clien
 			}
 		} else {
 			log.Warnf("unsupport message type:%v", msg.MsgType)
-			clientAgent.Session.DirectSend(&session.NetPacket{
-				MsgType: websocket.CloseMessage,
-				Data:    websocket.FormatCloseMessage(websocket.CloseUnsupportedData, ""),
-			})
+			clientAgent.Session.CloseWithReason(session.CloseUnsupportedData, "")
 		}
 
 	}
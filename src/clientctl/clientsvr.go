@@ -2,19 +2,32 @@ package clientctl
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/hotword"
+	"github.com/zxfonline/IMDemo/core/log"
 	"github.com/zxfonline/IMDemo/core/session"
 	"github.com/zxfonline/IMDemo/model"
+	_ "github.com/zxfonline/IMDemo/plugins"
 )
 
 type ClientServer struct {
 	// 下线、掉线的玩家
 	LogoutChan chan int64
 	Rooms      map[int64]*model.ChatRoom
+	//各房间的聊天消息处理管道
+	pipelines map[int64]*ChatPipeline
+	//各请求的限流参数
+	rateLimits map[RequestType]*model.RateLimit
+	//垃圾消息检测，未配置时为空
+	spam *spamFilter
+	//tcp会话参数，启动时按配置生成
+	tcpOptions *session.Options
 }
 
 var (
@@ -30,31 +43,140 @@ func StartServer(ctx context.Context, wg *sync.WaitGroup, roomSize int64, chatCa
 
 // start server loop
 func (s *ClientServer) Start(ctx context.Context, wg *sync.WaitGroup, roomSize int64, chatCashSize int32) {
+	trending := newTrendingOption()
+	s.pipelines = newChatPipelines(roomSize)
+	s.rateLimits = newRateLimits()
+	s.spam = newSpamFilter()
+	s.tcpOptions = s.newTcpOptions()
+	for roomID := range config.Conf.Plugins {
+		if roomID < 1 || roomID > roomSize {
+			panic(fmt.Errorf("plugin room not found:%d", roomID))
+		}
+	}
+	for roomID := range config.Conf.HotEngines {
+		if roomID < 1 || roomID > roomSize {
+			panic(fmt.Errorf("hot engine room not found:%d", roomID))
+		}
+	}
 	for i := int64(1); i <= roomSize; i++ {
-		room := model.NewChatRoom(i, chatCashSize)
+		hotMsg, err := hotword.NewEngineByName(config.Conf.HotEngines[i])
+		if err != nil {
+			panic(fmt.Errorf("room hot engine err:%v,room:%d", err, i))
+		}
+		room := model.NewChatRoom(i, chatCashSize, hotMsg)
+		room.Trending = trending
+		if dir := config.Conf.ActivitySnapshotDir; dir != "" {
+			room.ActivityFile = filepath.Join(dir, fmt.Sprintf("room_%d.json", i))
+			if err := room.LoadActivity(); err != nil {
+				log.Warnf("load room activity err:%v,room:%d,file:%s", err, i, room.ActivityFile)
+			}
+		}
+		room.BotPacket = botChatPacket
+		for _, cfg := range config.Conf.Plugins[i] {
+			plugin, err := model.NewPlugin(cfg.Name, cfg.Options)
+			if err != nil {
+				panic(fmt.Errorf("room plugin err:%v,room:%d,plugin:%s", err, i, cfg.Name))
+			}
+			room.AddPlugin(cfg.Name, cfg.Bot, plugin)
+		}
 		go room.Run(ctx, wg)
 		SvrCtl.Rooms[i] = room
 
 	}
+	s.initRoomLimits()
+	s.startWebhooks(ctx, wg)
 	go s.handleMsg(ctx, wg)
 }
 
-func (s *ClientServer) ClientLogic(ctxt context.Context, wg *sync.WaitGroup, conn *websocket.Conn) {
-	// 创建会话
-	msgChan := make(chan *session.NetPacket, 30)
-	sendChan := make(chan *session.NetPacket, 256)
-	session := session.NewSession(conn, msgChan, sendChan, s.LogoutChan)
-	session.SetParameter(30*time.Second, 30*time.Second, 512, true)
+//热词趋势配置
+func newTrendingOption() *model.TrendingOption {
+	opt := &model.TrendingOption{
+		Window:   TrendingWindow(),
+		MinCount: config.Conf.TrendingMinCount,
+	}
+	if config.Conf.TrendingNotifyScore > 0 {
+		opt.MinScore = config.Conf.TrendingNotifyScore
+		opt.Packet = func(words []*hotword.HotWord) *session.NetPacket {
+			return &session.NetPacket{
+				MsgType: session.TextMessage,
+				Data: (&Response{
+					Type: TrendingNtf,
+					Code: gerror.OK,
+					Data: words,
+				}).toJson(),
+			}
+		}
+	}
+	return opt
+}
+
+//热词趋势的最近统计窗口
+func TrendingWindow() time.Duration {
+	if d, err := time.ParseDuration(config.Conf.TrendingWindow); err == nil && d > 0 {
+		return d
+	}
+	return hotword.ValidSeconds * time.Second
+}
 
-	if config.IsDebug() {
-		session.SetRpmParameter(0, 0, nil)
-	} else {
-		session.SetRpmParameter(36, 3*time.Second, nil)
+//客户端会话参数，websocket和长轮询共用
+func (s *ClientServer) SessionOptions() *session.Options {
+	opts := &session.Options{
+		ReadBuffer:    30,
+		SendBuffer:    256,
+		ReadDelay:     30 * time.Second,
+		SendDelay:     30 * time.Second,
+		MaxRecvSize:   512,
+		SendFullClose: true,
+		OffChan:       s.LogoutChan,
+	}
+	if !config.IsDebug() {
+		opts.RpmLimit = 36
+		opts.RpmInterval = 3 * time.Second
 	}
+	return opts
+}
 
-	agent := model.NewClientAgent(session)
+//tcp会话参数，tcp客户端多为后台服务或游戏客户端，超时、限速和心跳单独配置
+func (s *ClientServer) TcpSessionOptions() *session.Options {
+	opts := *s.tcpOptions
+	return &opts
+}
+
+//在websocket会话参数基础上覆盖tcp配置
+func (s *ClientServer) newTcpOptions() *session.Options {
+	opts := s.SessionOptions()
+	opts.ReadDelay = tcpDuration("tcpReadTimeout", config.Conf.TcpReadTimeout, opts.ReadDelay)
+	opts.SendDelay = tcpDuration("tcpWriteTimeout", config.Conf.TcpWriteTimeout, opts.SendDelay)
+	opts.PingPeriod = tcpDuration("tcpPingPeriod", config.Conf.TcpPingPeriod, 0)
+	if opts.PingPeriod >= opts.ReadDelay {
+		panic(fmt.Errorf("tcpPingPeriod must be less than tcpReadTimeout:%v>=%v", opts.PingPeriod, opts.ReadDelay))
+	}
+	switch limit := config.Conf.TcpRpmLimit; {
+	case limit < 0:
+		opts.RpmLimit = 0
+	case limit > 0:
+		opts.RpmLimit = uint32(limit)
+		opts.RpmInterval = tcpDuration("tcpRpmInterval", config.Conf.TcpRpmInterval, 3*time.Second)
+	}
+	return opts
+}
+
+//解析tcp时长配置，为空使用默认值
+func tcpDuration(key, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		panic(fmt.Errorf("bad %s:%s", key, value))
+	}
+	return d
+}
+
+func (s *ClientServer) ClientLogic(ctxt context.Context, wg *sync.WaitGroup, sess session.Session) {
+	agent := model.NewClientAgent(sess)
 	model.ClientAgentAdd(agent)
-	session.HandleConn(nil)
+	sess.HandleConn(nil)
 	go handleServerMsg(ctxt, wg, agent)
 }
 
@@ -73,6 +195,7 @@ func (s *ClientServer) handleMsg(ctx context.Context, wg *sync.WaitGroup) {
 					room.Unregister <- userAgent
 				}
 				model.ClientAgentOffline(sessionId)
+				s.spam.forget(sessionId)
 			}
 		}
 	}
@@ -91,6 +214,32 @@ func (s *ClientServer) Room(roomID int64) *model.ChatRoom {
 	return s.Rooms[roomID]
 }
 
+//请求的限流参数，不限流返回nil
+func (s *ClientServer) RateLimit(reqType RequestType) *model.RateLimit {
+	return s.rateLimits[reqType]
+}
+
+//按配置创建各请求的限流参数
+func newRateLimits() map[RequestType]*model.RateLimit {
+	limits := make(map[RequestType]*model.RateLimit, len(config.Conf.RateLimits))
+	for name, cfg := range config.Conf.RateLimits {
+		h := handlerByName(name)
+		if h == nil {
+			panic(fmt.Errorf("rate limit request not found:%s", name))
+		}
+		if cfg == nil || cfg.Rate <= 0 || cfg.Burst < 1 {
+			panic(fmt.Errorf("bad rate limit:%s,rate and burst required", name))
+		}
+		limits[h.Req] = &model.RateLimit{Rate: cfg.Rate, Burst: cfg.Burst}
+	}
+	return limits
+}
+
+//房间的聊天消息处理管道
+func (s *ClientServer) Pipeline(roomID int64) *ChatPipeline {
+	return s.pipelines[roomID]
+}
+
 // 消息分发
 func handleServerMsg(ctxt context.Context, wg *sync.WaitGroup, client *model.ClientAgent) {
 	wg.Add(1)
@@ -99,9 +248,13 @@ func handleServerMsg(ctxt context.Context, wg *sync.WaitGroup, client *model.Cli
 		select {
 		case <-ctxt.Done():
 			return
-		case <-client.Session.CloseState:
+		case <-client.Session.Closed():
 			return
-		case msg := <-client.Session.ReadChan:
+		case msg := <-client.Session.Recv():
+			//管理接口代发的请求没有接收时间，不计入活跃
+			if !msg.ReceiveTime.IsZero() {
+				client.Stats.Active(msg.ReceiveTime)
+			}
 			handleMsg(ctxt, wg, client, msg)
 		}
 	}
@@ -0,0 +1,41 @@
+package clientctl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/config"
+)
+
+func TestClientServer_TcpOptions(t *testing.T) {
+	conf := config.Conf
+	defer func() { config.Conf = conf }()
+	s := &ClientServer{LogoutChan: make(chan int64, 1)}
+
+	//未配置时与websocket会话参数一致
+	config.Conf = config.Config{}
+	opts := s.newTcpOptions()
+	ws := s.SessionOptions()
+	require.Equal(t, ws.ReadDelay, opts.ReadDelay)
+	require.Equal(t, ws.RpmLimit, opts.RpmLimit)
+	require.Zero(t, opts.PingPeriod)
+
+	config.Conf = config.Config{TcpReadTimeout: "2m", TcpWriteTimeout: "10s", TcpPingPeriod: "1m", TcpRpmLimit: 100, TcpRpmInterval: "1s"}
+	opts = s.newTcpOptions()
+	require.Equal(t, 2*time.Minute, opts.ReadDelay)
+	require.Equal(t, 10*time.Second, opts.SendDelay)
+	require.Equal(t, time.Minute, opts.PingPeriod)
+	require.EqualValues(t, 100, opts.RpmLimit)
+	require.Equal(t, time.Second, opts.RpmInterval)
+	//websocket会话参数不受影响
+	require.Equal(t, ws.ReadDelay, s.SessionOptions().ReadDelay)
+
+	config.Conf = config.Config{TcpRpmLimit: -1}
+	require.Zero(t, s.newTcpOptions().RpmLimit)
+
+	config.Conf = config.Config{TcpReadTimeout: "10s", TcpPingPeriod: "10s"}
+	require.Panics(t, func() { s.newTcpOptions() })
+	config.Conf = config.Config{TcpWriteTimeout: "abc"}
+	require.Panics(t, func() { s.newTcpOptions() })
+}
@@ -0,0 +1,414 @@
+package clientctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//一次请求的上下文
+type RequestContext struct {
+	Client *model.ClientAgent
+	//客户端请求包
+	Packet *session.NetPacket
+	//客户端请求
+	Request *fastjson.Value
+	//收到请求时玩家的状态 -1掉线,0大厅,1,2,3...房间id
+	RoomID int64
+	//跟在响应之后发送的消息
+	After []*session.NetPacket
+}
+
+//请求处理函数 req:注册的请求结构体，已通过校验
+//返回的响应放在ack消息的data中，响应和错误都为空时不回复ack
+//返回 *gerror.SysError 时使用其中的错误码和数据，其他错误使用 SERVER_CDATA_ERROR
+type HandlerFunc func(rc *RequestContext, req interface{}) (interface{}, error)
+
+//请求处理器
+type Handler struct {
+	Req RequestType
+	Ack RequestType
+	//请求名
+	Name string
+	//请求说明
+	Doc string
+	//请求数据的原型，结构体指针，字段的校验规则使用 schema 标签:
+	//	required: 必须有该字段
+	//	min=N,max=N: 字符串字数、数组长度或数值的范围
+	//字段说明使用 doc 标签
+	Request interface{}
+	//响应数据的原型，只用于生成协议描述
+	Response interface{}
+	Handle   HandlerFunc
+
+	reqType reflect.Type
+	fields  []*fieldSchema
+}
+
+//请求字段的校验规则
+type fieldSchema struct {
+	index    int
+	name     string
+	kind     string
+	required bool
+	min, max *float64
+	doc      string
+}
+
+//广播消息
+type notify struct {
+	typ  RequestType
+	name string
+	doc  string
+	data interface{}
+}
+
+var (
+	handlerLock sync.RWMutex
+	handlers    = make(map[RequestType]*Handler)
+	notifies    = make(map[RequestType]*notify)
+)
+
+//注册请求处理器，规则错误时panic
+func RegisterHandler(h *Handler) {
+	t := reflect.TypeOf(h.Request)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Errorf("handler:%s request must be a struct pointer", h.Name))
+	}
+	h.reqType = t.Elem()
+	for i := 0; i < h.reqType.NumField(); i++ {
+		sf := h.reqType.Field(i)
+		name := jsonFieldName(sf)
+		if name == "" {
+			continue
+		}
+		fs, err := parseFieldSchema(sf, name)
+		if err != nil {
+			panic(fmt.Errorf("handler:%s field:%s,err:%v", h.Name, sf.Name, err))
+		}
+		fs.index = i
+		h.fields = append(h.fields, fs)
+	}
+	handlerLock.Lock()
+	defer handlerLock.Unlock()
+	handlers[h.Req] = h
+}
+
+//注册广播消息，只用于生成协议描述
+func RegisterNotify(typ RequestType, name, doc string, data interface{}) {
+	handlerLock.Lock()
+	defer handlerLock.Unlock()
+	notifies[typ] = &notify{typ: typ, name: name, doc: doc, data: data}
+}
+
+//请求类型的处理器，未注册返回nil
+func GetHandler(reqType RequestType) *Handler {
+	handlerLock.RLock()
+	defer handlerLock.RUnlock()
+	return handlers[reqType]
+}
+
+//按请求名查找处理器，未注册返回nil
+func handlerByName(name string) *Handler {
+	handlerLock.RLock()
+	defer handlerLock.RUnlock()
+	for _, h := range handlers {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+//字段的json名，不参与序列化的返回空
+func jsonFieldName(sf reflect.StructField) string {
+	if sf.PkgPath != "" {
+		return ""
+	}
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+//字段在协议中的类型
+func jsonKind(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return "any"
+}
+
+func parseFieldSchema(sf reflect.StructField, name string) (*fieldSchema, error) {
+	fs := &fieldSchema{name: name, kind: jsonKind(sf.Type), doc: sf.Tag.Get("doc")}
+	tag := sf.Tag.Get("schema")
+	if tag == "" {
+		return fs, nil
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		key, val := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			key, val = rule[:i], rule[i+1:]
+		}
+		switch key {
+		case "required":
+			fs.required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad schema rule:%s", rule)
+			}
+			if key == "min" {
+				fs.min = &n
+			} else {
+				fs.max = &n
+			}
+		default:
+			return nil, fmt.Errorf("unsupport schema rule:%s", rule)
+		}
+	}
+	return fs, nil
+}
+
+//检查字段的json类型
+func (fs *fieldSchema) checkType(v *fastjson.Value) bool {
+	switch fs.kind {
+	case "string":
+		return v.Type() == fastjson.TypeString
+	case "integer":
+		_, err := v.Int64()
+		return err == nil
+	case "number":
+		return v.Type() == fastjson.TypeNumber
+	case "boolean":
+		return v.Type() == fastjson.TypeTrue || v.Type() == fastjson.TypeFalse
+	case "array":
+		return v.Type() == fastjson.TypeArray
+	case "object":
+		return v.Type() == fastjson.TypeObject
+	}
+	return true
+}
+
+//检查字段的取值范围
+func (fs *fieldSchema) checkRange(v reflect.Value) error {
+	if fs.min == nil && fs.max == nil {
+		return nil
+	}
+	var n float64
+	unit := ""
+	switch fs.kind {
+	case "string":
+		n, unit = float64(utf8.RuneCountInString(v.String())), " length"
+	case "array":
+		n, unit = float64(v.Len()), " length"
+	case "integer":
+		if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+			n = float64(v.Uint())
+		} else {
+			n = float64(v.Int())
+		}
+	case "number":
+		n = v.Float()
+	default:
+		return nil
+	}
+	if fs.min != nil && n < *fs.min {
+		return fmt.Errorf("data.%s%s must be >= %v", fs.name, unit, *fs.min)
+	}
+	if fs.max != nil && n > *fs.max {
+		return fmt.Errorf("data.%s%s must be <= %v", fs.name, unit, *fs.max)
+	}
+	return nil
+}
+
+//按规则校验请求数据并解析到请求结构体
+func (h *Handler) decode(data *fastjson.Value) (interface{}, error) {
+	req := reflect.New(h.reqType)
+	if data == nil || data.Type() == fastjson.TypeNull {
+		data = fastjson.MustParse("{}")
+	}
+	if data.Type() != fastjson.TypeObject {
+		return nil, fmt.Errorf("data must be an object")
+	}
+	for _, fs := range h.fields {
+		v := data.Get(fs.name)
+		if v == nil || v.Type() == fastjson.TypeNull {
+			if fs.required {
+				return nil, fmt.Errorf("data.%s is required", fs.name)
+			}
+			continue
+		}
+		if !fs.checkType(v) {
+			return nil, fmt.Errorf("data.%s must be %s", fs.name, fs.kind)
+		}
+	}
+	if err := json.Unmarshal(data.MarshalTo(nil), req.Interface()); err != nil {
+		return nil, fmt.Errorf("data:%v", err)
+	}
+	for _, fs := range h.fields {
+		if err := fs.checkRange(req.Elem().Field(fs.index)); err != nil {
+			return nil, err
+		}
+	}
+	return req.Interface(), nil
+}
+
+//协议描述，提供给客户端
+type Protocol struct {
+	Requests []*ProtocolRequest `json:"requests"`
+	Notifies []*ProtocolNotify  `json:"notifies"`
+	Errors   []*ProtocolError   `json:"errors"`
+}
+
+//请求和响应
+type ProtocolRequest struct {
+	Type     RequestType    `json:"type"`
+	Ack      RequestType    `json:"ack"`
+	Name     string         `json:"name"`
+	Doc      string         `json:"doc,omitempty"`
+	Request  *ProtocolField `json:"request"`
+	Response *ProtocolField `json:"response,omitempty"`
+}
+
+//广播消息
+type ProtocolNotify struct {
+	Type RequestType    `json:"type"`
+	Name string         `json:"name"`
+	Doc  string         `json:"doc,omitempty"`
+	Data *ProtocolField `json:"data"`
+}
+
+//消息字段
+type ProtocolField struct {
+	Name     string   `json:"name,omitempty"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Doc      string   `json:"doc,omitempty"`
+	//对象的字段
+	Fields []*ProtocolField `json:"fields,omitempty"`
+	//数组的元素
+	Items *ProtocolField `json:"items,omitempty"`
+}
+
+//错误码
+type ProtocolError struct {
+	Code gerror.ErrorType `json:"code"`
+	Name string           `json:"name"`
+	Doc  string           `json:"doc"`
+}
+
+//响应中可能出现的错误码
+var protocolErrors = []*ProtocolError{
+	{gerror.OK, "OK", "成功"},
+	{ERROR_IGNORE, "ERROR_IGNORE", "忽略的操作"},
+	{ERROR_NAME_REPEAT, "ERROR_NAME_REPEAT", "姓名重复"},
+	{ERROR_MUTED, "ERROR_MUTED", "禁言中"},
+	{ERROR_MSG_EMPTY, "ERROR_MSG_EMPTY", "聊天消息为空"},
+	{ERROR_MSG_LONG, "ERROR_MSG_LONG", "聊天消息太长"},
+	{ERROR_RATE_LIMITED, "ERROR_RATE_LIMITED", "请求太频繁，data.retryAfter 毫秒后重试"},
+	{ERROR_SLOW_MODE, "ERROR_SLOW_MODE", "房间慢速模式中，data.retryAfter 毫秒后才能再次发言"},
+	{ERROR_ROOM_BUSY, "ERROR_ROOM_BUSY", "房间消息太多，data.retryAfter 毫秒后重试"},
+	{ERROR_SPAM, "ERROR_SPAM", "消息被判定为垃圾信息，message 为命中的原因"},
+	{gerror.SERVER_CDATA_ERROR, gerror.SERVER_CDATA_ERROR.String(), "请求格式或参数错误，message 为具体原因"},
+}
+
+//类型的字段描述
+func describeType(t reflect.Type) *ProtocolField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pf := &ProtocolField{Type: jsonKind(t)}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		pf.Items = describeType(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name := jsonFieldName(sf)
+			if name == "" {
+				continue
+			}
+			field := describeType(sf.Type)
+			field.Name = name
+			field.Doc = sf.Tag.Get("doc")
+			pf.Fields = append(pf.Fields, field)
+		}
+	}
+	return pf
+}
+
+func describeData(data interface{}) *ProtocolField {
+	if data == nil {
+		return nil
+	}
+	return describeType(reflect.TypeOf(data))
+}
+
+//根据注册的请求和广播生成协议描述
+func DescribeProtocol() *Protocol {
+	handlerLock.RLock()
+	defer handlerLock.RUnlock()
+	p := &Protocol{
+		Requests: make([]*ProtocolRequest, 0, len(handlers)),
+		Notifies: make([]*ProtocolNotify, 0, len(notifies)),
+		Errors:   protocolErrors,
+	}
+	for _, h := range handlers {
+		req := &ProtocolRequest{
+			Type:     h.Req,
+			Ack:      h.Ack,
+			Name:     h.Name,
+			Doc:      h.Doc,
+			Request:  &ProtocolField{Type: "object"},
+			Response: describeData(h.Response),
+		}
+		for _, fs := range h.fields {
+			field := describeType(h.reqType.Field(fs.index).Type)
+			field.Name = fs.name
+			field.Required = fs.required
+			field.Min = fs.min
+			field.Max = fs.max
+			field.Doc = fs.doc
+			req.Request.Fields = append(req.Request.Fields, field)
+		}
+		p.Requests = append(p.Requests, req)
+	}
+	sort.Slice(p.Requests, func(i, j int) bool { return p.Requests[i].Type < p.Requests[j].Type })
+	for _, n := range notifies {
+		p.Notifies = append(p.Notifies, &ProtocolNotify{Type: n.typ, Name: n.name, Doc: n.doc, Data: describeData(n.data)})
+	}
+	sort.Slice(p.Notifies, func(i, j int) bool { return p.Notifies[i].Type < p.Notifies[j].Type })
+	return p
+}
@@ -0,0 +1,50 @@
+package clientctl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+)
+
+func TestHandler_Decode(t *testing.T) {
+	tests := []struct {
+		name string
+		req  RequestType
+		data string
+		err  string
+	}{
+		{"login", LoginReq, `{"userName":"gopher"}`, ""},
+		{"login without userName", LoginReq, `{}`, "data.userName is required"},
+		{"login null data", LoginReq, `null`, "data.userName is required"},
+		{"login null userName", LoginReq, `{"userName":null}`, "data.userName is required"},
+		{"login wrong type", LoginReq, `{"userName":1}`, "data.userName must be string"},
+		{"login empty userName", LoginReq, `{"userName":""}`, "data.userName length must be >= 1"},
+		{"login long userName", LoginReq, `{"userName":"` + strings.Repeat("名", 21) + `"}`, "data.userName length must be <= 20"},
+		{"data not object", LoginReq, `["gopher"]`, "data must be an object"},
+		{"roomSwitch", RoomSwitchReq, `{"room":2}`, ""},
+		{"roomSwitch wrong type", RoomSwitchReq, `{"room":"2"}`, "data.room must be integer"},
+		{"roomSwitch float", RoomSwitchReq, `{"room":1.5}`, "data.room must be integer"},
+		{"roomSwitch min", RoomSwitchReq, `{"room":0}`, "data.room must be >= 1"},
+		{"userSearch optional", UserSearchReq, `{}`, ""},
+		{"userSearch max", UserSearchReq, `{"prefix":"` + strings.Repeat("a", 21) + `"}`, "data.prefix length must be <= 20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := GetHandler(tt.req)
+			require.NotNil(t, h)
+			req, err := h.decode(fastjson.MustParse(tt.data))
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.IsType(t, h.Request, req)
+		})
+	}
+
+	req, err := GetHandler(LoginReq).decode(fastjson.MustParse(`{"userName":"gopher","extra":1}`))
+	require.NoError(t, err)
+	require.Equal(t, &LoginRequest{UserName: "gopher"}, req)
+}
@@ -19,6 +19,11 @@ const (
 	RoomChatReq RequestType = 3001 //发送聊天消息 请求
 	RoomChatAck RequestType = 3002 //发送聊天消息 响应
 	RoomChatNtf RequestType = 4001 //聊天消息 广播
+	TrendingNtf RequestType = 4002 //热词趋势 广播
+	SystemNtf   RequestType = 4003 //系统公告 广播
+
+	UserSearchReq RequestType = 5001 //按名字前缀查询当前房间的在线玩家(@提及补全) 请求
+	UserSearchAck RequestType = 5002 //按名字前缀查询当前房间的在线玩家(@提及补全) 响应
 )
 
 type Response struct {
@@ -43,6 +48,13 @@ type Request struct {
 }
 
 const (
-	ERROR_IGNORE      = -1 //忽略错误操作
-	ERROR_NAME_REPEAT = -2 //姓名重复
+	ERROR_IGNORE       = -1 //忽略错误操作
+	ERROR_NAME_REPEAT  = -2 //姓名重复
+	ERROR_MUTED        = -3 //禁言中
+	ERROR_MSG_EMPTY    = -4 //聊天消息为空
+	ERROR_MSG_LONG     = -5 //聊天消息太长
+	ERROR_RATE_LIMITED = -6 //请求太频繁
+	ERROR_SLOW_MODE    = -7 //房间慢速模式中
+	ERROR_ROOM_BUSY    = -8 //房间消息太多
+	ERROR_SPAM         = -9 //垃圾消息
 )
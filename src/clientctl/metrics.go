@@ -0,0 +1,49 @@
+package clientctl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/metrics"
+)
+
+var (
+	roomReceivedTotal = metrics.NewCounterVec("im_room_messages_received_total", "Chat messages received by each chat room.", "room")
+	badwordHitsTotal  = metrics.NewCounter("im_badword_hits_total", "Chat messages containing bad words.")
+	chatRejectedTotal = metrics.NewCounterVec("im_chat_rejected_total", "Chat messages rejected by each chat pipeline stage.", "stage")
+	rateLimitedTotal  = metrics.NewCounterVec("im_rate_limited_total", "Client requests rejected by the rate limiter by request type.", "type")
+	spamActionsTotal  = metrics.NewCounterVec("im_spam_actions_total", "Actions taken on chat messages detected as spam by action.", "action")
+	requestLatency    = metrics.NewHistogramVec("im_request_latency_seconds", "Time spent processing client requests by request type.", "type", float64(time.Second/time.Microsecond))
+
+	//房间事件产生快于webhook落盘时丢弃
+	webhookEventsDropped = metrics.NewCounter("im_webhook_events_dropped_total", "Room events dropped before being spooled for webhooks.")
+)
+
+func init() {
+	metrics.NewGaugeVecFunc("im_room_sessions", "Sessions in each chat room.", "room", func() map[string]float64 {
+		return roomGauge(func(roomID int64) float64 {
+			return float64(SvrCtl.Rooms[roomID].ClientCount())
+		})
+	})
+	metrics.NewGaugeVecFunc("im_room_broadcast_queue", "Pending messages in the broadcast channel of each chat room.", "room", func() map[string]float64 {
+		return roomGauge(func(roomID int64) float64 {
+			return float64(len(SvrCtl.Rooms[roomID].Broadcast))
+		})
+	})
+}
+
+func roomGauge(f func(roomID int64) float64) map[string]float64 {
+	vals := make(map[string]float64, len(SvrCtl.Rooms))
+	for roomID := range SvrCtl.Rooms {
+		vals[strconv.FormatInt(roomID, 10)] = f(roomID)
+	}
+	return vals
+}
+
+//请求类型的指标标签，未知类型合并统计，避免标签数量无限增长
+func requestTypeLabel(reqType RequestType) string {
+	if GetHandler(reqType) != nil {
+		return strconv.FormatUint(uint64(reqType), 10)
+	}
+	return "unknown"
+}
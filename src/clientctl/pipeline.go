@@ -0,0 +1,175 @@
+package clientctl
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//聊天消息处理阶段的分类，管道按分类顺序执行
+type ChatPhase int
+
+const (
+	PhaseValidate  ChatPhase = iota //校验
+	PhaseLimit                      //长度等限制
+	PhaseNormalize                  //规范化
+	PhaseFilter                     //过滤
+	PhaseEnrich                     //补充用户名、发送时间等
+	PhaseAdmit                      //占用发言额度
+	PhaseRoute                      //投递
+)
+
+var chatPhaseNames = [...]string{"validate", "limit", "normalize", "filter", "enrich", "admit", "route"}
+
+func (p ChatPhase) String() string {
+	if p >= 0 && int(p) < len(chatPhaseNames) {
+		return chatPhaseNames[p]
+	}
+	return fmt.Sprintf("phase(%d)", int(p))
+}
+
+//未配置时使用的管道
+var DefaultChatStages = []string{"validate", "roomlimit", "length", "normalize", "spam", "badword", "enrich", "roomadmit", "route"}
+
+//一条聊天消息在管道中的上下文
+type ChatContext struct {
+	Client *model.ClientAgent
+	//发送者所在房间
+	Room *model.ChatRoom
+	//客户端请求，enrich 阶段改写为广播消息
+	Request *fastjson.Value
+	//客户端请求包，route 阶段投递
+	Packet *session.NetPacket
+	//聊天内容，各阶段可以修改
+	Message string
+	Now     time.Time
+}
+
+//处理阶段，返回错误则拒绝该消息，错误码返回给客户端
+type ChatStageFunc func(cc *ChatContext) *gerror.SysError
+
+//处理阶段工厂 options:配置的阶段参数
+type ChatStageFactory func(options map[string]string) (ChatStageFunc, error)
+
+type chatStageType struct {
+	phase   ChatPhase
+	factory ChatStageFactory
+}
+
+var (
+	chatStageLock  sync.RWMutex
+	chatStageTypes = make(map[string]*chatStageType)
+)
+
+//注册处理阶段，重名时覆盖
+func RegisterChatStage(name string, phase ChatPhase, factory ChatStageFactory) {
+	chatStageLock.Lock()
+	defer chatStageLock.Unlock()
+	chatStageTypes[name] = &chatStageType{phase: phase, factory: factory}
+}
+
+//已注册的处理阶段名
+func ChatStageNames() []string {
+	chatStageLock.RLock()
+	defer chatStageLock.RUnlock()
+	names := make([]string, 0, len(chatStageTypes))
+	for name := range chatStageTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//管道中的一个阶段
+type chatStage struct {
+	name   string
+	phase  ChatPhase
+	handle ChatStageFunc
+}
+
+//聊天消息处理管道，创建后只读，可以并发使用
+type ChatPipeline struct {
+	stages []*chatStage
+}
+
+//按配置创建管道，阶段按分类排序，同一分类保持配置顺序
+func NewChatPipeline(configs []*config.ChatStageConfig) (*ChatPipeline, error) {
+	p := &ChatPipeline{stages: make([]*chatStage, 0, len(configs))}
+	for _, cfg := range configs {
+		chatStageLock.RLock()
+		st := chatStageTypes[cfg.Name]
+		chatStageLock.RUnlock()
+		if st == nil {
+			return nil, fmt.Errorf("unsupport chat stage:%s,stages:%v", cfg.Name, ChatStageNames())
+		}
+		handle, err := st.factory(cfg.Options)
+		if err != nil {
+			return nil, fmt.Errorf("chat stage:%s,err:%v", cfg.Name, err)
+		}
+		p.stages = append(p.stages, &chatStage{name: cfg.Name, phase: st.phase, handle: handle})
+	}
+	sort.SliceStable(p.stages, func(i, j int) bool {
+		return p.stages[i].phase < p.stages[j].phase
+	})
+	if len(p.stages) == 0 || p.stages[len(p.stages)-1].phase != PhaseRoute {
+		return nil, fmt.Errorf("chat pipeline without route stage")
+	}
+	return p, nil
+}
+
+//阶段名，按执行顺序
+func (p *ChatPipeline) Stages() []string {
+	names := make([]string, len(p.stages))
+	for i, stage := range p.stages {
+		names[i] = stage.name
+	}
+	return names
+}
+
+//依次执行各阶段，任一阶段拒绝则中止
+func (p *ChatPipeline) Process(cc *ChatContext) *gerror.SysError {
+	for _, stage := range p.stages {
+		if err := stage.handle(cc); err != nil {
+			chatRejectedTotal.With(stage.name).Inc()
+			cc.Client.Session.Eventf("chat rejected by %s:%s", stage.name, err.Content)
+			return err
+		}
+	}
+	return nil
+}
+
+//按配置创建各房间的管道
+func newChatPipelines(roomSize int64) map[int64]*ChatPipeline {
+	for roomID := range config.Conf.ChatPipelines {
+		if roomID < 0 || roomID > roomSize {
+			panic(fmt.Errorf("chat pipeline room not found:%d", roomID))
+		}
+	}
+	defaults := config.Conf.ChatPipelines[0]
+	if len(defaults) == 0 {
+		defaults = make([]*config.ChatStageConfig, len(DefaultChatStages))
+		for i, name := range DefaultChatStages {
+			defaults[i] = &config.ChatStageConfig{Name: name}
+		}
+	}
+	pipelines := make(map[int64]*ChatPipeline, roomSize)
+	for roomID := int64(1); roomID <= roomSize; roomID++ {
+		configs := config.Conf.ChatPipelines[roomID]
+		if len(configs) == 0 {
+			configs = defaults
+		}
+		p, err := NewChatPipeline(configs)
+		if err != nil {
+			panic(fmt.Errorf("room chat pipeline err:%v,room:%d", err, roomID))
+		}
+		pipelines[roomID] = p
+	}
+	return pipelines
+}
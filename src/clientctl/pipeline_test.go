@@ -0,0 +1,153 @@
+package clientctl
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//注册记录执行顺序的测试阶段，参数 reject 不为空时拒绝消息，bad 不为空时创建失败
+func registerTestStage(name string, phase ChatPhase, calls *[]string) {
+	RegisterChatStage(name, phase, func(options map[string]string) (ChatStageFunc, error) {
+		if options["bad"] != "" {
+			return nil, fmt.Errorf("bad option")
+		}
+		reject := options["reject"] != ""
+		return func(cc *ChatContext) *gerror.SysError {
+			*calls = append(*calls, name)
+			if reject {
+				return gerror.NewError(gerror.SERVER_CDATA_ERROR, name+" rejected")
+			}
+			return nil
+		}, nil
+	})
+}
+
+func stageConfigs(names ...string) []*config.ChatStageConfig {
+	configs := make([]*config.ChatStageConfig, len(names))
+	for i, name := range names {
+		configs[i] = &config.ChatStageConfig{Name: name}
+	}
+	return configs
+}
+
+func TestChatPipeline_Process(t *testing.T) {
+	var calls []string
+	registerTestStage("test_validate", PhaseValidate, &calls)
+	registerTestStage("test_filter1", PhaseFilter, &calls)
+	registerTestStage("test_filter2", PhaseFilter, &calls)
+	registerTestStage("test_route", PhaseRoute, &calls)
+
+	//按分类排序，同一分类保持配置顺序
+	p, err := NewChatPipeline(stageConfigs("test_route", "test_filter2", "test_validate", "test_filter1"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"test_validate", "test_filter2", "test_filter1", "test_route"}, p.Stages())
+
+	cc := &ChatContext{
+		Client: model.NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()}),
+		Now:    time.Now(),
+	}
+	require.Nil(t, p.Process(cc))
+	require.Equal(t, p.Stages(), calls)
+
+	//拒绝后不再执行之后的阶段
+	configs := stageConfigs("test_validate", "test_filter1", "test_filter2", "test_route")
+	configs[1].Options = map[string]string{"reject": "1"}
+	p, err = NewChatPipeline(configs)
+	require.NoError(t, err)
+	rejected := chatRejectedTotal.With("test_filter1").Value()
+	calls = nil
+	sysErr := p.Process(cc)
+	require.NotNil(t, sysErr)
+	require.Equal(t, gerror.SERVER_CDATA_ERROR, sysErr.Code)
+	require.Equal(t, "test_filter1 rejected", sysErr.Content)
+	require.Equal(t, []string{"test_validate", "test_filter1"}, calls)
+	require.EqualValues(t, rejected+1, chatRejectedTotal.With("test_filter1").Value())
+}
+
+func TestNewChatPipeline(t *testing.T) {
+	var calls []string
+	registerTestStage("test_validate", PhaseValidate, &calls)
+	registerTestStage("test_route", PhaseRoute, &calls)
+
+	tests := []struct {
+		name    string
+		configs []*config.ChatStageConfig
+		err     string
+	}{
+		{"default", stageConfigs(DefaultChatStages...), ""},
+		{"unknown stage", stageConfigs("test_validate", "unknown", "test_route"), "unsupport chat stage:unknown"},
+		{"without route", stageConfigs("test_validate"), "chat pipeline without route stage"},
+		{"empty", nil, "chat pipeline without route stage"},
+		{"bad option", []*config.ChatStageConfig{{Name: "test_validate", Options: map[string]string{"bad": "1"}}, {Name: "test_route"}}, "chat stage:test_validate,err:bad option"},
+		{"length option", []*config.ChatStageConfig{{Name: "length", Options: map[string]string{"max": "x"}}, {Name: "route"}}, "chat stage:length,err:bad option max:x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewChatPipeline(tt.configs)
+			if tt.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, DefaultChatStages, p.Stages())
+		})
+	}
+}
+
+func TestChatPipeline_RoomLimit(t *testing.T) {
+	var calls []string
+	registerTestStage("test_filter", PhaseFilter, &calls)
+	registerTestStage("test_route", PhaseRoute, &calls)
+
+	room := model.NewChatRoom(1, 10, nil)
+	require.NoError(t, room.SetLimits(&model.RoomLimits{SlowMode: time.Minute}))
+	cc := &ChatContext{
+		Client: model.NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()}),
+		Room:   room,
+		Now:    time.Now(),
+	}
+
+	//被之后的阶段拒绝的消息不占用慢速模式的额度
+	configs := stageConfigs("roomlimit", "test_filter", "roomadmit", "test_route")
+	configs[1].Options = map[string]string{"reject": "1"}
+	p, err := NewChatPipeline(configs)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.Equal(t, gerror.SERVER_CDATA_ERROR, p.Process(cc).Code)
+	}
+
+	p, err = NewChatPipeline(stageConfigs("roomlimit", "roomadmit", "test_route"))
+	require.NoError(t, err)
+	require.Nil(t, p.Process(cc))
+	require.EqualValues(t, ERROR_SLOW_MODE, p.Process(cc).Code)
+}
+
+//用户名包含控制字符时仍然生成合法json
+func TestEnrichStage(t *testing.T) {
+	client := model.NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()})
+	client.UserName = "bad\x01\"name"
+	cc := &ChatContext{
+		Client:  client,
+		Request: fastjson.MustParse(`{"type":4001,"data":{"message":"hi"}}`),
+		Packet:  &session.NetPacket{},
+		Message: "hello\x02",
+		Now:     time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local),
+	}
+	require.Nil(t, enrichStage(cc))
+	v, err := fastjson.ParseBytes(cc.Packet.Data)
+	require.NoError(t, err)
+	require.Equal(t, int(RoomChatNtf), v.GetInt("type"))
+	require.Equal(t, "bad\x01\"name", string(v.GetStringBytes("data", "userName")))
+	require.Equal(t, "hello\x02", string(v.GetStringBytes("data", "message")))
+	require.Equal(t, "2026-01-02 03:04:05", string(v.GetStringBytes("data", "sendTime")))
+}
@@ -0,0 +1,98 @@
+package clientctl
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//房间发言限制信息
+type RoomLimitsInfo struct {
+	//慢速模式的发言间隔，为空不限制
+	SlowMode       string  `json:"slowMode,omitempty"`
+	BroadcastRate  float64 `json:"broadcastRate,omitempty"`
+	BroadcastBurst int     `json:"broadcastBurst,omitempty"`
+	Policy         string  `json:"policy"`
+	MaxBacklog     int     `json:"maxBacklog"`
+	//排队等待广播的消息数
+	Backlog int64 `json:"backlog"`
+}
+
+//按配置设置各房间的发言限制
+func (s *ClientServer) initRoomLimits() {
+	for roomID := range config.Conf.RoomLimits {
+		if roomID != 0 && s.Room(roomID) == nil {
+			panic(fmt.Errorf("room limits room not found:%d", roomID))
+		}
+	}
+	for roomID, room := range s.Rooms {
+		cfg := config.Conf.RoomLimits[roomID]
+		if cfg == nil {
+			cfg = config.Conf.RoomLimits[0]
+		}
+		if cfg == nil {
+			continue
+		}
+		limits := &model.RoomLimits{
+			BroadcastRate:  cfg.BroadcastRate,
+			BroadcastBurst: cfg.BroadcastBurst,
+			Policy:         cfg.Policy,
+			MaxBacklog:     cfg.MaxBacklog,
+		}
+		if cfg.SlowMode != "" {
+			d, err := time.ParseDuration(cfg.SlowMode)
+			if err != nil {
+				panic(fmt.Errorf("room limits slowMode:%s,room:%d", cfg.SlowMode, roomID))
+			}
+			limits.SlowMode = d
+		}
+		if err := room.SetLimits(limits); err != nil {
+			panic(fmt.Errorf("room limits err:%v,room:%d", err, roomID))
+		}
+	}
+}
+
+//房间当前的发言限制
+func (s *ClientServer) RoomLimits(roomID int64) (*RoomLimitsInfo, error) {
+	room := s.Room(roomID)
+	if room == nil {
+		return nil, errors.New("no room found")
+	}
+	limits := room.Limits()
+	info := &RoomLimitsInfo{
+		BroadcastRate:  limits.BroadcastRate,
+		BroadcastBurst: limits.BroadcastBurst,
+		Policy:         limits.Policy,
+		MaxBacklog:     limits.MaxBacklog,
+		Backlog:        room.BacklogLen(),
+	}
+	if limits.SlowMode > 0 {
+		info.SlowMode = limits.SlowMode.String()
+	}
+	return info, nil
+}
+
+//修改房间的发言限制，慢速模式变化时发送系统公告
+func (s *ClientServer) SetRoomLimits(roomID int64, limits *model.RoomLimits) error {
+	room := s.Room(roomID)
+	if room == nil {
+		return errors.New("no room found")
+	}
+	old := room.Limits()
+	if err := room.SetLimits(limits); err != nil {
+		return err
+	}
+	if old.SlowMode != limits.SlowMode {
+		notice := "慢速模式已关闭"
+		if limits.SlowMode > 0 {
+			notice = fmt.Sprintf("慢速模式已开启，每 %s 可发言一次", limits.SlowMode)
+		}
+		if _, err := s.Announce(roomID, notice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
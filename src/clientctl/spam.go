@@ -0,0 +1,173 @@
+package clientctl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/core/spam"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//垃圾消息的处理动作，按严厉程度从低到高
+const (
+	SpamWarn = "warn" //发送警告，消息正常广播
+	SpamDrop = "drop" //丢弃消息
+	SpamMute = "mute" //禁言并丢弃消息
+	SpamKick = "kick" //踢下线
+)
+
+var spamActions = []string{SpamWarn, SpamDrop, SpamMute, SpamKick}
+
+//默认的禁言时长
+const DefaultSpamMuteDuration = 10 * time.Minute
+
+//垃圾消息检测
+type spamFilter struct {
+	engine *spam.Engine
+	//各动作的最低得分，<=0不使用该动作
+	scores       map[string]float64
+	muteDuration time.Duration
+}
+
+func init() {
+	RegisterChatStage("spam", PhaseFilter, staticChatStage(spamStage))
+}
+
+//按配置创建垃圾消息检测，未配置时返回空
+func newSpamFilter() *spamFilter {
+	cfg := config.Conf.Spam
+	if cfg == nil {
+		return nil
+	}
+	conf := spam.Config{
+		RepeatCount:     cfg.RepeatCount,
+		RepeatScore:     cfg.RepeatScore,
+		SwarmUsers:      cfg.SwarmUsers,
+		SwarmSimilarity: cfg.SwarmSimilarity,
+		SwarmMinLen:     cfg.SwarmMinLen,
+		SwarmScore:      cfg.SwarmScore,
+		MaxLinks:        cfg.MaxLinks,
+		LinkRatio:       cfg.LinkRatio,
+		LinkScore:       cfg.LinkScore,
+		CapsRatio:       cfg.CapsRatio,
+		CapsMinLetters:  cfg.CapsMinLetters,
+		CapsScore:       cfg.CapsScore,
+		FloodRun:        cfg.FloodRun,
+		FloodEmoji:      cfg.FloodEmoji,
+		FloodScore:      cfg.FloodScore,
+		NewBurst:        cfg.NewBurst,
+		NewScore:        cfg.NewScore,
+	}
+	filter := &spamFilter{
+		scores:       make(map[string]float64, len(cfg.Actions)),
+		muteDuration: DefaultSpamMuteDuration,
+	}
+	for _, opt := range []struct {
+		name string
+		val  string
+		d    *time.Duration
+	}{
+		{"repeatWindow", cfg.RepeatWindow, &conf.RepeatWindow},
+		{"swarmWindow", cfg.SwarmWindow, &conf.SwarmWindow},
+		{"newAge", cfg.NewAge, &conf.NewAge},
+		{"newWindow", cfg.NewWindow, &conf.NewWindow},
+		{"muteDuration", cfg.MuteDuration, &filter.muteDuration},
+	} {
+		if opt.val == "" {
+			continue
+		}
+		d, err := time.ParseDuration(opt.val)
+		if err != nil || d <= 0 {
+			panic(fmt.Errorf("spam config %s:%s", opt.name, opt.val))
+		}
+		*opt.d = d
+	}
+	for action, score := range cfg.Actions {
+		if !validSpamAction(action) {
+			panic(fmt.Errorf("unsupport spam action:%s", action))
+		}
+		filter.scores[action] = score
+	}
+	engine, err := spam.NewEngine(conf)
+	if err != nil {
+		panic(fmt.Errorf("spam config err:%v", err))
+	}
+	filter.engine = engine
+	return filter
+}
+
+func validSpamAction(action string) bool {
+	for _, a := range spamActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+//得分对应的最严厉动作，没有满足的动作返回空
+func (f *spamFilter) action(score float64) string {
+	for i := len(spamActions) - 1; i >= 0; i-- {
+		if min := f.scores[spamActions[i]]; min > 0 && score >= min {
+			return spamActions[i]
+		}
+	}
+	return ""
+}
+
+//玩家下线后移除其发言记录
+func (f *spamFilter) forget(sessionID int64) {
+	if f == nil {
+		return
+	}
+	f.engine.Forget(sessionID)
+}
+
+//检测垃圾消息，按得分警告、丢弃、禁言或踢下线
+func spamStage(cc *ChatContext) *gerror.SysError {
+	filter := SvrCtl.spam
+	if filter == nil {
+		return nil
+	}
+	verdict := filter.engine.Check(&spam.Message{
+		UserID:    cc.Client.Session.ID(),
+		RoomID:    cc.Room.RoomID,
+		Text:      cc.Message,
+		LoginTime: cc.Client.Session.LoginTime(),
+		Now:       cc.Now,
+	})
+	action := filter.action(verdict.Score)
+	if action == "" {
+		return nil
+	}
+	reason := strings.Join(verdict.Reasons, ",")
+	spamActionsTotal.With(action).Inc()
+	cc.Client.Session.Eventf("spam %s score:%g,reasons:%s", action, verdict.Score, reason)
+	switch action {
+	case SpamWarn:
+		cc.Client.Session.Send(&session.NetPacket{
+			MsgType: session.TextMessage,
+			Data: (&Response{
+				Type: SystemNtf,
+				Code: gerror.OK,
+				Data: &SystemNotify{
+					Notice:   fmt.Sprintf("你的消息疑似垃圾信息(%s)，继续发送将被禁言", reason),
+					SendTime: cc.Now.Format("2006-01-02 15:04:05"),
+				},
+			}).toJson(),
+		})
+		return nil
+	case SpamMute:
+		cc.Client.Mute(filter.muteDuration)
+		SvrCtl.notifyModeration(cc.Client, model.FeedMute, "spam:"+reason)
+		return gerror.NewError(ERROR_MUTED, fmt.Sprintf("muted %s for spam:%s", filter.muteDuration, reason))
+	case SpamKick:
+		SvrCtl.notifyModeration(cc.Client, model.FeedKick, "spam:"+reason)
+		cc.Client.Session.CloseWithReason(session.ClosePolicyViolation, "spam")
+	}
+	return gerror.NewError(ERROR_SPAM, "message dropped as spam:"+reason)
+}
@@ -4,13 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/gorilla/websocket"
 	"github.com/valyala/fastjson"
-	"github.com/zxfonline/IMDemo/core/badword"
 	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/hotword"
 	"github.com/zxfonline/IMDemo/core/log"
 	"github.com/zxfonline/IMDemo/core/nametrie"
 	"github.com/zxfonline/IMDemo/core/session"
@@ -21,133 +21,293 @@ var (
 	NameReapCheck = nametrie.NewNameMatchTrie()
 )
 
+//@提及补全单次返回的最大玩家数量
+const UserSearchLimit = 10
+
+//登录 请求
+type LoginRequest struct {
+	UserName string `json:"userName" schema:"required,min=1,max=20" doc:"玩家名字，不能重复"`
+}
+
+//切换房间 请求
+type RoomSwitchRequest struct {
+	Room int64 `json:"room" schema:"required,min=1" doc:"房间号"`
+}
+
+//发送聊天消息 请求
+type RoomChatRequest struct {
+	Message string `json:"message" schema:"required" doc:"聊天内容"`
+}
+
+//@提及补全 请求
+type UserSearchRequest struct {
+	Prefix string `json:"prefix" schema:"max=20" doc:"名字前缀"`
+	Limit  int    `json:"limit" doc:"最多返回的玩家数，<=0或超过10时返回10个"`
+}
+
+//登录和切换房间 响应，之后推送房间最近的聊天消息
+type RoomResponse struct {
+	RoomID   int64  `json:"roomID"`
+	UserName string `json:"userName"`
+}
+
+//@提及补全 响应
+type UserSearchResponse struct {
+	Prefix    string   `json:"prefix"`
+	UserNames []string `json:"userNames"`
+}
+
+//请求被限流时错误响应的数据
+type RateLimitedData struct {
+	//重试前需要等待的毫秒数
+	RetryAfter int64 `json:"retryAfter"`
+}
+
+//需要等待后重试的错误和响应数据
+func retryAfterError(message string, retryAfter time.Duration) (*RateLimitedData, error) {
+	retryMillis := int64((retryAfter + time.Millisecond - 1) / time.Millisecond)
+	return &RateLimitedData{RetryAfter: retryMillis}, fmt.Errorf("%s,retry after %dms", message, retryMillis)
+}
+
+//聊天消息 广播
+type ChatNotify struct {
+	Message  string `json:"message"`
+	UserName string `json:"userName"`
+	SendTime string `json:"sendTime"`
+	//机器人发送的消息
+	Bot bool `json:"bot,omitempty"`
+}
+
+//系统公告 广播
+type SystemNotify struct {
+	Notice   string `json:"notice"`
+	SendTime string `json:"sendTime"`
+}
+
+func init() {
+	RegisterHandler(&Handler{
+		Req:      LoginReq,
+		Ack:      LoginAck,
+		Name:     "login",
+		Doc:      "登录并随机进入一个房间",
+		Request:  &LoginRequest{},
+		Response: &RoomResponse{},
+		Handle:   handleLogin,
+	})
+	RegisterHandler(&Handler{
+		Req:      RoomSwitchReq,
+		Ack:      RoomSwitchAck,
+		Name:     "roomSwitch",
+		Doc:      "切换房间，切换到当前房间时不响应",
+		Request:  &RoomSwitchRequest{},
+		Response: &RoomResponse{},
+		Handle:   handleRoomSwitch,
+	})
+	RegisterHandler(&Handler{
+		Req:     RoomChatReq,
+		Ack:     RoomChatAck,
+		Name:    "roomChat",
+		Doc:     "在当前房间发送聊天消息，成功时不响应，消息以 4001 广播给房间成员",
+		Request: &RoomChatRequest{},
+		Handle:  handleRoomChat,
+	})
+	RegisterHandler(&Handler{
+		Req:      UserSearchReq,
+		Ack:      UserSearchAck,
+		Name:     "userSearch",
+		Doc:      "按名字前缀查询当前房间的在线玩家(@提及补全)",
+		Request:  &UserSearchRequest{},
+		Response: &UserSearchResponse{},
+		Handle:   handleUserSearch,
+	})
+	RegisterNotify(RoomChatNtf, "roomChat", "房间聊天消息", &ChatNotify{})
+	RegisterNotify(TrendingNtf, "trending", "房间热词趋势", []*hotword.HotWord{})
+	RegisterNotify(SystemNtf, "system", "系统公告", &SystemNotify{})
+}
+
 func ProcessTextMessage(ctx context.Context, wg *sync.WaitGroup, clientAgent *model.ClientAgent, msg *session.NetPacket) (err error, retMsg []*session.NetPacket) {
 	v, perr := fastjson.ParseBytes(msg.Data)
 	if perr != nil {
 		err = perr
 		retMsg = []*session.NetPacket{{
-			MsgType: websocket.CloseMessage,
-			Data:    websocket.FormatCloseMessage(websocket.CloseInvalidFramePayloadData, "parse payload err"),
+			MsgType: session.CloseMessage,
+			Data:    session.FormatCloseMessage(session.CloseInvalidFramePayloadData, "parse payload err"),
 		}}
 		return
 	}
 	log.Debugf("request:%v", v.String())
 	//Request
-	reqType := v.GetUint("type")
+	reqType := RequestType(v.GetUint("type"))
 	ackType := reqType + 1
 	errCode := gerror.SERVER_CDATA_ERROR
+	var errData interface{}
 	//处理异常错误
 	defer func() {
 		if err != nil {
 			retMsg = []*session.NetPacket{{
-				MsgType: websocket.TextMessage,
+				MsgType: session.TextMessage,
 				Data: (&Response{
-					Type:    RequestType(ackType),
+					Type:    ackType,
 					Code:    errCode,
 					CodeMsg: err.Error(),
+					Data:    errData,
 				}).toJson(),
 			}}
 		}
 	}()
 	//捕获异常
 	defer gerror.PanicToErr(&err)
+	defer func(start time.Time) {
+		requestLatency.With(requestTypeLabel(reqType)).Observe(int64(time.Since(start) / time.Microsecond))
+	}(time.Now())
 
-	roomIDState := clientAgent.State.Load()
-	switch RequestType(reqType) {
-	case LoginReq:
-		ackType = uint(LoginAck)
-		if roomIDState == -1 { //玩家掉线
-			err = errors.New("you are logout,refresh page(F5)")
-			return
-		}
-		if roomIDState > 0 { //玩家已经有房间了
-			errCode = ERROR_IGNORE //不做操作
-			err = errors.New("you are in the chat room")
-			return
-		}
-		userName := v.GetStringBytes("data", "userName")
-		if NameReapCheck.FullMatch(string(userName)) {
-			errCode = ERROR_NAME_REPEAT //姓名重复
-			err = errors.New("repeated name,change name please")
-			return
-		}
-		NameReapCheck.Add(string(userName))
-		clientAgent.UserName = string(userName)
-		room := SvrCtl.RandRoom()
-		clientAgent.State.Store(room.RoomID)
-
-		retMsg = []*session.NetPacket{{
-			MsgType: websocket.TextMessage,
-			Data: (&Response{
-				Type: RequestType(ackType),
-				Code: gerror.OK,
-				Data: &struct {
-					RoomID   int64  `json:"roomID"`
-					UserName string `json:"userName"`
-				}{
-					RoomID:   room.RoomID,
-					UserName: clientAgent.UserName,
-				},
-			}).toJson(),
-		}}
-		retMsg = append(retMsg, room.RecentMsg...)
-		room.Register <- clientAgent
+	h := GetHandler(reqType)
+	if h == nil {
+		err = fmt.Errorf("unsupport request type:%d", reqType)
 		return
-	case RoomSwitchReq:
-		ackType = uint(RoomSwitchAck)
-		oldRoom := SvrCtl.Room(roomIDState)
-		if oldRoom == nil {
-			err = errors.New("you haven not logged in yet")
-			return
-		}
-		roomID := v.GetInt64("data", "room")
-		newRoom := SvrCtl.Room(roomID)
-		if newRoom == nil {
-			err = errors.New("not found new room")
+	}
+	ackType = h.Ack
+	//管理接口代发的请求(如移动房间)没有接收时间，不限流
+	if limit := SvrCtl.RateLimit(reqType); limit != nil && !msg.ReceiveTime.IsZero() {
+		if ok, retryAfter := clientAgent.Allow(h.Name, limit, time.Now()); !ok {
+			clientAgent.Stats.RateLimited.Inc()
+			rateLimitedTotal.With(requestTypeLabel(reqType)).Inc()
+			clientAgent.Session.Eventf("rate limited:%s,retry after:%v", h.Name, retryAfter)
+			errCode = ERROR_RATE_LIMITED
+			errData, err = retryAfterError("too many requests", retryAfter)
 			return
 		}
-		if roomID == roomIDState { //房间相同不用处理
-			return
+	}
+	req, derr := h.decode(v.Get("data"))
+	if derr != nil {
+		err = derr
+		return
+	}
+	rc := &RequestContext{
+		Client:  clientAgent,
+		Packet:  msg,
+		Request: v,
+		RoomID:  clientAgent.State.Load(),
+	}
+	resp, herr := h.Handle(rc, req)
+	if herr != nil {
+		if serr, ok := herr.(*gerror.SysError); ok {
+			errCode = serr.Code
+			errData = serr.Data
+			herr = errors.New(serr.Content)
 		}
-		//更换房间
-		clientAgent.State.Store(newRoom.RoomID)
-		oldRoom.Unregister <- clientAgent
-
-		retMsg = []*session.NetPacket{{
-			MsgType: websocket.TextMessage,
+		err = herr
+		return
+	}
+	if resp != nil {
+		retMsg = append(retMsg, &session.NetPacket{
+			MsgType: session.TextMessage,
 			Data: (&Response{
-				Type: RequestType(ackType),
+				Type: ackType,
 				Code: gerror.OK,
-				Data: &struct {
-					RoomID   int64  `json:"roomID"`
-					UserName string `json:"userName"`
-				}{
-					RoomID:   newRoom.RoomID,
-					UserName: clientAgent.UserName,
-				},
+				Data: resp,
 			}).toJson(),
-		}}
-		retMsg = append(retMsg, newRoom.RecentMsg...)
-		newRoom.Register <- clientAgent
-		return
-	case RoomChatReq: // 当前房间聊天
-		ackType = uint(RoomChatAck)
-		if roomIDState > 0 { //当前房间
-			//构建消息用户名和发送时间,替换脏字
-			chatMessage := string(v.GetStringBytes("data", "message"))
-			chatMessage = badword.BadWordReplace(chatMessage)
-			v.Get("data").Set("message", fastjson.MustParse(fmt.Sprintf("%q", chatMessage)))
-			v.Get("data").Set("userName", fastjson.MustParse(fmt.Sprintf("%q", clientAgent.UserName)))
-			v.Get("data").Set("sendTime", fastjson.MustParse(fmt.Sprintf("%q", time.Now().Format("2006-01-02 15:04:05"))))
-			v.Set("type", fastjson.MustParse(fmt.Sprintf("%d", RoomChatNtf)))
-			msg.Data = []byte(v.String())
-			room := SvrCtl.Room(roomIDState)
-			room.Broadcast <- msg
-			return
-		} else {
-			err = errors.New("no found chat room,refresh page(F5)")
-			return
-		}
+		})
 	}
+	retMsg = append(retMsg, rc.After...)
 	return
 }
+
+func handleLogin(rc *RequestContext, req interface{}) (interface{}, error) {
+	clientAgent := rc.Client
+	if rc.RoomID == -1 { //玩家掉线
+		return nil, errors.New("you are logout,refresh page(F5)")
+	}
+	if rc.RoomID > 0 { //玩家已经有房间了
+		return nil, gerror.NewError(ERROR_IGNORE, "you are in the chat room") //不做操作
+	}
+	userName := req.(*LoginRequest).UserName
+	if strings.TrimSpace(userName) == "" {
+		return nil, errors.New("data.userName is blank")
+	}
+	if NameReapCheck.FullMatch(userName) {
+		return nil, gerror.NewError(ERROR_NAME_REPEAT, "repeated name,change name please") //姓名重复
+	}
+	NameReapCheck.Add(userName)
+	model.ClientAgentRename(clientAgent, userName)
+	room := SvrCtl.RandRoom()
+	clientAgent.State.Store(room.RoomID)
+	clientAgent.Stats.RoomsVisited.Inc()
+	clientAgent.Session.Eventf("login name:%s,room:%d", clientAgent.UserName, room.RoomID)
+
+	rc.After = room.RecentMsgs()
+	room.Register <- clientAgent
+	return &RoomResponse{
+		RoomID:   room.RoomID,
+		UserName: clientAgent.UserName,
+	}, nil
+}
+
+func handleRoomSwitch(rc *RequestContext, req interface{}) (interface{}, error) {
+	clientAgent := rc.Client
+	oldRoom := SvrCtl.Room(rc.RoomID)
+	if oldRoom == nil {
+		return nil, errors.New("you haven not logged in yet")
+	}
+	roomID := req.(*RoomSwitchRequest).Room
+	newRoom := SvrCtl.Room(roomID)
+	if newRoom == nil {
+		return nil, errors.New("not found new room")
+	}
+	if roomID == rc.RoomID { //房间相同不用处理
+		return nil, nil
+	}
+	//更换房间
+	clientAgent.State.Store(newRoom.RoomID)
+	clientAgent.Stats.RoomsVisited.Inc()
+	clientAgent.Session.Eventf("switch room:%d->%d", rc.RoomID, newRoom.RoomID)
+	oldRoom.Unregister <- clientAgent
+
+	rc.After = newRoom.RecentMsgs()
+	newRoom.Register <- clientAgent
+	return &RoomResponse{
+		RoomID:   newRoom.RoomID,
+		UserName: clientAgent.UserName,
+	}, nil
+}
+
+// 当前房间聊天
+func handleRoomChat(rc *RequestContext, req interface{}) (interface{}, error) {
+	if rc.RoomID <= 0 {
+		return nil, errors.New("no found chat room,refresh page(F5)")
+	}
+	cc := &ChatContext{
+		Client:  rc.Client,
+		Room:    SvrCtl.Room(rc.RoomID),
+		Request: rc.Request,
+		Packet:  rc.Packet,
+		Message: req.(*RoomChatRequest).Message,
+		Now:     time.Now(),
+	}
+	if err := SvrCtl.Pipeline(rc.RoomID).Process(cc); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+//@提及补全
+func handleUserSearch(rc *RequestContext, req interface{}) (interface{}, error) {
+	if rc.RoomID <= 0 {
+		return nil, errors.New("no found chat room,refresh page(F5)")
+	}
+	search := req.(*UserSearchRequest)
+	limit := search.Limit
+	if limit <= 0 || limit > UserSearchLimit {
+		limit = UserSearchLimit
+	}
+	names := make([]string, 0, limit)
+	for _, found := range model.SearchClientAgents(search.Prefix, limit, func(findAgent *model.ClientAgent) bool {
+		return findAgent != rc.Client && findAgent.State.Load() == rc.RoomID
+	}) {
+		names = append(names, found.Name())
+	}
+	return &UserSearchResponse{
+		Prefix:    search.Prefix,
+		UserNames: names,
+	}, nil
+}
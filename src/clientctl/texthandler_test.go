@@ -0,0 +1,31 @@
+package clientctl
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+func TestProcessTextMessage_RateLimit(t *testing.T) {
+	rateLimits := SvrCtl.rateLimits
+	SvrCtl.rateLimits = map[RequestType]*model.RateLimit{RoomSwitchReq: {Rate: 0.001, Burst: 1}}
+	defer func() { SvrCtl.rateLimits = rateLimits }()
+
+	client := model.NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()})
+	//房间号不合法，通过限流后解析失败
+	data := []byte(`{"type":2001,"data":{"room":0}}`)
+	process := func(receiveTime time.Time) error {
+		err, _ := ProcessTextMessage(context.Background(), &sync.WaitGroup{}, client, &session.NetPacket{MsgType: session.TextMessage, Data: data, ReceiveTime: receiveTime})
+		return err
+	}
+	require.EqualError(t, process(time.Now()), "data.room must be >= 1")
+	require.EqualError(t, process(time.Now()), "too many requests,retry after 1000000ms")
+	//管理接口代发的请求不限流
+	require.EqualError(t, process(time.Time{}), "data.room must be >= 1")
+}
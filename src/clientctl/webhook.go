@@ -0,0 +1,133 @@
+package clientctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/webhook"
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//webhook订阅房间事件的缓存数量，落盘较慢时避免丢事件，缓存满后丢弃的事件计入 im_webhook_events_dropped_total
+const webhookFeedBuffer = 4096
+
+//webhook每次最多一起落盘的房间事件数
+const webhookBatchSize = 256
+
+//可推送的房间事件
+var webhookEvents = map[string]bool{
+	model.FeedMessage:  true,
+	model.FeedJoin:     true,
+	model.FeedLeave:    true,
+	model.FeedAnnounce: true,
+	model.FeedBadword:  true,
+	model.FeedKick:     true,
+	model.FeedMute:     true,
+	model.FeedMove:     true,
+}
+
+//房间的一个webhook
+type roomWebhook struct {
+	url    string
+	events map[string]bool
+}
+
+//按配置订阅房间事件并推送到webhook，推送在房间协程之外落盘和投递
+func (s *ClientServer) startWebhooks(ctx context.Context, wg *sync.WaitGroup) {
+	hooks := config.Conf.Webhooks
+	if len(hooks) == 0 {
+		return
+	}
+	if config.Conf.WebhookSpoolDir == "" {
+		panic(fmt.Errorf("webhookSpoolDir required"))
+	}
+	secrets := make(map[string]string, len(hooks))
+	roomHooks := make(map[int64][]*roomWebhook, len(s.Rooms))
+	for _, hook := range hooks {
+		if hook.URL == "" {
+			panic(fmt.Errorf("empty webhook url"))
+		}
+		secrets[hook.URL] = hook.Secret
+		var events map[string]bool
+		if len(hook.Events) > 0 {
+			events = make(map[string]bool, len(hook.Events))
+			for _, event := range hook.Events {
+				if !webhookEvents[event] {
+					panic(fmt.Errorf("unsupport webhook event:%s,url:%s", event, hook.URL))
+				}
+				events[event] = true
+			}
+		}
+		target := &roomWebhook{url: hook.URL, events: events}
+		if len(hook.Rooms) == 0 {
+			for roomID := range s.Rooms {
+				roomHooks[roomID] = append(roomHooks[roomID], target)
+			}
+			continue
+		}
+		for _, roomID := range hook.Rooms {
+			if s.Room(roomID) == nil {
+				panic(fmt.Errorf("webhook room not found:%d,url:%s", roomID, hook.URL))
+			}
+			roomHooks[roomID] = append(roomHooks[roomID], target)
+		}
+	}
+	dispatcher, err := webhook.NewDispatcher(config.Conf.WebhookSpoolDir, secrets, config.Conf.WebhookMaxAttempts)
+	if err != nil {
+		panic(fmt.Errorf("webhook spool dir:%s,err:%v", config.Conf.WebhookSpoolDir, err))
+	}
+	go dispatcher.Run(ctx, wg)
+	for roomID, targets := range roomHooks {
+		go forwardRoomEvents(ctx, wg, s.Room(roomID), targets, dispatcher)
+	}
+}
+
+//把房间事件加入投递队列
+func forwardRoomEvents(ctx context.Context, wg *sync.WaitGroup, room *model.ChatRoom, targets []*roomWebhook, dispatcher *webhook.Dispatcher) {
+	wg.Add(1)
+	defer wg.Done()
+	defer log.PrintPanicStack()
+	sub := room.Feed().Subscribe(webhookFeedBuffer)
+	defer sub.Close()
+	var dropped int64
+	var entries []webhook.Entry
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-sub.C:
+			//已到达的事件一起落盘，减少同步磁盘的次数
+			entries = appendWebhookEntries(entries[:0], event, targets)
+			for n := 1; n < webhookBatchSize && len(sub.C) > 0; n++ {
+				entries = appendWebhookEntries(entries, <-sub.C, targets)
+			}
+			if n := sub.Dropped(); n > dropped {
+				webhookEventsDropped.Add(n - dropped)
+				log.Warnf("webhook room events dropped:%d,room:%d", n-dropped, room.RoomID)
+				dropped = n
+			}
+			if err := dispatcher.EnqueueBatch(entries); err != nil {
+				log.Errorf("webhook enqueue err:%v,room:%d,events:%d", err, room.RoomID, len(entries))
+			}
+		}
+	}
+}
+
+//按各webhook订阅的事件类型生成投递
+func appendWebhookEntries(entries []webhook.Entry, event *model.RoomEvent, targets []*roomWebhook) []webhook.Entry {
+	var body []byte
+	for _, target := range targets {
+		if target.events != nil && !target.events[event.Type] {
+			continue
+		}
+		if body == nil {
+			body, _ = json.Marshal(event)
+		}
+		entries = append(entries, webhook.Entry{URL: target.url, Event: event.Type, Body: body})
+	}
+	return entries
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/gerror"
+)
+
+//管理令牌的请求头，和服务器 service.AdminTokenHeader 一致
+const adminTokenHeader = "X-Admin-Token"
+
+//管理接口客户端
+type adminClient struct {
+	server string
+	token  string
+	http   *http.Client
+}
+
+func newAdminClient(server, token string, timeout time.Duration) *adminClient {
+	return &adminClient{
+		server: strings.TrimRight(server, "/"),
+		token:  token,
+		http:   &http.Client{Timeout: timeout},
+	}
+}
+
+//管理接口的响应
+type adminResult struct {
+	Code    gerror.ErrorType `json:"code"`
+	Message string           `json:"message,omitempty"`
+	Data    json.RawMessage  `json:"data,omitempty"`
+}
+
+//调用管理接口，返回响应中的data
+func (c *adminClient) call(method, path string, params url.Values) (json.RawMessage, error) {
+	u := c.server + "/admin" + path
+	var body *strings.Reader
+	if method == http.MethodGet {
+		if len(params) > 0 {
+			u += "?" + params.Encode()
+		}
+		body = strings.NewReader("")
+	} else {
+		body = strings.NewReader(params.Encode())
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if method != http.MethodGet {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if c.token != "" {
+		req.Header.Set(adminTokenHeader, c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s:%s", method, path, resp.Status)
+	}
+	var result adminResult
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("%s %s:bad response:%v", method, path, err)
+	}
+	if result.Code != gerror.OK {
+		return nil, fmt.Errorf("%s %s:code:%d,message:%s", method, path, result.Code, result.Message)
+	}
+	return result.Data, nil
+}
+
+//调用管理接口并解析data
+func (c *adminClient) callInto(method, path string, params url.Values, v interface{}) error {
+	data, err := c.call(method, path, params)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
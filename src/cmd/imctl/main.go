@@ -0,0 +1,325 @@
+/*
+	imctl 聊天服务器管理工具，通过管理接口 /admin 操作在线的服务器
+
+	imctl [-server http://127.0.0.1:8080] [-token 令牌] [-o table|json] 命令 [参数]
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//子命令
+type command struct {
+	usage string
+	help  string
+	run   func(c *adminClient, format string, w io.Writer, args []string) error
+}
+
+var commands = []struct {
+	name string
+	*command
+}{
+	{"rooms", &command{"rooms", "list rooms with member counts", runRooms}},
+	{"users", &command{"users [room]", "list online sessions", runUsers}},
+	{"kick", &command{"kick <session|name> [reason]", "kick a session", runKick}},
+	{"mute", &command{"mute <session|name> <duration>", "mute a session, 0 to unmute", runMute}},
+	{"unmute", &command{"unmute <session|name>", "unmute a session", runUnmute}},
+	{"move", &command{"move <session|name> <room>", "move a session to another room", runMove}},
+	{"limits", &command{"limits <room> [key=value...]", "show or change room limits (slowMode,rate,burst,policy,backlog)", runLimits}},
+	{"announce", &command{"announce <room|all> <message>", "send a system announcement", runAnnounce}},
+	{"badword", &command{"badword reload", "reload the badword file", runBadword}},
+	{"log", &command{"log level [level]", "show or change the log level", runLog}},
+	{"config", &command{"config dump", "dump the server config", runConfig}},
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.command
+		}
+	}
+	return nil
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: imctl [flags] <command> [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-32s %s\n", cmd.usage, cmd.help)
+	}
+	fmt.Fprintf(out, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	server := flag.String("server", envDefault("IMCTL_SERVER", "http://127.0.0.1:8080"), "server address (env IMCTL_SERVER)")
+	token := flag.String("token", os.Getenv("IMCTL_TOKEN"), "admin token (env IMCTL_TOKEN)")
+	format := flag.String("o", outputTable, "output format: table|json")
+	timeout := flag.Duration("timeout", 10*time.Second, "request timeout")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if *format != outputTable && *format != outputJson {
+		fmt.Fprintf(os.Stderr, "imctl: unsupport output format:%s\n", *format)
+		os.Exit(2)
+	}
+	cmd := findCommand(flag.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "imctl: unknown command:%s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	c := newAdminClient(*server, *token, *timeout)
+	if err := cmd.run(c, *format, os.Stdout, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: imctl %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "imctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func envDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+//参数错误
+var errUsage = errors.New("usage")
+
+//操作类命令的输出
+type actionResult struct {
+	OK      bool        `json:"ok"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func printAction(w io.Writer, format, message string, data interface{}) error {
+	if format == outputJson {
+		return printResult(w, format, &actionResult{OK: true, Message: message, Data: data})
+	}
+	return printResult(w, format, message)
+}
+
+func runRooms(c *adminClient, format string, w io.Writer, args []string) error {
+	var rooms roomInfos
+	if err := c.callInto(http.MethodGet, "/rooms", nil, &rooms); err != nil {
+		return err
+	}
+	return printResult(w, format, rooms)
+}
+
+func listSessions(c *adminClient, room string) (sessionInfos, error) {
+	params := url.Values{}
+	if room != "" {
+		params.Set("room", room)
+	}
+	var sessions sessionInfos
+	err := c.callInto(http.MethodGet, "/sessions", params, &sessions)
+	return sessions, err
+}
+
+func runUsers(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	var room string
+	if len(args) == 1 {
+		if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+			return errUsage
+		}
+		room = args[0]
+	}
+	sessions, err := listSessions(c, room)
+	if err != nil {
+		return err
+	}
+	return printResult(w, format, sessions)
+}
+
+//会话id或在线玩家的名字转换为会话id
+func resolveSession(c *adminClient, arg string) (int64, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil && id > 0 {
+		return id, nil
+	}
+	sessions, err := listSessions(c, "")
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range sessions {
+		if s.UserName == arg {
+			return s.SessionID, nil
+		}
+	}
+	return 0, fmt.Errorf("no online user:%s", arg)
+}
+
+func runKick(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	sessionID, err := resolveSession(c, args[0])
+	if err != nil {
+		return err
+	}
+	params := url.Values{"reason": {strings.Join(args[1:], " ")}}
+	if _, err = c.call(http.MethodPost, fmt.Sprintf("/sessions/%d/kick", sessionID), params); err != nil {
+		return err
+	}
+	return printAction(w, format, fmt.Sprintf("session %d kicked", sessionID), nil)
+}
+
+func mute(c *adminClient, format string, w io.Writer, target string, d time.Duration) error {
+	sessionID, err := resolveSession(c, target)
+	if err != nil {
+		return err
+	}
+	params := url.Values{"duration": {d.String()}}
+	if _, err = c.call(http.MethodPost, fmt.Sprintf("/sessions/%d/mute", sessionID), params); err != nil {
+		return err
+	}
+	if d <= 0 {
+		return printAction(w, format, fmt.Sprintf("session %d unmuted", sessionID), nil)
+	}
+	return printAction(w, format, fmt.Sprintf("session %d muted for %s", sessionID, d), nil)
+}
+
+func runMute(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	d, err := time.ParseDuration(args[1])
+	if err != nil || d < 0 {
+		return fmt.Errorf("bad duration:%s", args[1])
+	}
+	return mute(c, format, w, args[0], d)
+}
+
+func runUnmute(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return mute(c, format, w, args[0], 0)
+}
+
+func runMove(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	sessionID, err := resolveSession(c, args[0])
+	if err != nil {
+		return err
+	}
+	if _, err = c.call(http.MethodPost, fmt.Sprintf("/sessions/%d/move", sessionID), url.Values{"room": {args[1]}}); err != nil {
+		return err
+	}
+	return printAction(w, format, fmt.Sprintf("session %d moved to room %s", sessionID, args[1]), nil)
+}
+
+//房间发言限制的可修改参数
+var limitKeys = map[string]bool{"slowMode": true, "rate": true, "burst": true, "policy": true, "backlog": true}
+
+func runLimits(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) < 1 {
+		return errUsage
+	}
+	if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+		return errUsage
+	}
+	path := "/rooms/" + args[0] + "/limits"
+	var limits roomLimits
+	if len(args) == 1 {
+		if err := c.callInto(http.MethodGet, path, nil, &limits); err != nil {
+			return err
+		}
+		return printResult(w, format, &limits)
+	}
+	params := url.Values{}
+	for _, arg := range args[1:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || !limitKeys[kv[0]] {
+			return errUsage
+		}
+		params.Set(kv[0], kv[1])
+	}
+	if err := c.callInto(http.MethodPost, path, params, &limits); err != nil {
+		return err
+	}
+	if format == outputJson {
+		return printAction(w, format, fmt.Sprintf("room %s limits updated", args[0]), &limits)
+	}
+	return printResult(w, format, &limits)
+}
+
+func runAnnounce(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	params := url.Values{"message": {strings.Join(args[1:], " ")}}
+	if args[0] != "all" {
+		if _, err := strconv.ParseInt(args[0], 10, 64); err != nil {
+			return errUsage
+		}
+		params.Set("room", args[0])
+	}
+	var rooms int
+	if err := c.callInto(http.MethodPost, "/announce", params, &rooms); err != nil {
+		return err
+	}
+	return printAction(w, format, fmt.Sprintf("announced to %d room(s)", rooms), rooms)
+}
+
+func runBadword(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) != 1 || args[0] != "reload" {
+		return errUsage
+	}
+	var count int
+	if err := c.callInto(http.MethodPost, "/badword/reload", nil, &count); err != nil {
+		return err
+	}
+	return printAction(w, format, fmt.Sprintf("badword reloaded, %d words", count), count)
+}
+
+func runLog(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) == 0 || len(args) > 2 || args[0] != "level" {
+		return errUsage
+	}
+	var level string
+	if len(args) == 1 {
+		if err := c.callInto(http.MethodGet, "/log/level", nil, &level); err != nil {
+			return err
+		}
+		return printAction(w, format, level, level)
+	}
+	if err := c.callInto(http.MethodPost, "/log/level", url.Values{"level": {args[1]}}, &level); err != nil {
+		return err
+	}
+	return printAction(w, format, fmt.Sprintf("log level set to %s", level), level)
+}
+
+func runConfig(c *adminClient, format string, w io.Writer, args []string) error {
+	if len(args) != 1 || args[0] != "dump" {
+		return errUsage
+	}
+	var conf string
+	if err := c.callInto(http.MethodGet, "/config", nil, &conf); err != nil {
+		return err
+	}
+	return printResult(w, format, conf)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestServer(t *testing.T) (*adminClient, *[]string) {
+	var calls []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get(adminTokenHeader) != "secret" {
+			fmt.Fprint(w, `{"code":100005,"message":"admin token required"}`)
+			return
+		}
+		req.ParseForm()
+		calls = append(calls, req.Method+" "+req.URL.Path+" "+req.PostForm.Encode())
+		switch req.URL.Path {
+		case "/admin/rooms":
+			fmt.Fprint(w, `{"code":0,"data":[{"roomID":1,"members":2,"broadcastQueue":0}]}`)
+		case "/admin/sessions":
+			fmt.Fprint(w, `{"code":0,"data":[{"sessionID":7,"ip":"127.0.0.1:5000","userName":"bob","roomID":1,"queueDepth":1,"queueCap":256}]}`)
+		case "/admin/rooms/1/limits":
+			fmt.Fprint(w, `{"code":0,"data":{"slowMode":"10s","broadcastRate":50,"broadcastBurst":100,"policy":"queue","maxBacklog":1000,"backlog":3}}`)
+		case "/admin/announce":
+			fmt.Fprint(w, `{"code":0,"data":4}`)
+		default:
+			fmt.Fprint(w, `{"code":0}`)
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return newAdminClient(server.URL, "secret", time.Second), &calls
+}
+
+func TestRooms(t *testing.T) {
+	c, _ := newTestServer(t)
+	var out bytes.Buffer
+	require.NoError(t, runRooms(c, outputTable, &out, nil))
+	require.Equal(t, "ROOM  MEMBERS  BROADCAST_QUEUE\n1     2        0\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runRooms(c, outputJson, &out, nil))
+	require.JSONEq(t, `[{"roomID":1,"members":2,"broadcastQueue":0}]`, out.String())
+}
+
+func TestKickByName(t *testing.T) {
+	c, calls := newTestServer(t)
+	var out bytes.Buffer
+	require.NoError(t, runKick(c, outputTable, &out, []string{"bob", "spam", "links"}))
+	require.Equal(t, "session 7 kicked\n", out.String())
+	require.Equal(t, "POST /admin/sessions/7/kick reason=spam+links", (*calls)[len(*calls)-1])
+
+	require.Error(t, runKick(c, outputTable, &out, []string{"alice"}))
+	require.ErrorIs(t, runKick(c, outputTable, &out, nil), errUsage)
+}
+
+func TestAnnounceAndAuth(t *testing.T) {
+	c, calls := newTestServer(t)
+	var out bytes.Buffer
+	require.NoError(t, runAnnounce(c, outputJson, &out, []string{"all", "server", "restart"}))
+	require.JSONEq(t, `{"ok":true,"message":"announced to 4 room(s)","data":4}`, out.String())
+	require.Equal(t, "POST /admin/announce message=server+restart", (*calls)[0])
+
+	c.token = "bad"
+	err := runBadword(c, outputTable, &out, []string{"reload"})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "admin token required")
+}
+
+func TestLimits(t *testing.T) {
+	c, calls := newTestServer(t)
+	var out bytes.Buffer
+	require.NoError(t, runLimits(c, outputTable, &out, []string{"1"}))
+	require.Equal(t, "SLOW_MODE  RATE  BURST  POLICY  BACKLOG\n10s        50    100    queue   3/1000\n", out.String())
+	require.Equal(t, "GET /admin/rooms/1/limits ", (*calls)[0])
+
+	out.Reset()
+	require.NoError(t, runLimits(c, outputJson, &out, []string{"1", "slowMode=10s", "policy=queue"}))
+	require.Contains(t, out.String(), `"message": "room 1 limits updated"`)
+	require.Equal(t, "POST /admin/rooms/1/limits policy=queue&slowMode=10s", (*calls)[1])
+
+	require.ErrorIs(t, runLimits(c, outputTable, &out, []string{"1", "speed=1"}), errUsage)
+	require.ErrorIs(t, runLimits(c, outputTable, &out, []string{"all"}), errUsage)
+}
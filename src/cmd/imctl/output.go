@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+//输出格式
+const (
+	outputTable = "table"
+	outputJson  = "json"
+)
+
+//房间信息，对应 clientctl.RoomInfo
+type roomInfo struct {
+	RoomID         int64 `json:"roomID"`
+	Members        int64 `json:"members"`
+	BroadcastQueue int   `json:"broadcastQueue"`
+}
+
+//会话信息，对应 clientctl.SessionInfo
+type sessionInfo struct {
+	SessionID  int64  `json:"sessionID"`
+	IP         string `json:"ip"`
+	UserName   string `json:"userName"`
+	RoomID     int64  `json:"roomID"`
+	QueueDepth int    `json:"queueDepth"`
+	QueueCap   int    `json:"queueCap"`
+	LoginTime  int64  `json:"loginTime"`
+	MuteUntil  int64  `json:"muteUntil,omitempty"`
+}
+
+//房间发言限制，对应 clientctl.RoomLimitsInfo
+type roomLimits struct {
+	SlowMode       string  `json:"slowMode,omitempty"`
+	BroadcastRate  float64 `json:"broadcastRate,omitempty"`
+	BroadcastBurst int     `json:"broadcastBurst,omitempty"`
+	Policy         string  `json:"policy"`
+	MaxBacklog     int     `json:"maxBacklog"`
+	Backlog        int64   `json:"backlog"`
+}
+
+//表格输出的行
+type tableRows interface {
+	header() []string
+	rows() [][]string
+}
+
+type roomInfos []*roomInfo
+
+func (rs roomInfos) header() []string {
+	return []string{"ROOM", "MEMBERS", "BROADCAST_QUEUE"}
+}
+
+func (rs roomInfos) rows() [][]string {
+	rows := make([][]string, 0, len(rs))
+	for _, r := range rs {
+		rows = append(rows, []string{fmt.Sprint(r.RoomID), fmt.Sprint(r.Members), fmt.Sprint(r.BroadcastQueue)})
+	}
+	return rows
+}
+
+func (l *roomLimits) header() []string {
+	return []string{"SLOW_MODE", "RATE", "BURST", "POLICY", "BACKLOG"}
+}
+
+func (l *roomLimits) rows() [][]string {
+	slowMode, rate, burst := "-", "-", "-"
+	if l.SlowMode != "" {
+		slowMode = l.SlowMode
+	}
+	if l.BroadcastRate > 0 {
+		rate = fmt.Sprint(l.BroadcastRate)
+		burst = fmt.Sprint(l.BroadcastBurst)
+	}
+	return [][]string{{slowMode, rate, burst, l.Policy, fmt.Sprintf("%d/%d", l.Backlog, l.MaxBacklog)}}
+}
+
+type sessionInfos []*sessionInfo
+
+func (ss sessionInfos) header() []string {
+	return []string{"SESSION", "NAME", "ROOM", "IP", "QUEUE", "ONLINE", "MUTED"}
+}
+
+func (ss sessionInfos) rows() [][]string {
+	now := time.Now()
+	rows := make([][]string, 0, len(ss))
+	for _, s := range ss {
+		online, muted := "-", "-"
+		if s.LoginTime > 0 {
+			online = now.Sub(time.Unix(s.LoginTime, 0)).Truncate(time.Second).String()
+		}
+		if s.MuteUntil > 0 {
+			muted = time.Unix(s.MuteUntil, 0).Format("2006-01-02 15:04:05")
+		}
+		name := s.UserName
+		if name == "" {
+			name = "-"
+		}
+		rows = append(rows, []string{fmt.Sprint(s.SessionID), name, fmt.Sprint(s.RoomID), s.IP,
+			fmt.Sprintf("%d/%d", s.QueueDepth, s.QueueCap), online, muted})
+	}
+	return rows
+}
+
+//按输出格式打印结果 v:表格输出时为 tableRows 或普通值
+func printResult(w io.Writer, format string, v interface{}) error {
+	if format == outputJson {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	switch t := v.(type) {
+	case tableRows:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.header(), "\t"))
+		for _, row := range t.rows() {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case string:
+		_, err := fmt.Fprintln(w, strings.TrimRight(t, "\n"))
+		return err
+	default:
+		_, err := fmt.Fprintln(w, t)
+		return err
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/zxfonline/IMDemo/core/fileutil"
@@ -30,6 +31,157 @@ type Config struct {
 	LogLevel     string `yaml:"logLevel"`
 	LogFmt       string `yaml:"logFmt"`
 	HttpAddr     string `yaml:"httpAddr"`
+	//tcp长度前缀帧服务端口(为空不开启)
+	TcpAddr string `yaml:"tcpAddr"`
+	//tcp连接的读超时，客户端需要在超时前发送消息或回复心跳(为空使用30s)
+	TcpReadTimeout string `yaml:"tcpReadTimeout"`
+	//tcp连接的写超时(为空使用30s)
+	TcpWriteTimeout string `yaml:"tcpWriteTimeout"`
+	//tcp连接的心跳间隔(为空使用读超时的9/10)
+	TcpPingPeriod string `yaml:"tcpPingPeriod"`
+	//tcp连接在 tcpRpmInterval 内最多收到的帧数，超过断开连接(0与websocket相同，<0不限制)
+	TcpRpmLimit int `yaml:"tcpRpmLimit"`
+	//tcp连接收包频率的检测间隔(为空使用3s)
+	TcpRpmInterval string `yaml:"tcpRpmInterval"`
+
+	//热词分词器 sentence:整句 word:分词(默认)
+	HotTokenizer string `yaml:"hotTokenizer"`
+	//分词词典文件(为空则中日韩文字使用二元切分)
+	HotDictFile string `yaml:"hotDictFile"`
+	//停用词文件(为空则使用内置停用词)
+	HotStopwordFile string `yaml:"hotStopwordFile"`
+	//热词统计窗口(为空则使用默认窗口 1m,10m,1h,24h)
+	HotWindows []string `yaml:"hotWindows"`
+	//热词统计引擎 trie:记录全部热词(默认) spacesaving:固定内存只保留高频热词
+	HotEngine string `yaml:"hotEngine"`
+	//按房间号单独配置的热词统计引擎，未配置的房间使用 hotEngine
+	HotEngines map[int64]string `yaml:"hotEngines"`
+	//spacesaving 引擎每个房间最多保留的热词数量
+	HotCapacity int `yaml:"hotCapacity"`
+	//spacesaving 引擎淘汰热词时权重衰减的半衰期(为空则使用1h)
+	HotHalfLife string `yaml:"hotHalfLife"`
+	//热词趋势的最近统计窗口(为空则使用10m)
+	TrendingWindow string `yaml:"trendingWindow"`
+	//热词趋势最近窗口内的最少次数
+	TrendingMinCount int64 `yaml:"trendingMinCount"`
+	//热词趋势推送给房间成员的最低得分(<=0 不推送)
+	TrendingNotifyScore float64 `yaml:"trendingNotifyScore"`
+
+	//聊天消息链路的采样跟踪间隔，每个房间每N条消息跟踪一条(<=0 不跟踪)
+	ChatTraceSampling int64 `yaml:"chatTraceSampling"`
+	//房间活跃度快照的保存目录(为空不保存，重启后活跃度清零)
+	ActivitySnapshotDir string `yaml:"activitySnapshotDir"`
+
+	//管理接口和调试页面的访问令牌(为空则拒绝访问，除非开启 adminLocalOnly)
+	AdminToken string `yaml:"adminToken"`
+	//未配置 adminToken 时允许本机请求免令牌访问，服务部署在本机反向代理之后时不要开启
+	AdminLocalOnly bool `yaml:"adminLocalOnly"`
+	//机器人接口的API key和对应的机器人名字(为空则不开放机器人接口)
+	BotKeys map[string]string `yaml:"botKeys"`
+
+	//房间事件的webhook(为空不推送)
+	Webhooks []*WebhookConfig `yaml:"webhooks"`
+	//webhook待投递请求的落盘目录，房间事件产生快于落盘时会丢弃
+	WebhookSpoolDir string `yaml:"webhookSpoolDir"`
+	//webhook最多尝试次数，超过后写入死信文件(<=0 使用8次)
+	WebhookMaxAttempts int `yaml:"webhookMaxAttempts"`
+
+	//房间插件，按房间号配置
+	Plugins map[int64][]*PluginConfig `yaml:"plugins"`
+	//聊天消息处理管道，按房间号配置，房间号0为所有房间的默认管道(为空使用内置管道)
+	ChatPipelines map[int64][]*ChatStageConfig `yaml:"chatPipelines"`
+	//按请求限流，key为请求名 login,roomSwitch,roomChat,userSearch(未配置的请求不限流)
+	RateLimits map[string]*RateLimitConfig `yaml:"rateLimits"`
+	//房间发言限制，按房间号配置，房间号0为所有房间的默认值
+	RoomLimits map[int64]*RoomLimitConfig `yaml:"roomLimits"`
+	//垃圾消息检测(为空不检测)
+	Spam *SpamConfig `yaml:"spam"`
+}
+
+//插件配置
+type PluginConfig struct {
+	//插件名 greeter,dice,faq
+	Name string `yaml:"name"`
+	//插件发消息使用的机器人名字(为空使用插件名)
+	Bot string `yaml:"bot"`
+	//插件参数
+	Options map[string]string `yaml:"options"`
+}
+
+//令牌桶限流配置
+type RateLimitConfig struct {
+	//每秒补充的令牌数
+	Rate float64 `yaml:"rate"`
+	//桶容量，允许的突发请求数
+	Burst int `yaml:"burst"`
+}
+
+//房间发言限制配置
+type RoomLimitConfig struct {
+	//慢速模式，每个成员两次发言的最小间隔(为空不限制)
+	SlowMode string `yaml:"slowMode"`
+	//房间每秒最多广播的消息数(0不限制)
+	BroadcastRate float64 `yaml:"broadcastRate"`
+	//允许的突发广播数
+	BroadcastBurst int `yaml:"broadcastBurst"`
+	//超过广播上限时的策略 queue:排队(默认) reject:拒绝
+	Policy string `yaml:"policy"`
+	//排队的最大消息数
+	MaxBacklog int `yaml:"maxBacklog"`
+}
+
+//垃圾消息检测配置，各信号的得分为0时不检测该信号，其他参数为空使用默认值
+type SpamConfig struct {
+	//同一玩家重复发送相同消息 窗口(默认1m) 次数(默认3)
+	RepeatWindow string  `yaml:"repeatWindow"`
+	RepeatCount  int     `yaml:"repeatCount"`
+	RepeatScore  float64 `yaml:"repeatScore"`
+	//多个玩家发送相似消息 窗口(默认1m) 玩家数(默认3) 相似度(默认0.6) 参与比较的最少字数(默认8)
+	SwarmWindow     string  `yaml:"swarmWindow"`
+	SwarmUsers      int     `yaml:"swarmUsers"`
+	SwarmSimilarity float64 `yaml:"swarmSimilarity"`
+	SwarmMinLen     int     `yaml:"swarmMinLen"`
+	SwarmScore      float64 `yaml:"swarmScore"`
+	//链接 最多链接数(默认3) 链接字数占比(默认0.6)
+	MaxLinks  int     `yaml:"maxLinks"`
+	LinkRatio float64 `yaml:"linkRatio"`
+	LinkScore float64 `yaml:"linkScore"`
+	//大写字母 占比(默认0.7) 最少字母数(默认12)
+	CapsRatio      float64 `yaml:"capsRatio"`
+	CapsMinLetters int     `yaml:"capsMinLetters"`
+	CapsScore      float64 `yaml:"capsScore"`
+	//字符刷屏 同一字符连续次数(默认12) 表情符号数(默认10)
+	FloodRun   int     `yaml:"floodRun"`
+	FloodEmoji int     `yaml:"floodEmoji"`
+	FloodScore float64 `yaml:"floodScore"`
+	//新玩家刷屏 登录时长(默认1m) 窗口(默认10s) 最多发言数(默认5)
+	NewAge    string  `yaml:"newAge"`
+	NewWindow string  `yaml:"newWindow"`
+	NewBurst  int     `yaml:"newBurst"`
+	NewScore  float64 `yaml:"newScore"`
+	//处理动作的最低得分，key为动作 warn:警告 drop:丢弃 mute:禁言 kick:踢下线，得分满足多个动作时执行最严厉的
+	Actions map[string]float64 `yaml:"actions"`
+	//mute 动作的禁言时长(默认10m)
+	MuteDuration string `yaml:"muteDuration"`
+}
+
+//聊天消息处理阶段配置
+type ChatStageConfig struct {
+	//阶段名 validate,roomlimit,length,normalize,spam,badword,enrich,roomadmit,route
+	Name string `yaml:"name"`
+	//阶段参数
+	Options map[string]string `yaml:"options"`
+}
+
+//webhook配置
+type WebhookConfig struct {
+	URL string `yaml:"url"`
+	//签名密钥(为空不签名)
+	Secret string `yaml:"secret"`
+	//推送的房间(为空则全部房间)
+	Rooms []int64 `yaml:"rooms"`
+	//推送的事件 message,join,leave,announce,badword,kick,mute,move(为空则全部事件)
+	Events []string `yaml:"events"`
 }
 
 var (
@@ -47,8 +199,12 @@ func GetConfig() *Config {
 
 // init the Conf
 func init() {
-	flag.Parse()
 	rand.Seed(time.Now().UnixNano())
+}
+
+//Load 解析命令行参数并加载启动配置，进程启动时首先调用，测试直接设置 Conf
+func Load() {
+	flag.Parse()
 	if len(*_config_file) == 0 {
 		if fullPath, err := fileutil.FindFullFilePath("runtime/config.yml"); err == nil {
 			*_config_file = fullPath
@@ -71,7 +227,39 @@ func init() {
 		panic(err)
 	}
 	initLogger()
+}
 
+//导出启动配置，隐藏访问令牌
+func DumpConfig() ([]byte, error) {
+	conf := Conf
+	if conf.AdminToken != "" {
+		conf.AdminToken = "******"
+	}
+	if len(conf.BotKeys) > 0 {
+		//不输出key的任何部分，按key排序编号保证多次导出一致
+		botKeys := make([]string, 0, len(conf.BotKeys))
+		for key := range conf.BotKeys {
+			botKeys = append(botKeys, key)
+		}
+		sort.Strings(botKeys)
+		keys := make(map[string]string, len(botKeys))
+		for i, key := range botKeys {
+			keys[fmt.Sprintf("******%d", i+1)] = conf.BotKeys[key]
+		}
+		conf.BotKeys = keys
+	}
+	if len(conf.Webhooks) > 0 {
+		hooks := make([]*WebhookConfig, 0, len(conf.Webhooks))
+		for _, hook := range conf.Webhooks {
+			redacted := *hook
+			if redacted.Secret != "" {
+				redacted.Secret = "******"
+			}
+			hooks = append(hooks, &redacted)
+		}
+		conf.Webhooks = hooks
+	}
+	return yaml.Marshal(&conf)
 }
 
 func checkConfig() error {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -43,3 +44,18 @@ func initLogger() {
 	//add log hook
 	baselog.Logger.AddHook(newFileCallerHook())
 }
+
+//运行时修改日志等级
+func SetLogLevel(level string) error {
+	l, ok := logLevels[level]
+	if !ok {
+		return fmt.Errorf("unsupport log level:%s", level)
+	}
+	baselog.Logger.SetLevel(l)
+	return nil
+}
+
+//当前的日志等级
+func LogLevel() string {
+	return baselog.Logger.GetLevel().String()
+}
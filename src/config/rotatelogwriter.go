@@ -4,12 +4,13 @@ import "github.com/sirupsen/logrus"
 
 var (
 	logLevels = map[string]logrus.Level{
-		"trace": logrus.TraceLevel,
-		"debug": logrus.DebugLevel,
-		"info":  logrus.InfoLevel,
-		"warn":  logrus.WarnLevel,
-		"error": logrus.ErrorLevel,
-		"fatal": logrus.FatalLevel,
-		"panic": logrus.PanicLevel,
+		"trace":   logrus.TraceLevel,
+		"debug":   logrus.DebugLevel,
+		"info":    logrus.InfoLevel,
+		"warn":    logrus.WarnLevel,
+		"warning": logrus.WarnLevel,
+		"error":   logrus.ErrorLevel,
+		"fatal":   logrus.FatalLevel,
+		"panic":   logrus.PanicLevel,
 	}
 )
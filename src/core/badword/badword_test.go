@@ -1,8 +1,31 @@
 package badword
 
-import "testing"
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestBadword(t *testing.T) {
+	_, err := Reload(DefaultWordFile)
+	require.NoError(t, err)
 	t.Log(BadWordSearch("you mother fucker"))
 	t.Log(BadWordReplace("you mother fucker"))
 }
+
+func TestReload(t *testing.T) {
+	defer Reload(DefaultWordFile)
+	file := filepath.Join(t.TempDir(), "badword.txt")
+	require.NoError(t, ioutil.WriteFile(file, []byte("golang\n\nrust\n"), 0644))
+	count, err := Reload(file)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, "i like ******", BadWordReplace("i like golang"))
+
+	//加载失败保留原有的关键字
+	_, err = Reload(filepath.Join(t.TempDir(), "none.txt"))
+	require.Error(t, err)
+	require.True(t, BadWordSearch("rust is fine"))
+}
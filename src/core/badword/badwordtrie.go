@@ -4,43 +4,76 @@ import (
 	"bufio"
 	"io"
 	"os"
+	"sync/atomic"
 	"unicode/utf8"
 
 	"github.com/zxfonline/IMDemo/core/fileutil"
 )
 
-var _G *BadWordTrie
+//脏字库文件
+const DefaultWordFile = "runtime/badword.txt"
 
+//全局关键字 *BadWordTrie，重新加载时整体替换
+var _G atomic.Value
+
+//启动时由 setup 加载脏字库文件，之前为空
 func init() {
-	_G = NewBadWordTrie()
-	fi, err := fileutil.FindFile("runtime/badword.txt", os.O_RDONLY, 0)
+	_G.Store(NewBadWordTrie())
+}
+
+//按行读取脏字库文件，返回脏字数量
+func LoadWordFile(name string) (*BadWordTrie, int, error) {
+	fi, err := fileutil.FindFile(name, os.O_RDONLY, 0)
 	if err != nil {
-		panic(err)
+		return nil, 0, err
 	}
 	defer fi.Close()
+	bt := NewBadWordTrie()
+	count := 0
 	br := bufio.NewReader(fi)
 	for {
 		a, _, c := br.ReadLine()
 		if c == io.EOF {
 			break
+		} else if c != nil {
+			return nil, 0, c
 		}
-		_G.Add(string(a))
+		if len(a) == 0 {
+			continue
+		}
+		bt.Add(string(a))
+		count++
+	}
+	return bt, count, nil
+}
+
+//重新加载脏字库文件，加载失败保留原有的关键字
+func Reload(name string) (int, error) {
+	bt, count, err := LoadWordFile(name)
+	if err != nil {
+		return 0, err
 	}
+	BadWordGolbal(bt)
+	return count, nil
+}
+
+func global() *BadWordTrie {
+	return _G.Load().(*BadWordTrie)
 }
 
 //关键字查询
 func BadWordSearch(str string) bool {
-	return _G.Search(str)
+	return global().Search(str)
 }
 
 //关键字替换
 func BadWordReplace(str string) string {
-	return _G.Replace(str)
+	return global().Replace(str)
 }
 
 //设置全局关键字
 func BadWordGolbal(key *BadWordTrie) {
-	_G = key
+	_G.Store(key)
 }
 
 type BadWordTrie struct {
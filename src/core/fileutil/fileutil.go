@@ -199,3 +199,23 @@ func PathJoin(dir, filename string) string {
 func TransPath(path string) string {
 	return strings.Replace(filepath.Clean(path), "\\", "/", -1)
 }
+
+//WriteFileAtomic 先写入临时文件再替换，避免进程退出时留下写了一半的文件，目录不存在则创建
+func WriteFileAtomic(pathfile string, data []byte, filemode os.FileMode) error {
+	tmp := pathfile + ".tmp"
+	fi, err := OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filemode)
+	if err != nil {
+		return err
+	}
+	if _, err = fi.Write(data); err == nil {
+		err = fi.Sync()
+	}
+	if cerr := fi.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, pathfile)
+}
@@ -373,3 +373,54 @@ func distTmpl() *template.Template {
 	})
 	return distTmplCache
 }
+
+// Histogram is a histogram of int64 measurements that is safe for
+// concurrent use. It shares the power of 2 bucketing of the histograms
+// collected by traces so that it can be exported to external monitoring
+// systems.
+type Histogram struct {
+	mu sync.Mutex
+	h  histogram
+}
+
+// NewHistogram returns an empty Histogram.
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+// Observe records a value measurement observation to the histogram.
+func (h *Histogram) Observe(value int64) {
+	if value < 0 {
+		value = 0
+	}
+	h.mu.Lock()
+	h.h.addMeasurement(value)
+	h.mu.Unlock()
+}
+
+// Snapshot returns the count of observations in each bucket, the total
+// number of observations and their sum.
+// Bucket i holds the values less than HistogramBucketUpperBound(i).
+func (h *Histogram) Snapshot() (buckets []int64, count, sum int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets = make([]int64, bucketCount)
+	if h.h.valueCount > 0 {
+		buckets[h.h.value] = h.h.valueCount
+	} else {
+		copy(buckets, h.h.buckets)
+	}
+	return buckets, h.h.total(), h.h.sum
+}
+
+// HistogramBuckets is the number of buckets returned by Histogram.Snapshot.
+const HistogramBuckets = bucketCount
+
+// HistogramBucketUpperBound returns the exclusive upper bound of the values
+// in bucket i, the last bucket is unbounded and returns math.MaxInt64.
+func HistogramBucketUpperBound(i int) int64 {
+	if i >= bucketCount-1 {
+		return math.MaxInt64
+	}
+	return bucketBoundary(uint8(i + 1))
+}
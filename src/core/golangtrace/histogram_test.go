@@ -323,3 +323,28 @@ func add(h *histogram, times int, val int64) {
 func isApproximate(x, y float64) bool {
 	return math.Abs(x-y) < 1e-2
 }
+
+func TestHistogramSnapshot(t *testing.T) {
+	h := NewHistogram()
+	for _, v := range []int64{1, 1, 3, 100, -5} {
+		h.Observe(v)
+	}
+	buckets, count, sum := h.Snapshot()
+	if count != 5 || sum != 105 {
+		t.Errorf("got count %d sum %d, want 5 105", count, sum)
+	}
+	if len(buckets) != HistogramBuckets {
+		t.Fatalf("got %d buckets, want %d", len(buckets), HistogramBuckets)
+	}
+	for i, want := range map[int]int64{0: 3, 1: 1, 6: 1} {
+		if buckets[i] != want {
+			t.Errorf("bucket %d: got %d, want %d", i, buckets[i], want)
+		}
+		if i == 6 && HistogramBucketUpperBound(i) != 128 {
+			t.Errorf("bucket 6 upper bound: got %d, want 128", HistogramBucketUpperBound(i))
+		}
+	}
+	if HistogramBucketUpperBound(HistogramBuckets-1) != math.MaxInt64 {
+		t.Errorf("last bucket should be unbounded")
+	}
+}
@@ -0,0 +1,68 @@
+package timeseries
+
+import (
+	"fmt"
+	"time"
+)
+
+// LevelSnapshot holds the buckets of one level, oldest first.
+type LevelSnapshot struct {
+	Resolution time.Duration `json:"resolution"`
+	End        time.Time     `json:"end"`
+	Values     []float64     `json:"values"`
+}
+
+// Snapshot is a serializable copy of a time series.
+type Snapshot struct {
+	LastAdd time.Time       `json:"lastAdd"`
+	Total   float64         `json:"total"`
+	Levels  []LevelSnapshot `json:"levels"`
+}
+
+// Export returns a snapshot of the time series, using value to convert
+// each bucketed Observable to a float64.
+func (ts *timeSeries) Export(value func(Observable) float64) *Snapshot {
+	ts.mergePendingUpdates()
+	s := &Snapshot{LastAdd: ts.lastAdd, Total: value(ts.total)}
+	for _, l := range ts.levels {
+		ls := LevelSnapshot{Resolution: l.size, End: l.end, Values: make([]float64, ts.numBuckets)}
+		for i := range ls.Values {
+			if b := l.buckets[(l.oldest+i)%ts.numBuckets]; b != nil {
+				ls.Values[i] = value(b)
+			}
+		}
+		s.Levels = append(s.Levels, ls)
+	}
+	return s
+}
+
+// Import replaces the observations of the time series with the snapshot,
+// using observable to convert each value back to an Observable.
+// The snapshot must have been exported from a time series with the same
+// resolutions and number of buckets.
+func (ts *timeSeries) Import(s *Snapshot, observable func(float64) Observable) error {
+	if len(s.Levels) != len(ts.levels) {
+		return fmt.Errorf("timeseries: snapshot has %d levels, want %d", len(s.Levels), len(ts.levels))
+	}
+	for i, ls := range s.Levels {
+		if ls.Resolution != ts.levels[i].size || len(ls.Values) != ts.numBuckets {
+			return fmt.Errorf("timeseries: snapshot level %d is %d buckets of %s, want %d buckets of %s",
+				i, len(ls.Values), ls.Resolution, ts.numBuckets, ts.levels[i].size)
+		}
+	}
+	ts.Clear()
+	ts.lastAdd = s.LastAdd
+	ts.total = observable(s.Total)
+	for i, ls := range s.Levels {
+		l := ts.levels[i]
+		l.end = ls.End
+		l.oldest = 0
+		l.newest = ts.numBuckets - 1
+		for j, v := range ls.Values {
+			if v != 0 {
+				l.buckets[j] = observable(v)
+			}
+		}
+	}
+	return nil
+}
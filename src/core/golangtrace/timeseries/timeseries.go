@@ -484,6 +484,17 @@ func NewTimeSeriesWithClock(f func() Observable, clock Clock) *TimeSeries {
 	return ts
 }
 
+// NewTimeSeriesWithResolutions creates a new TimeSeries tracking data at the given resolutions,
+// each level keeping numBuckets buckets. Resolutions must be monotonically increasing.
+func NewTimeSeriesWithResolutions(f func() Observable, resolutions []time.Duration, numBuckets int, clock Clock) *TimeSeries {
+	if clock == nil {
+		clock = defaultClockInstance
+	}
+	ts := new(TimeSeries)
+	ts.timeSeries.init(resolutions, f, numBuckets, clock)
+	return ts
+}
+
 // MinuteHourSeries tracks data at granularities of 1 minute and 1 hour.
 type MinuteHourSeries struct {
 	timeSeries
@@ -168,3 +168,39 @@ func min(a, b float64) float64 {
 	}
 	return b
 }
+
+func TestExportImport(t *testing.T) {
+	resolutions := []time.Duration{time.Minute, time.Hour}
+	ts := NewTimeSeriesWithResolutions(NewFloat, resolutions, 10, nil)
+	fo := new(Float)
+	*fo = Float(1)
+	for i := int64(0); i < 5; i++ {
+		ts.AddWithTime(fo, tu(i*60))
+	}
+	value := func(o Observable) float64 { return o.(*Float).Value() }
+	observable := func(v float64) Observable {
+		f := Float(v)
+		return &f
+	}
+	s := ts.Export(value)
+
+	restored := NewTimeSeriesWithResolutions(NewFloat, resolutions, 10, nil)
+	if err := restored.Import(s, observable); err != nil {
+		t.Fatal(err)
+	}
+	checkApproximate(t, restored.Total(), 5)
+	// Observations added after the import match the original series.
+	ts.AddWithTime(fo, tu(301))
+	restored.AddWithTime(fo, tu(301))
+	ts.AddWithTime(fo, tu(900))
+	restored.AddWithTime(fo, tu(900))
+	for _, r := range [][2]int64{{0, 180}, {0, 360}, {120, 960}, {0, 3600}} {
+		checkApproximate(t, restored.Range(tu(r[0]), tu(r[1])), ts.Range(tu(r[0]), tu(r[1])).(*Float).Value())
+	}
+	checkApproximate(t, restored.Total(), 7)
+
+	other := NewTimeSeriesWithResolutions(NewFloat, []time.Duration{time.Minute}, 10, nil)
+	if err := other.Import(s, observable); err == nil {
+		t.Error("Import should fail when the resolutions differ")
+	}
+}
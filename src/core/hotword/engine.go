@@ -0,0 +1,86 @@
+package hotword
+
+import (
+	"fmt"
+	"time"
+)
+
+//热词统计引擎
+type Engine interface {
+	//添加记录
+	Add(words string)
+	AddWithTime(words string, timeUnix int64)
+	//清理outTimeUnix以前的过期记录
+	OnTimeout(outTimeUnix int64)
+	//统计窗口内前x的热门，window 为空则使用默认统计窗口
+	HotTopX(topX int, window ...time.Duration) []*HotWord
+	//趋势上升最快的前x个热词
+	TrendingTopX(topX int, recent time.Duration, minCount int64) []*HotWord
+	//以prefix开头的前x个热词，window 为空则使用默认统计窗口
+	SuggestTopX(prefix string, topX int, window ...time.Duration) []*HotWord
+	//统计窗口列表
+	Windows() []time.Duration
+	//默认统计窗口
+	DefaultWindow() time.Duration
+	//最大统计窗口
+	MaxWindow() time.Duration
+}
+
+var (
+	_ Engine = (*TimeTrie)(nil)
+	_ Engine = (*SpaceSaving)(nil)
+)
+
+//合并多个热词列表中相同热词的次数，返回前x的热门
+func MergeTopX(topX int, lists ...[]*HotWord) []*HotWord {
+	counts := make(map[string]int64)
+	for _, hots := range lists {
+		for _, hw := range hots {
+			counts[hw.Word] += hw.Count
+		}
+	}
+	txInfo := NewTopKInfo(topX, nil)
+	for word, count := range counts {
+		txInfo.Add(&HotWord{Word: word, Count: count})
+	}
+	return txInfo.popAll()
+}
+
+//房间使用的热词统计引擎，默认使用 TimeTrie
+var _E = func() Engine {
+	return NewTimeTrie()
+}
+
+//按名字注册的热词统计引擎
+var _engines = map[string]func() Engine{
+	"trie": func() Engine {
+		return NewTimeTrie()
+	},
+}
+
+//创建热词统计引擎
+func NewEngine() Engine {
+	return _E()
+}
+
+//设置创建默认热词统计引擎的方法
+func SetEngine(f func() Engine) {
+	_E = f
+}
+
+//注册热词统计引擎，重名时覆盖
+func RegisterEngine(name string, f func() Engine) {
+	_engines[name] = f
+}
+
+//按名字创建热词统计引擎，name 为空则创建默认引擎
+func NewEngineByName(name string) (Engine, error) {
+	if name == "" {
+		return NewEngine(), nil
+	}
+	f := _engines[name]
+	if f == nil {
+		return nil, fmt.Errorf("unsupport hot engine:%s", name)
+	}
+	return f(), nil
+}
@@ -2,14 +2,23 @@ package hotword
 
 import "container/heap"
 
+//热词及其在统计窗口内的次数
+type HotWord struct {
+	Word  string `json:"word"`
+	Count int64  `json:"count"`
+	//趋势得分，按得分排序时有效
+	Score float64 `json:"score,omitempty"`
+	node  *TimeTrie
+}
+
 type TopKInfo struct {
 	k       int
-	MinHeap TimeTrieHeap
+	MinHeap HotWordHeap
 }
 
 //前k数据 小顶堆
-func NewTopKInfo(k int, nums []*TimeTrie) *TopKInfo {
-	h := TimeTrieHeap(nums)
+func NewTopKInfo(k int, nums []*HotWord) *TopKInfo {
+	h := HotWordHeap(nums)
 	heap.Init(&h)
 
 	for len(h) > k {
@@ -22,7 +31,7 @@ func NewTopKInfo(k int, nums []*TimeTrie) *TopKInfo {
 	}
 }
 
-func (t *TopKInfo) Add(val *TimeTrie) *TimeTrie {
+func (t *TopKInfo) Add(val *HotWord) *HotWord {
 	heap.Push(&t.MinHeap, val)
 	if len(t.MinHeap) > t.k {
 		heap.Pop(&t.MinHeap)
@@ -30,17 +39,40 @@ func (t *TopKInfo) Add(val *TimeTrie) *TimeTrie {
 	return t.MinHeap[0]
 }
 
-type TimeTrieHeap []*TimeTrie
+//弹出全部数据 按从大到小排序
+func (t *TopKInfo) popAll() []*HotWord {
+	hotestX := make([]*HotWord, t.MinHeap.Len())
+	for i := len(hotestX) - 1; i >= 0; i-- {
+		hw := heap.Pop(&t.MinHeap).(*HotWord)
+		if hw.node != nil {
+			hw.Word = hw.node.printFullTxt()
+			hw.node = nil
+		}
+		hotestX[i] = hw
+	}
+	return hotestX
+}
+
+type HotWordHeap []*HotWord
 
-func (h TimeTrieHeap) Len() int           { return len(h) }
-func (h TimeTrieHeap) Less(i, j int) bool { return len(h[i].recordTss) < len(h[j].recordTss) }
-func (h TimeTrieHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h HotWordHeap) Len() int { return len(h) }
+func (h HotWordHeap) Less(i, j int) bool {
+	if h[i].Score != h[j].Score {
+		return h[i].Score < h[j].Score
+	}
+	if h[i].Count != h[j].Count {
+		return h[i].Count < h[j].Count
+	}
+	//次数相同时按字典序排在前面的热词更大，保证结果稳定
+	return h[i].Word > h[j].Word
+}
+func (h HotWordHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
 
-func (h *TimeTrieHeap) Push(x interface{}) {
-	*h = append(*h, x.(*TimeTrie))
+func (h *HotWordHeap) Push(x interface{}) {
+	*h = append(*h, x.(*HotWord))
 }
 
-func (h *TimeTrieHeap) Pop() interface{} {
+func (h *HotWordHeap) Pop() interface{} {
 	old := *h
 	n := len(old)
 	x := old[n-1]
@@ -0,0 +1,203 @@
+/*
+	基于 Space-Saving 算法的热词统计，内存占用由容量固定
+	容量满后淘汰衰减权重最小的热词，新词继承被淘汰热词的权重，各统计窗口的次数使用时间分桶计数
+*/
+package hotword
+
+import (
+	"container/heap"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/golangtrace/timeseries"
+)
+
+//权重衰减的默认半衰期
+const DefaultHalfLife = time.Hour
+
+type SpaceSaving struct {
+	*windowOptions
+	//最多监控的热词数量
+	capacity int
+	//权重衰减的半衰期 s
+	halfLife float64
+	//权重衰减的基准时间戳
+	landmark int64
+	items    map[string]*ssItem
+	minHeap  ssHeap
+}
+
+type ssItem struct {
+	word string
+	//相对landmark前向衰减的权重
+	weight float64
+	series *timeseries.TimeSeries
+	lastTs int64
+	index  int
+}
+
+func NewSpaceSaving(capacity int, halfLife time.Duration, windows ...time.Duration) *SpaceSaving {
+	return NewSpaceSavingWithClock(nil, capacity, halfLife, windows...)
+}
+
+//windows 为空则使用默认统计窗口
+func NewSpaceSavingWithClock(clock timeseries.Clock, capacity int, halfLife time.Duration, windows ...time.Duration) *SpaceSaving {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	if halfLife <= 0 {
+		halfLife = DefaultHalfLife
+	}
+	return &SpaceSaving{
+		windowOptions: newWindowOptions(clock, windows),
+		capacity:      capacity,
+		halfLife:      halfLife.Seconds(),
+		items:         make(map[string]*ssItem, capacity),
+		minHeap:       make(ssHeap, 0, capacity),
+	}
+}
+
+//添加记录
+func (ss *SpaceSaving) Add(words string) {
+	ss.AddWithTime(words, time.Now().Unix())
+}
+
+//添加记录
+func (ss *SpaceSaving) AddWithTime(words string, timeUnix int64) {
+	if ss.landmark == 0 {
+		ss.landmark = timeUnix
+	}
+	weight := ss.decay(timeUnix)
+	item := ss.items[words]
+	if item != nil {
+		item.weight += weight
+		heap.Fix(&ss.minHeap, item.index)
+	} else if len(ss.minHeap) < ss.capacity {
+		item = &ssItem{word: words, weight: weight, series: ss.newSeries()}
+		ss.items[words] = item
+		heap.Push(&ss.minHeap, item)
+	} else {
+		//淘汰权重最小的热词，复用其空间
+		item = ss.minHeap[0]
+		delete(ss.items, item.word)
+		item.word = words
+		item.weight += weight
+		item.series.Clear()
+		item.lastTs = 0
+		ss.items[words] = item
+		heap.Fix(&ss.minHeap, item.index)
+	}
+	one := timeseries.Float(1)
+	item.series.AddWithTime(&one, time.Unix(timeUnix, 0))
+	if timeUnix > item.lastTs {
+		item.lastTs = timeUnix
+	}
+}
+
+//一次记录在timeUnix时刻相对landmark的前向衰减权重
+func (ss *SpaceSaving) decay(timeUnix int64) float64 {
+	return math.Exp2(float64(timeUnix-ss.landmark) / ss.halfLife)
+}
+
+//清理过期的记录数据，并重置衰减基准时间避免权重溢出
+//outTimeUnix 清理缓存的过期数据时间戳
+func (ss *SpaceSaving) OnTimeout(outTimeUnix int64) {
+	var outs []*ssItem
+	for _, item := range ss.minHeap {
+		if item.lastTs < outTimeUnix {
+			outs = append(outs, item)
+		}
+	}
+	for _, item := range outs {
+		delete(ss.items, item.word)
+		heap.Remove(&ss.minHeap, item.index)
+	}
+	if now := ss.clockTime().Unix(); ss.landmark > 0 && float64(now-ss.landmark) > ss.halfLife*32 {
+		scale := 1 / ss.decay(now)
+		for _, item := range ss.minHeap {
+			item.weight *= scale
+		}
+		ss.landmark = now
+	}
+}
+
+//当前监控的热词数量
+func (ss *SpaceSaving) Len() int {
+	return len(ss.minHeap)
+}
+
+// 统计当前缓存前x的热门
+// window 统计窗口，为空则使用默认统计窗口
+func (ss *SpaceSaving) HotTopX(topX int, window ...time.Duration) []*HotWord {
+	w := ss.DefaultWindow()
+	if len(window) > 0 {
+		w = window[0]
+	}
+	txInfo := NewTopKInfo(topX, nil)
+	for _, item := range ss.minHeap {
+		if count := seriesPoints(item.series, w); count > 0 {
+			txInfo.Add(&HotWord{Word: item.word, Count: count})
+		}
+	}
+	return txInfo.popAll()
+}
+
+// 以prefix开头的前x个热词
+// window 统计窗口，为空则使用默认统计窗口
+func (ss *SpaceSaving) SuggestTopX(prefix string, topX int, window ...time.Duration) []*HotWord {
+	w := ss.DefaultWindow()
+	if len(window) > 0 {
+		w = window[0]
+	}
+	txInfo := NewTopKInfo(topX, nil)
+	for _, item := range ss.minHeap {
+		if !strings.HasPrefix(item.word, prefix) {
+			continue
+		}
+		if count := seriesPoints(item.series, w); count > 0 {
+			txInfo.Add(&HotWord{Word: item.word, Count: count})
+		}
+	}
+	return txInfo.popAll()
+}
+
+// 统计趋势上升最快的前x个热词
+// recent 最近的统计窗口，以最大统计窗口作为基线
+// minCount 最近窗口内的最少次数，避免偶然出现的词语上榜
+func (ss *SpaceSaving) TrendingTopX(topX int, recent time.Duration, minCount int64) []*HotWord {
+	baseline := ss.MaxWindow()
+	txInfo := NewTopKInfo(topX, nil)
+	for _, item := range ss.minHeap {
+		if count := seriesPoints(item.series, recent); count > 0 && count >= minCount {
+			score := TrendingScore(count, seriesPoints(item.series, baseline), recent, baseline)
+			txInfo.Add(&HotWord{Word: item.word, Count: count, Score: score})
+		}
+	}
+	return txInfo.popAll()
+}
+
+type ssHeap []*ssItem
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].weight < h[j].weight }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ssHeap) Push(x interface{}) {
+	item := x.(*ssItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *ssHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[0 : n-1]
+	return x
+}
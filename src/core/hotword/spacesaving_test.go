@@ -0,0 +1,68 @@
+package hotword
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SpaceSaving_BoundedMemory(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	ss := NewSpaceSavingWithClock(clock, 100, time.Hour, time.Minute, 10*time.Minute)
+	now := clock.now.Unix()
+	for i := 0; i < 10000; i++ {
+		//机器人刷屏的随机字符串
+		ss.AddWithTime(fmt.Sprintf("spam%d", i), now-60)
+		if i%20 == 0 {
+			ss.AddWithTime("hello", now-60)
+		}
+		if i%50 == 0 {
+			ss.AddWithTime("world", now)
+		}
+	}
+	require.Equal(t, 100, ss.Len())
+	require.Len(t, ss.items, 100)
+
+	hots := ss.HotTopX(2, 10*time.Minute)
+	require.Equal(t, []*HotWord{{Word: "hello", Count: 500}, {Word: "world", Count: 200}}, hots)
+	require.Equal(t, []*HotWord{{Word: "world", Count: 200}}, ss.HotTopX(1, time.Minute))
+}
+
+func Test_SpaceSaving_OnTimeout(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	ss := NewSpaceSavingWithClock(clock, 10, time.Minute)
+	now := clock.now.Unix()
+	for i := int64(0); i < 10; i++ {
+		ss.AddWithTime(fmt.Sprintf("w%d", i), now-i*60)
+	}
+	ss.OnTimeout(now - 5*60)
+	require.Equal(t, 6, ss.Len())
+	for i := 0; i < 6; i++ {
+		ss.AddWithTime("hot", now)
+	}
+	//权重重置后依然保持排序
+	clock.now = clock.now.Add(48 * time.Hour)
+	ss.OnTimeout(now - 5*60)
+	require.Equal(t, now+48*3600, ss.landmark)
+	require.Equal(t, "hot", ss.minHeap[len(ss.minHeap)-1].word)
+	require.Equal(t, "w5", ss.minHeap[0].word)
+}
+
+func TestNewEngineByName(t *testing.T) {
+	RegisterEngine("spacesaving", func() Engine {
+		return NewSpaceSaving(10, time.Hour)
+	})
+	engine, err := NewEngineByName("spacesaving")
+	require.NoError(t, err)
+	require.IsType(t, &SpaceSaving{}, engine)
+	engine, err = NewEngineByName("trie")
+	require.NoError(t, err)
+	require.IsType(t, &TimeTrie{}, engine)
+	engine, err = NewEngineByName("")
+	require.NoError(t, err)
+	require.NotNil(t, engine)
+	_, err = NewEngineByName("none")
+	require.Error(t, err)
+}
@@ -4,9 +4,12 @@
 package hotword
 
 import (
-	"container/heap"
+	"math"
+	"sort"
 	"strings"
 	"time"
+
+	"github.com/zxfonline/IMDemo/core/golangtrace/timeseries"
 )
 
 //默认空间
@@ -15,17 +18,105 @@ const INITCAP = 8
 //有效时长 s
 const ValidSeconds = 60 * 10
 
+//每个统计窗口切分的时间桶数量
+const WindowBuckets = 12
+
+//默认的统计窗口
+var DefaultWindows = []time.Duration{time.Minute, ValidSeconds * time.Second, time.Hour, 24 * time.Hour}
+
+//设置默认的统计窗口
+func SetDefaultWindows(windows ...time.Duration) {
+	DefaultWindows = windows
+}
+
 type TimeTrie struct {
 	key    rune
 	next   map[rune]*TimeTrie
 	parent *TimeTrie
-	//关键词录入的时间戳列表
+	//各统计窗口的计数，为空表示不是完整的关键词
+	counts *wordCounts
+	//最后一次录入的时间戳
 	//方便定时器清理过期的统计
-	recordTss []int64
+	lastTs int64
+	//根节点的统计窗口配置
+	*windowOptions
+}
+
+type windowOptions struct {
+	windows     []time.Duration
+	resolutions []time.Duration
+	clock       timeseries.Clock
+}
+
+func NewTimeTrie(windows ...time.Duration) *TimeTrie {
+	return NewTimeTrieWithClock(nil, windows...)
+}
+
+//windows 为空则使用默认统计窗口
+func NewTimeTrieWithClock(clock timeseries.Clock, windows ...time.Duration) *TimeTrie {
+	return &TimeTrie{next: make(map[rune]*TimeTrie, INITCAP), windowOptions: newWindowOptions(clock, windows)}
+}
+
+func newWindowOptions(clock timeseries.Clock, windows []time.Duration) *windowOptions {
+	if len(windows) == 0 {
+		windows = DefaultWindows
+	}
+	ws := append([]time.Duration(nil), windows...)
+	sort.Slice(ws, func(i, j int) bool { return ws[i] < ws[j] })
+	opts := &windowOptions{clock: clock}
+	for _, w := range ws {
+		if len(opts.windows) > 0 && opts.windows[len(opts.windows)-1] == w {
+			continue
+		}
+		opts.windows = append(opts.windows, w)
+		opts.resolutions = append(opts.resolutions, w/WindowBuckets)
+	}
+	return opts
+}
+
+//统计窗口列表
+func (opts *windowOptions) Windows() []time.Duration {
+	return opts.windows
+}
+
+//最大的统计窗口
+func (opts *windowOptions) MaxWindow() time.Duration {
+	return opts.windows[len(opts.windows)-1]
+}
+
+//是否是支持的统计窗口
+func (opts *windowOptions) HasWindow(window time.Duration) bool {
+	for _, w := range opts.windows {
+		if w == window {
+			return true
+		}
+	}
+	return false
 }
 
-func NewTimeTrie() *TimeTrie {
-	return &TimeTrie{next: make(map[rune]*TimeTrie, INITCAP)}
+//默认的统计窗口，没有配置ValidSeconds窗口时使用最小的窗口
+func (opts *windowOptions) DefaultWindow() time.Duration {
+	if opts.HasWindow(ValidSeconds * time.Second) {
+		return ValidSeconds * time.Second
+	}
+	return opts.windows[0]
+}
+
+func (opts *windowOptions) clockTime() time.Time {
+	if opts.clock == nil {
+		return time.Now()
+	}
+	return opts.clock.Time()
+}
+
+//创建分桶计数
+func (opts *windowOptions) newSeries() *timeseries.TimeSeries {
+	return timeseries.NewTimeSeriesWithResolutions(timeseries.NewFloat, opts.resolutions, WindowBuckets, opts.clock)
+}
+
+//分桶计数在统计窗口内的次数
+func seriesPoints(series *timeseries.TimeSeries, window time.Duration) int64 {
+	return int64(math.Round(series.Recent(window).(*timeseries.Float).Value()))
 }
 
 //添加记录
@@ -35,16 +126,23 @@ func (t *TimeTrie) Add(words string) {
 
 //添加记录
 func (t *TimeTrie) AddWithTime(words string, timeUnix int64) {
+	opts := t.windowOptions
 	for _, c := range words {
 		if t.next[c] == nil {
-			st := NewTimeTrie()
+			st := &TimeTrie{next: make(map[rune]*TimeTrie, INITCAP), windowOptions: opts}
 			st.key = c
 			st.parent = t
 			t.next[c] = st
 		}
 		t = t.next[c]
 	}
-	t.recordTss = append(t.recordTss, timeUnix)
+	if t.counts == nil {
+		t.counts = &wordCounts{}
+	}
+	t.counts.add(opts, timeUnix)
+	if timeUnix > t.lastTs {
+		t.lastTs = timeUnix
+	}
 }
 
 //查询是否完整包含words的记录
@@ -59,11 +157,20 @@ func (t *TimeTrie) FullMatch(words string) bool {
 }
 
 func (t *TimeTrie) isWord() bool {
-	return len(t.recordTss) > 0
+	return t.counts != nil
 }
 
+//默认统计窗口内的记录次数
 func (t *TimeTrie) Points() int {
-	return len(t.recordTss)
+	return int(t.PointsIn(t.DefaultWindow()))
+}
+
+//统计窗口内的记录次数
+func (t *TimeTrie) PointsIn(window time.Duration) int64 {
+	if t.counts == nil {
+		return 0
+	}
+	return t.counts.count(window, t.clockTime())
 }
 
 //查询是否有包含prefix前缀的记录
@@ -99,11 +206,8 @@ func (t *TimeTrie) GetStartWith(prefix string) (founds []string) {
 }
 
 func (t *TimeTrie) clearOutTimeRecord(outTimeUnix int64) {
-	for i := len(t.recordTss) - 1; i >= 0; i-- {
-		if t.recordTss[i] < outTimeUnix {
-			t.recordTss = t.recordTss[i+1:]
-			return
-		}
+	if t.counts != nil && t.lastTs < outTimeUnix {
+		t.counts = nil
 	}
 }
 func (t *TimeTrie) cleanOutTimeTrie() {
@@ -127,20 +231,35 @@ func (t *TimeTrie) OnTimeout(outTimeUnix int64) {
 }
 
 // 统计当前缓存前x的热门
-func (t *TimeTrie) HotTopX(topX int) []string {
+// window 统计窗口，为空则使用默认统计窗口
+func (t *TimeTrie) HotTopX(topX int, window ...time.Duration) []*HotWord {
+	w := t.DefaultWindow()
+	if len(window) > 0 {
+		w = window[0]
+	}
 	txInfo := NewTopKInfo(topX, nil)
 	for _, s := range t.next {
-		s.statisTopKInfo(txInfo)
+		s.statisTopKInfo(txInfo, w)
 	}
-	hotestX := make([]string, 0, topX)
-	for txInfo.MinHeap.Len() > 0 {
-		tn := heap.Pop(&txInfo.MinHeap).(*TimeTrie)
-		hotestX = append(hotestX, tn.printFullTxt())
+	return txInfo.popAll()
+}
+
+// 以prefix开头的前x个热词
+// window 统计窗口，为空则使用默认统计窗口
+func (t *TimeTrie) SuggestTopX(prefix string, topX int, window ...time.Duration) []*HotWord {
+	w := t.DefaultWindow()
+	if len(window) > 0 {
+		w = window[0]
 	}
-	for i, j := 0, len(hotestX)-1; i < j; i, j = i+1, j-1 {
-		hotestX[i], hotestX[j] = hotestX[j], hotestX[i]
+	for _, v := range prefix {
+		if t.next[v] == nil {
+			return nil
+		}
+		t = t.next[v]
 	}
-	return hotestX
+	txInfo := NewTopKInfo(topX, nil)
+	t.statisTopKInfo(txInfo, w)
+	return txInfo.popAll()
 }
 
 func (t *TimeTrie) printFullTxt() string {
@@ -153,12 +272,14 @@ func (t *TimeTrie) printFullTxt() string {
 	return Reverse(sb.String())
 }
 
-func (t *TimeTrie) statisTopKInfo(txInfo *TopKInfo) {
+func (t *TimeTrie) statisTopKInfo(txInfo *TopKInfo, window time.Duration) {
 	if t.isWord() {
-		txInfo.Add(t)
+		if count := t.PointsIn(window); count > 0 {
+			txInfo.Add(&HotWord{Count: count, node: t})
+		}
 	}
 	for _, st := range t.next {
-		st.statisTopKInfo(txInfo)
+		st.statisTopKInfo(txInfo, window)
 	}
 }
 
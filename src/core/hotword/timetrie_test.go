@@ -3,6 +3,8 @@ package hotword
 import (
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Timetrie_GetStartWith(t *testing.T) {
@@ -50,3 +52,124 @@ func Test_Timetrie_HotTopX(t *testing.T) {
 	root.Add("我好着呢")
 	t.Log(root.HotTopX(3))
 }
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Time() time.Time { return c.now }
+
+func Test_Timetrie_HotTopX_Windows(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	root := NewTimeTrieWithClock(clock)
+	now := clock.now.Unix()
+	//半小时前的热词
+	for i := 0; i < 5; i++ {
+		root.AddWithTime("hello", now-30*60)
+	}
+	//五分钟前
+	for i := 0; i < 3; i++ {
+		root.AddWithTime("world", now-5*60)
+	}
+	//刚刚
+	root.AddWithTime("golang", now)
+	root.AddWithTime("golang", now)
+
+	require.Equal(t, []*HotWord{{Word: "golang", Count: 2}}, root.HotTopX(3, time.Minute))
+	require.Equal(t, []*HotWord{{Word: "world", Count: 3}, {Word: "golang", Count: 2}}, root.HotTopX(3))
+	require.Equal(t, []*HotWord{{Word: "hello", Count: 5}, {Word: "world", Count: 3}}, root.HotTopX(2, time.Hour))
+
+	root.OnTimeout(now - 10*60)
+	require.False(t, root.FullMatch("hello"))
+	require.True(t, root.FullMatch("world"))
+}
+
+func Test_Timetrie_TrendingTopX(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	root := NewTimeTrieWithClock(clock, 10*time.Minute, time.Hour)
+	now := clock.now.Unix()
+	//一直很常见的问候
+	for i := int64(0); i < 60; i++ {
+		root.AddWithTime("hello", now-i*60)
+	}
+	//突然爆发的话题
+	for i := 0; i < 8; i++ {
+		root.AddWithTime("goal", now-60)
+	}
+	root.AddWithTime("rare", now)
+
+	trends := root.TrendingTopX(3, 10*time.Minute, 2)
+	require.Len(t, trends, 2)
+	require.Equal(t, "goal", trends[0].Word)
+	require.Equal(t, "hello", trends[1].Word)
+	require.Greater(t, trends[0].Score, 5.0)
+	require.Less(t, trends[1].Score, 1.0)
+}
+
+func Test_Timetrie_SuggestTopX(t *testing.T) {
+	root := NewTimeTrie()
+	root.Add("golang")
+	root.Add("golang")
+	root.Add("gopher")
+	root.Add("google")
+	root.Add("google")
+	root.Add("google")
+	root.Add("java")
+	require.Equal(t, []*HotWord{{Word: "google", Count: 3}, {Word: "golang", Count: 2}}, root.SuggestTopX("go", 2))
+	require.Equal(t, []*HotWord{{Word: "golang", Count: 2}}, root.SuggestTopX("gol", 5))
+	require.Empty(t, root.SuggestTopX("python", 5))
+
+	ss := NewSpaceSaving(10, time.Hour)
+	ss.Add("golang")
+	ss.Add("gopher")
+	ss.Add("gopher")
+	ss.Add("java")
+	require.Equal(t, []*HotWord{{Word: "gopher", Count: 2}, {Word: "golang", Count: 1}}, ss.SuggestTopX("go", 5))
+}
+
+func Test_MergeTopX(t *testing.T) {
+	merged := MergeTopX(2,
+		[]*HotWord{{Word: "hello", Count: 3}, {Word: "world", Count: 1}},
+		[]*HotWord{{Word: "golang", Count: 3}, {Word: "world", Count: 4}},
+	)
+	require.Equal(t, []*HotWord{{Word: "world", Count: 5}, {Word: "golang", Count: 3}}, merged)
+
+	//次数相同时按字典序，多次合并结果一致
+	for i := 0; i < 20; i++ {
+		merged = MergeTopX(3,
+			[]*HotWord{{Word: "rust", Count: 2}, {Word: "go", Count: 1}, {Word: "zig", Count: 2}},
+			[]*HotWord{{Word: "go", Count: 1}, {Word: "c", Count: 2}, {Word: "java", Count: 2}},
+		)
+		require.Equal(t, []*HotWord{{Word: "c", Count: 2}, {Word: "go", Count: 2}, {Word: "java", Count: 2}}, merged)
+	}
+}
+
+func Test_Timetrie_LazyCounts(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	root := NewTimeTrieWithClock(clock)
+	now := clock.now.Unix()
+	root.AddWithTime("once", now)
+	node := root.next['o'].next['n'].next['c'].next['e']
+	require.Nil(t, node.counts.series)
+
+	//超过 lazyPoints 次后改为 timeseries 分桶计数，统计结果不变
+	for i := int64(0); i < 20; i++ {
+		root.AddWithTime("many", now-i*60)
+	}
+	node = root.next['m'].next['a'].next['n'].next['y']
+	require.NotNil(t, node.counts.series)
+	require.Nil(t, node.counts.tss)
+	require.Equal(t, int64(1), node.PointsIn(time.Minute))
+	require.Equal(t, int64(10), node.PointsIn(10*time.Minute))
+	require.Equal(t, int64(20), node.PointsIn(time.Hour))
+
+	//分桶随时间滚动
+	clock.now = clock.now.Add(30 * time.Minute)
+	require.Zero(t, node.PointsIn(10*time.Minute))
+	require.Equal(t, int64(20), node.PointsIn(time.Hour))
+	clock.now = clock.now.Add(2 * time.Hour)
+	require.Zero(t, node.PointsIn(time.Hour))
+	require.Zero(t, root.next['o'].next['n'].next['c'].next['e'].PointsIn(time.Hour))
+	require.Equal(t, int64(20), node.PointsIn(24*time.Hour))
+	require.Equal(t, int64(1), root.next['o'].next['n'].next['c'].next['e'].PointsIn(24*time.Hour))
+}
@@ -0,0 +1,254 @@
+/*
+	热词统计前的分词和归一化处理
+	拉丁语系按空白和标点切分，中日韩文字使用词典最大正向匹配，词典未命中的部分使用二元切分
+*/
+package hotword
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/zxfonline/IMDemo/core/fileutil"
+)
+
+//分词器
+type Tokenizer interface {
+	//将一句话切分成用于热词统计的词语
+	Tokenize(text string) []string
+}
+
+var _T Tokenizer = NewWordTokenizer(nil, NewStopwords(DefaultStopwords...))
+
+//使用全局分词器分词
+func Tokenize(text string) []string {
+	return _T.Tokenize(text)
+}
+
+//设置全局分词器
+func SetTokenizer(t Tokenizer) {
+	_T = t
+}
+
+//内置停用词
+var DefaultStopwords = []string{
+	"a", "an", "the", "and", "or", "but", "is", "are", "was", "were", "be", "to", "of", "in", "on", "at",
+	"for", "with", "it", "this", "that", "i", "you", "he", "she", "we", "they", "me", "my", "your",
+	"的", "了", "是", "在", "和", "就", "都", "也", "吗", "呢", "吧", "啊", "呀", "哦", "嗯",
+}
+
+//停用词集合
+type Stopwords map[string]struct{}
+
+func NewStopwords(words ...string) Stopwords {
+	sw := make(Stopwords, len(words))
+	for _, w := range words {
+		if w = Normalize(w); w != "" {
+			sw[w] = struct{}{}
+		}
+	}
+	return sw
+}
+
+func (sw Stopwords) Contains(word string) bool {
+	_, ok := sw[word]
+	return ok
+}
+
+//整句作为一个热词，只做大小写折叠和标点剔除
+type SentenceTokenizer struct {
+	Stopwords Stopwords
+}
+
+func NewSentenceTokenizer(stopwords Stopwords) *SentenceTokenizer {
+	return &SentenceTokenizer{Stopwords: stopwords}
+}
+
+func (st *SentenceTokenizer) Tokenize(text string) []string {
+	sentence := strings.Join(strings.FieldsFunc(Normalize(text), isSeparator), " ")
+	if sentence == "" || st.Stopwords.Contains(sentence) {
+		return nil
+	}
+	return []string{sentence}
+}
+
+//分词切分
+type WordTokenizer struct {
+	//中日韩词典，为空则只做二元切分
+	Dict      *Dict
+	Stopwords Stopwords
+}
+
+func NewWordTokenizer(dict *Dict, stopwords Stopwords) *WordTokenizer {
+	return &WordTokenizer{Dict: dict, Stopwords: stopwords}
+}
+
+func (wt *WordTokenizer) Tokenize(text string) []string {
+	var words []string
+	for _, field := range strings.FieldsFunc(Normalize(text), isSeparator) {
+		runes := []rune(field)
+		start := 0
+		for i := 1; i <= len(runes); i++ {
+			if i < len(runes) && isCJK(runes[i]) == isCJK(runes[start]) {
+				continue
+			}
+			if isCJK(runes[start]) {
+				words = wt.segmentCJK(words, runes[start:i])
+			} else {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i
+		}
+	}
+	//同一句话中重复的词只统计一次
+	founds := make(map[string]struct{}, len(words))
+	tokens := words[:0]
+	for _, w := range words {
+		if _, ok := founds[w]; ok || wt.Stopwords.Contains(w) {
+			continue
+		}
+		founds[w] = struct{}{}
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
+
+//最大正向匹配，未命中词典的连续文字使用二元切分
+func (wt *WordTokenizer) segmentCJK(words []string, runes []rune) []string {
+	if wt.Dict == nil {
+		return bigram(words, runes)
+	}
+	miss := -1
+	for i := 0; i < len(runes); {
+		n := wt.Dict.longestMatch(runes[i:])
+		if n == 0 {
+			if miss < 0 {
+				miss = i
+			}
+			i++
+			continue
+		}
+		if miss >= 0 {
+			words = bigram(words, runes[miss:i])
+			miss = -1
+		}
+		words = append(words, string(runes[i:i+n]))
+		i += n
+	}
+	if miss >= 0 {
+		words = bigram(words, runes[miss:])
+	}
+	return words
+}
+
+func bigram(words []string, runes []rune) []string {
+	if len(runes) == 1 {
+		return append(words, string(runes))
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		words = append(words, string(runes[i:i+2]))
+	}
+	return words
+}
+
+//分词词典
+type Dict struct {
+	root   *dictNode
+	maxLen int
+}
+
+type dictNode struct {
+	next map[rune]*dictNode
+	word bool
+}
+
+func NewDict(words ...string) *Dict {
+	d := &Dict{root: &dictNode{next: make(map[rune]*dictNode, INITCAP)}}
+	for _, w := range words {
+		d.Add(w)
+	}
+	return d
+}
+
+//添加词语
+func (d *Dict) Add(word string) {
+	runes := []rune(Normalize(word))
+	if len(runes) == 0 {
+		return
+	}
+	t := d.root
+	for _, c := range runes {
+		if t.next[c] == nil {
+			t.next[c] = &dictNode{next: make(map[rune]*dictNode)}
+		}
+		t = t.next[c]
+	}
+	t.word = true
+	if len(runes) > d.maxLen {
+		d.maxLen = len(runes)
+	}
+}
+
+//返回以runes开头的最长词语长度，未命中返回0
+func (d *Dict) longestMatch(runes []rune) int {
+	t, n := d.root, 0
+	for i := 0; i < len(runes) && i < d.maxLen; i++ {
+		if t = t.next[runes[i]]; t == nil {
+			break
+		}
+		if t.word {
+			n = i + 1
+		}
+	}
+	//单字不作为词语
+	if n < 2 {
+		return 0
+	}
+	return n
+}
+
+//归一化:大小写折叠，全角字符转半角
+func Normalize(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			r = ' '
+		case r >= '！' && r <= '～':
+			r -= 0xfee0
+		}
+		return unicode.ToLower(r)
+	}, text)
+}
+
+//空白、标点和符号作为分隔符
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsControl(r)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+//按行读取词表文件，忽略空行和#开头的注释
+func LoadWordFile(name string) ([]string, error) {
+	fi, err := fileutil.FindFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+	var words []string
+	br := bufio.NewReader(fi)
+	for {
+		line, err := br.ReadString('\n')
+		if w := strings.TrimSpace(line); w != "" && !strings.HasPrefix(w, "#") {
+			words = append(words, w)
+		}
+		if err == io.EOF {
+			return words, nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+}
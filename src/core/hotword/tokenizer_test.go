@@ -0,0 +1,38 @@
+package hotword
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Normalize(t *testing.T) {
+	require.Equal(t, "hello world!", Normalize("HeLLo　Ｗｏｒｌｄ！"))
+}
+
+func Test_SentenceTokenizer(t *testing.T) {
+	tk := NewSentenceTokenizer(NewStopwords("ok"))
+	require.Equal(t, []string{"hello world"}, tk.Tokenize("Hello,  World!!"))
+	require.Equal(t, tk.Tokenize("hello world"), tk.Tokenize("HELLO WORLD?"))
+	require.Empty(t, tk.Tokenize("OK!"))
+	require.Empty(t, tk.Tokenize("?!..."))
+}
+
+func Test_WordTokenizer_Latin(t *testing.T) {
+	tk := NewWordTokenizer(nil, NewStopwords(DefaultStopwords...))
+	require.Equal(t, []string{"hello", "golang", "rocks"}, tk.Tokenize("Hello! The Golang rocks, hello"))
+	require.Equal(t, []string{"hello"}, tk.Tokenize("hello!"))
+	require.Equal(t, tk.Tokenize("hello"), tk.Tokenize("HELLO!!!"))
+}
+
+func Test_WordTokenizer_Bigram(t *testing.T) {
+	tk := NewWordTokenizer(nil, nil)
+	require.Equal(t, []string{"今天", "天天", "天气", "气好"}, tk.Tokenize("今天天气好！"))
+	require.Equal(t, []string{"我", "go", "语言"}, tk.Tokenize("我go语言"))
+}
+
+func Test_WordTokenizer_Dict(t *testing.T) {
+	tk := NewWordTokenizer(NewDict("今天", "天气", "聊天室"), NewStopwords(DefaultStopwords...))
+	require.Equal(t, []string{"今天", "天气", "真好"}, tk.Tokenize("今天天气真好"))
+	require.Equal(t, []string{"聊天室", "hot"}, tk.Tokenize("聊天室的 HOT"))
+}
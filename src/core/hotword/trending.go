@@ -0,0 +1,37 @@
+package hotword
+
+import "time"
+
+//趋势打分:最近窗口内的次数相对基线频率下预期次数的倍数
+//基线为 baseline 窗口中除去最近窗口的部分，突然爆发的热词得分高，一直很常见的热词得分接近1
+func TrendingScore(recentCount, baselineCount int64, recent, baseline time.Duration) float64 {
+	var expected float64
+	if history := baselineCount - recentCount; history > 0 && baseline > recent {
+		expected = float64(history) * float64(recent) / float64(baseline-recent)
+	}
+	return float64(recentCount) / (expected + 1)
+}
+
+// 统计趋势上升最快的前x个热词
+// recent 最近的统计窗口，以最大统计窗口作为基线
+// minCount 最近窗口内的最少次数，避免偶然出现的词语上榜
+func (t *TimeTrie) TrendingTopX(topX int, recent time.Duration, minCount int64) []*HotWord {
+	baseline := t.MaxWindow()
+	txInfo := NewTopKInfo(topX, nil)
+	var statis func(node *TimeTrie)
+	statis = func(node *TimeTrie) {
+		if node.isWord() {
+			if count := node.PointsIn(recent); count > 0 && count >= minCount {
+				score := TrendingScore(count, node.PointsIn(baseline), recent, baseline)
+				txInfo.Add(&HotWord{Count: count, Score: score, node: node})
+			}
+		}
+		for _, st := range node.next {
+			statis(st)
+		}
+	}
+	for _, s := range t.next {
+		statis(s)
+	}
+	return txInfo.popAll()
+}
@@ -0,0 +1,54 @@
+package hotword
+
+import (
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/golangtrace/timeseries"
+)
+
+//关键词录入不超过该次数时只保存时间戳，超过后再创建各统计窗口的分桶计数
+//大量只出现一两次的关键词不用为每个统计窗口分配分桶
+const lazyPoints = 8
+
+//关键词在各统计窗口的计数
+type wordCounts struct {
+	//录入的时间戳，创建分桶计数后清空
+	tss []int64
+	//各统计窗口的分桶计数，录入超过 lazyPoints 次后创建
+	series *timeseries.TimeSeries
+}
+
+func (wc *wordCounts) add(opts *windowOptions, ts int64) {
+	if wc.series == nil {
+		if len(wc.tss) < lazyPoints {
+			wc.tss = append(wc.tss, ts)
+			return
+		}
+		wc.series = opts.newSeries()
+		for _, old := range wc.tss {
+			addSeries(wc.series, old)
+		}
+		wc.tss = nil
+	}
+	addSeries(wc.series, ts)
+}
+
+func addSeries(series *timeseries.TimeSeries, ts int64) {
+	one := timeseries.Float(1)
+	series.AddWithTime(&one, time.Unix(ts, 0))
+}
+
+//统计窗口内的次数
+func (wc *wordCounts) count(window time.Duration, now time.Time) int64 {
+	if wc.series != nil {
+		return seriesPoints(wc.series, window)
+	}
+	var total int64
+	start := now.Add(-window).Unix()
+	for _, ts := range wc.tss {
+		if ts > start && ts <= now.Unix() {
+			total++
+		}
+	}
+	return total
+}
@@ -0,0 +1,268 @@
+/*
+	Prometheus 文本格式的指标导出
+	指标在包初始化时注册到全局 Default，由 /metrics 接口统一输出
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zxfonline/IMDemo/core/atomic"
+	"github.com/zxfonline/IMDemo/core/golangtrace"
+)
+
+//指标输出
+type collector interface {
+	write(w io.Writer)
+}
+
+//指标注册表
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+//全局指标注册表
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Errorf("metrics %s already registered", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+//按注册顺序输出全部指标
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+//输出全局指标的 http 接口
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		bw := bufio.NewWriter(w)
+		Default.WritePrometheus(bw)
+		bw.Flush()
+	})
+}
+
+func writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatLabel(label, value string) string {
+	return fmt.Sprintf(`%s="%s"`, label, labelEscaper.Replace(value))
+}
+
+//只增不减的计数器
+type Counter struct {
+	v atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.v.Inc()
+}
+
+func (c *Counter) Add(n int64) {
+	c.v.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+type counter struct {
+	name, help string
+	c          *Counter
+}
+
+//注册计数器
+func NewCounter(name, help string) *Counter {
+	c := &counter{name: name, help: help, c: &Counter{}}
+	Default.register(name, c)
+	return c.c
+}
+
+func (c *counter) write(w io.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	fmt.Fprintf(w, "%s %d\n", c.name, c.c.Value())
+}
+
+//按标签区分的计数器
+type CounterVec struct {
+	name, help, label string
+	mu                sync.RWMutex
+	counters          map[string]*Counter
+}
+
+//注册按标签区分的计数器
+func NewCounterVec(name, help, label string) *CounterVec {
+	cv := &CounterVec{name: name, help: help, label: label, counters: make(map[string]*Counter)}
+	Default.register(name, cv)
+	return cv
+}
+
+//获取标签值对应的计数器，不存在则创建
+func (cv *CounterVec) With(value string) *Counter {
+	cv.mu.RLock()
+	c := cv.counters[value]
+	cv.mu.RUnlock()
+	if c != nil {
+		return c
+	}
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	if c = cv.counters[value]; c == nil {
+		c = &Counter{}
+		cv.counters[value] = c
+	}
+	return c
+}
+
+func (cv *CounterVec) write(w io.Writer) {
+	writeHeader(w, cv.name, cv.help, "counter")
+	cv.mu.RLock()
+	values := make([]string, 0, len(cv.counters))
+	for v := range cv.counters {
+		values = append(values, v)
+	}
+	cv.mu.RUnlock()
+	sort.Strings(values)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s{%s} %d\n", cv.name, formatLabel(cv.label, v), cv.With(v).Value())
+	}
+}
+
+type gaugeFunc struct {
+	name, help string
+	f          func() float64
+}
+
+//注册采集时计算的瞬时值
+func NewGaugeFunc(name, help string, f func() float64) {
+	Default.register(name, &gaugeFunc{name: name, help: help, f: f})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.f()))
+}
+
+type gaugeVecFunc struct {
+	name, help, label string
+	f                 func() map[string]float64
+}
+
+//注册采集时计算的按标签区分的瞬时值
+func NewGaugeVecFunc(name, help, label string, f func() map[string]float64) {
+	Default.register(name, &gaugeVecFunc{name: name, help: help, label: label, f: f})
+}
+
+func (g *gaugeVecFunc) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	vals := g.f()
+	values := make([]string, 0, len(vals))
+	for v := range vals {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	for _, v := range values {
+		fmt.Fprintf(w, "%s{%s} %s\n", g.name, formatLabel(g.label, v), formatFloat(vals[v]))
+	}
+}
+
+//按标签区分的直方图，使用 golangtrace.Histogram 的2的幂次分桶
+type HistogramVec struct {
+	name, help, label string
+	//观测值与导出单位的比例，如观测值为微秒、导出单位为秒时为1e6
+	scale      float64
+	mu         sync.RWMutex
+	histograms map[string]*golangtrace.Histogram
+}
+
+//注册按标签区分的直方图
+func NewHistogramVec(name, help, label string, scale float64) *HistogramVec {
+	hv := &HistogramVec{name: name, help: help, label: label, scale: scale, histograms: make(map[string]*golangtrace.Histogram)}
+	Default.register(name, hv)
+	return hv
+}
+
+//获取标签值对应的直方图，不存在则创建
+func (hv *HistogramVec) With(value string) *golangtrace.Histogram {
+	hv.mu.RLock()
+	h := hv.histograms[value]
+	hv.mu.RUnlock()
+	if h != nil {
+		return h
+	}
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	if h = hv.histograms[value]; h == nil {
+		h = golangtrace.NewHistogram()
+		hv.histograms[value] = h
+	}
+	return h
+}
+
+func (hv *HistogramVec) write(w io.Writer) {
+	writeHeader(w, hv.name, hv.help, "histogram")
+	hv.mu.RLock()
+	values := make([]string, 0, len(hv.histograms))
+	for v := range hv.histograms {
+		values = append(values, v)
+	}
+	hv.mu.RUnlock()
+	sort.Strings(values)
+	for _, v := range values {
+		label := formatLabel(hv.label, v)
+		buckets, count, sum := hv.With(v).Snapshot()
+		var cumulative int64
+		for i, n := range buckets {
+			cumulative += n
+			le := math.Inf(1)
+			if i < len(buckets)-1 {
+				//桶的上界不包含在桶内，而 le 包含，观测值为整数，所以取上界-1
+				le = float64(golangtrace.HistogramBucketUpperBound(i)-1) / hv.scale
+			}
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", hv.name, label, formatFloat(le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", hv.name, label, formatFloat(float64(sum)/hv.scale))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", hv.name, label, count)
+	}
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_WritePrometheus(t *testing.T) {
+	c := NewCounter("test_total", "test counter")
+	c.Add(3)
+	cv := NewCounterVec("test_room_total", "test counter vec", "room")
+	cv.With("2").Inc()
+	cv.With("1").Add(2)
+	NewGaugeFunc("test_gauge", "test gauge", func() float64 { return 1.5 })
+	NewGaugeVecFunc("test_gauge_vec", "test gauge vec", "room", func() map[string]float64 {
+		return map[string]float64{`a"b`: 2}
+	})
+	hv := NewHistogramVec("test_latency_seconds", "test histogram", "room", 1e6)
+	hv.With("1").Observe(3)
+	//等于桶上界的观测值计入下一个桶
+	hv.With("1").Observe(4)
+	hv.With("1").Observe(1000000)
+
+	var buf bytes.Buffer
+	Default.WritePrometheus(&buf)
+	out := buf.String()
+	require.Contains(t, out, "# TYPE test_total counter\ntest_total 3\n")
+	require.Contains(t, out, "test_room_total{room=\"1\"} 2\ntest_room_total{room=\"2\"} 1\n")
+	require.Contains(t, out, "test_gauge 1.5\n")
+	require.Contains(t, out, "test_gauge_vec{room=\"a\\\"b\"} 2\n")
+	require.Contains(t, out, "# TYPE test_latency_seconds histogram\n")
+	require.Contains(t, out, "test_latency_seconds_bucket{room=\"1\",le=\"3e-06\"} 1\n")
+	require.Contains(t, out, "test_latency_seconds_bucket{room=\"1\",le=\"7e-06\"} 2\n")
+	require.Contains(t, out, "test_latency_seconds_bucket{room=\"1\",le=\"+Inf\"} 3\n")
+	require.Contains(t, out, "test_latency_seconds_sum{room=\"1\"} 1.000007\n")
+	require.Contains(t, out, "test_latency_seconds_count{room=\"1\"} 3\n")
+
+	require.Panics(t, func() { NewCounter("test_total", "duplicated") })
+}
@@ -1,6 +1,9 @@
 package nametrie
 
-import "sync"
+import (
+	"sort"
+	"sync"
+)
 
 //默认空间
 const INITCAP = 8
@@ -43,3 +46,71 @@ func (t *NameMatchTrie) FullMatch(words string) bool {
 	}
 	return t.word
 }
+
+//删除记录，返回是否存在该记录
+func (t *NameMatchTrie) Remove(words string) bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.remove([]rune(words))
+}
+
+func (t *NameMatchTrie) remove(runes []rune) bool {
+	if len(runes) == 0 {
+		if !t.word {
+			return false
+		}
+		t.word = false
+		return true
+	}
+	st := t.next[runes[0]]
+	if st == nil || !st.remove(runes[1:]) {
+		return false
+	}
+	//清理不再使用的节点
+	if !st.word && len(st.next) == 0 {
+		delete(t.next, runes[0])
+	}
+	return true
+}
+
+//按字典序遍历包含prefix前缀的所有记录，callback 返回false停止遍历
+func (t *NameMatchTrie) RangePrefix(prefix string, callback func(words string) bool) {
+	t.Lock()
+	defer t.Unlock()
+	for _, c := range prefix {
+		if t.next[c] == nil {
+			return
+		}
+		t = t.next[c]
+	}
+	t.rangeWords([]rune(prefix), callback)
+}
+
+func (t *NameMatchTrie) rangeWords(prefix []rune, callback func(words string) bool) bool {
+	if t.word && !callback(string(prefix)) {
+		return false
+	}
+	keys := make([]rune, 0, len(t.next))
+	for k := range t.next {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	for _, k := range keys {
+		if !t.next[k].rangeWords(append(prefix, k), callback) {
+			return false
+		}
+	}
+	return true
+}
+
+//查询包含prefix前缀的记录，最多返回limit条
+func (t *NameMatchTrie) PrefixMatch(prefix string, limit int) (founds []string) {
+	if limit <= 0 {
+		return
+	}
+	t.RangePrefix(prefix, func(words string) bool {
+		founds = append(founds, words)
+		return len(founds) < limit
+	})
+	return
+}
@@ -2,6 +2,8 @@ package nametrie
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func Test_Timetrie_HotTopX(t *testing.T) {
@@ -15,3 +17,22 @@ func Test_Timetrie_HotTopX(t *testing.T) {
 	t.Log(root.FullMatch("zhangsan"))
 	t.Log(root.FullMatch("zhangsan2"))
 }
+
+func Test_NameMatchTrie_PrefixMatch(t *testing.T) {
+	root := NewNameMatchTrie()
+	for _, name := range []string{"zhangsan", "zhangsi", "zhao", "张三", "张三丰", "李四"} {
+		root.Add(name)
+	}
+	require.Equal(t, []string{"zhangsan", "zhangsi", "zhao"}, root.PrefixMatch("zh", 10))
+	require.Equal(t, []string{"zhangsan", "zhangsi"}, root.PrefixMatch("zh", 2))
+	require.Equal(t, []string{"张三", "张三丰"}, root.PrefixMatch("张", 10))
+	require.Empty(t, root.PrefixMatch("王", 10))
+
+	require.True(t, root.Remove("张三"))
+	require.False(t, root.Remove("张三"))
+	require.False(t, root.FullMatch("张三"))
+	require.True(t, root.FullMatch("张三丰"))
+	require.True(t, root.Remove("zhao"))
+	require.Equal(t, []string{"zhangsan", "zhangsi"}, root.PrefixMatch("zh", 10))
+	require.Len(t, root.next['z'].next['h'].next, 1)
+}
@@ -0,0 +1,65 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/golangtrace"
+)
+
+//会话事件日志的分类，在 /debug/events 页面中查看
+const EventFamily = "session"
+
+//会话关闭后事件日志的保留时长，便于排查掉线原因
+var EventLogRetention = 10 * time.Minute
+
+//会话事件日志，关闭后延迟释放
+type sessionEvents struct {
+	mu sync.Mutex
+	el golangtrace.EventLog
+}
+
+func newSessionEvents(title string) *sessionEvents {
+	return &sessionEvents{el: golangtrace.NewEventLog(EventFamily, title)}
+}
+
+func (se *sessionEvents) printf(isErr bool, format string, a ...interface{}) {
+	if se == nil {
+		return
+	}
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if se.el == nil {
+		return
+	}
+	if isErr {
+		se.el.Errorf(format, a...)
+	} else {
+		se.el.Printf(format, a...)
+	}
+}
+
+//保留一段时间后释放事件日志
+func (se *sessionEvents) finish() {
+	if se == nil {
+		return
+	}
+	time.AfterFunc(EventLogRetention, func() {
+		se.mu.Lock()
+		defer se.mu.Unlock()
+		if se.el != nil {
+			se.el.Finish()
+			se.el = nil
+		}
+	})
+}
+
+//记录会话事件
+func (s *WsSession) Eventf(format string, a ...interface{}) {
+	s.events.printf(false, format, a...)
+}
+
+//记录会话异常事件
+func (s *WsSession) EventErrorf(format string, a ...interface{}) {
+	s.events.printf(true, format, a...)
+}
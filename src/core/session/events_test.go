@@ -0,0 +1,29 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SessionEvents_Finish(t *testing.T) {
+	retention := EventLogRetention
+	EventLogRetention = 0
+	defer func() { EventLogRetention = retention }()
+
+	s := &WsSession{events: newSessionEvents("session:test")}
+	s.Eventf("login name:%s", "zhangsan")
+	s.EventErrorf("rpm too high")
+	s.events.finish()
+	require.Eventually(t, func() bool {
+		s.events.mu.Lock()
+		defer s.events.mu.Unlock()
+		return s.events.el == nil
+	}, time.Second, time.Millisecond)
+	//释放后继续记录不会访问已回收的事件日志
+	s.Eventf("closed")
+
+	var nilEvents *WsSession = &WsSession{}
+	nilEvents.Eventf("no event log")
+}
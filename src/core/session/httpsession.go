@@ -0,0 +1,328 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/log"
+)
+
+var (
+	errMessageTooBig = errors.New("message too big")
+	errRpmLimit      = errors.New("messages are sent too frequently")
+	errSessionClosed = errors.New("session closed")
+)
+
+//http请求的远程地址
+type httpAddr string
+
+func (a httpAddr) Network() string { return "http" }
+func (a httpAddr) String() string  { return string(a) }
+
+//http长轮询和事件流会话
+//客户端通过请求提交消息，通过长轮询或事件流(Server-Sent Events)接收消息
+type HttpSession struct {
+	SessionId int64
+	//会话令牌，请求时需要携带
+	token      string
+	remoteAddr net.Addr
+	ReadChan   chan *NetPacket
+	SendChan   chan *NetPacket
+	//离线消息管道,用于外部接收连接断开的消息并处理后续
+	OffChan    chan int64
+	CloseState chanutil.DoneChan
+	opts       Options
+	filter     func(*NetPacket) bool
+
+	mu  sync.Mutex
+	rpm rpmCounter
+	//关闭码和关闭原因，在最后一次轮询中告知客户端
+	closeCode   int
+	closeReason string
+
+	//最后一次请求的时间 unix纳秒
+	lastActive int64
+	//正在等待消息的轮询请求数
+	receivers int32
+
+	//登录时间
+	OnLineTime time.Time
+	//离线时间
+	OffLineTime time.Time
+	//收发统计
+	Stats *SessionStats
+	//事件日志
+	events *sessionEvents
+	//关闭后的清理
+	onClose func()
+}
+
+func NewHttpSession(remoteAddr string, token string, opts *Options) *HttpSession {
+	now := time.Now()
+	s := &HttpSession{
+		SessionId:  atomic.AddInt64(&_sessionID, 1),
+		token:      token,
+		remoteAddr: httpAddr(remoteAddr),
+		ReadChan:   make(chan *NetPacket, opts.ReadBuffer),
+		SendChan:   make(chan *NetPacket, opts.SendBuffer),
+		OffChan:    opts.OffChan,
+		CloseState: chanutil.NewDoneChan(),
+		opts:       *opts,
+		rpm:        rpmCounter{start: now},
+		lastActive: now.UnixNano(),
+		OnLineTime: now,
+		Stats:      &SessionStats{},
+	}
+	if s.opts.ReadDelay <= 0 {
+		s.opts.ReadDelay = 60 * time.Second
+	}
+	s.events = newSessionEvents(fmt.Sprintf("session:%d remote:%s", s.SessionId, remoteAddr))
+	s.Eventf("connect http remote:%s", remoteAddr)
+	return s
+}
+
+func (s *HttpSession) ID() int64 {
+	return s.SessionId
+}
+
+func (s *HttpSession) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+//开始收发消息，客户端空闲超时后关闭会话
+func (s *HttpSession) HandleConn(filter func(*NetPacket) bool) {
+	s.filter = filter
+	go s.watchLoop()
+}
+
+func (s *HttpSession) watchLoop() {
+	defer log.PrintPanicStack()
+	ticker := time.NewTicker(s.opts.ReadDelay / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.CloseState:
+			s.closeTask()
+			return
+		case now := <-ticker.C:
+			//有轮询请求在等待消息时不算空闲
+			if atomic.LoadInt32(&s.receivers) > 0 {
+				s.touch(now)
+				continue
+			}
+			if idle := now.Sub(time.Unix(0, atomic.LoadInt64(&s.lastActive))); idle > s.opts.ReadDelay {
+				s.Eventf("read closed:idle %s", idle.Truncate(time.Second))
+				s.Close()
+			}
+		}
+	}
+}
+
+func (s *HttpSession) touch(now time.Time) {
+	atomic.StoreInt64(&s.lastActive, now.UnixNano())
+}
+
+func (s *HttpSession) Recv() <-chan *NetPacket {
+	return s.ReadChan
+}
+
+func (s *HttpSession) Push(packet *NetPacket) bool {
+	select {
+	case s.ReadChan <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+//客户端提交的消息
+func (s *HttpSession) receive(ctx context.Context, message []byte) error {
+	if s.IsClosed() {
+		return errSessionClosed
+	}
+	now := time.Now()
+	s.touch(now)
+	s.Stats.BytesIn.Add(int64(len(message)))
+	if s.opts.MaxRecvSize > 0 && len(message) > int(s.opts.MaxRecvSize) {
+		s.EventErrorf("read err:message too big,%d", len(message))
+		s.CloseWithReason(CloseMessageTooBig, errMessageTooBig.Error())
+		return errMessageTooBig
+	}
+	if s.opts.RpmLimit > 0 {
+		s.mu.Lock()
+		hit := s.rpm.hit(s.opts.RpmLimit, s.opts.RpmInterval, now)
+		count := s.rpm.count
+		s.mu.Unlock()
+		if hit {
+			s.Stats.RpmHits.Inc()
+			rpmKickTotal.Inc()
+			s.EventErrorf("rpm too high,%d/%s", count, s.opts.RpmInterval)
+			log.Errorf("session rpm too high,%d/%s qps,session:%d,remote:%s", count, s.opts.RpmInterval, s.SessionId, s.RemoteAddr())
+			s.CloseWithReason(CloseNormalClosure, errRpmLimit.Error())
+			return errRpmLimit
+		}
+	}
+	message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+	pack := &NetPacket{MsgType: TextMessage, Data: message, ReceiveTime: now}
+	if s.filter != nil && s.filter(pack) {
+		return nil
+	}
+	select {
+	case s.ReadChan <- pack:
+		return nil
+	case <-s.CloseState:
+		return errSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *HttpSession) Send(packet *NetPacket) bool {
+	if packet == nil {
+		return false
+	}
+	switch packet.MsgType {
+	case TextMessage, BinaryMessage:
+	case CloseMessage:
+		s.CloseWithReason(ParseCloseMessage(packet.Data))
+		return true
+	default:
+		//ping、pong由轮询请求代替
+		return true
+	}
+	if !s.opts.SendFullClose {
+		select {
+		case s.SendChan <- packet:
+			return true
+		case <-s.CloseState:
+			return false
+		}
+	}
+	select {
+	case <-s.CloseState:
+		return false
+	case s.SendChan <- packet:
+		return true
+	default:
+		sendOverflowTotal.Inc()
+		s.EventErrorf("send queue overflow,waitChan:%d", len(s.SendChan))
+		log.Errorf("session sender overflow,close session,waitChan:%d,msg:%v,session:%d,remote:%s", len(s.SendChan), packet.MsgType, s.SessionId, s.RemoteAddr())
+		s.Close()
+		return false
+	}
+}
+
+//等待待发送的消息，最多等待wait，最多返回max条
+//会话关闭后返回剩余的消息和closed=true
+func (s *HttpSession) poll(ctx context.Context, wait time.Duration, max int) (packets []*NetPacket, closed bool) {
+	atomic.AddInt32(&s.receivers, 1)
+	defer func() {
+		atomic.AddInt32(&s.receivers, -1)
+		s.touch(time.Now())
+	}()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case packet := <-s.SendChan:
+		packets = append(packets, packet)
+	case <-s.CloseState:
+		closed = true
+	case <-timer.C:
+		return
+	case <-ctx.Done():
+		return
+	}
+	for len(packets) < max {
+		select {
+		case packet := <-s.SendChan:
+			packets = append(packets, packet)
+			continue
+		default:
+		}
+		break
+	}
+	if !closed {
+		closed = s.IsClosed()
+	}
+	return
+}
+
+//消息已写给客户端
+func (s *HttpSession) written(packets []*NetPacket) {
+	now := time.Now()
+	for _, packet := range packets {
+		s.Stats.BytesOut.Add(int64(len(packet.Data)))
+		packet.written(now)
+	}
+}
+
+func (s *HttpSession) Close() {
+	s.CloseState.SetDone()
+}
+
+func (s *HttpSession) CloseWithReason(closeCode int, reason string) {
+	s.Eventf("close code:%d,reason:%s", closeCode, reason)
+	s.mu.Lock()
+	if s.closeCode == 0 {
+		s.closeCode, s.closeReason = closeCode, reason
+	}
+	s.mu.Unlock()
+	s.Close()
+}
+
+//关闭码和关闭原因
+func (s *HttpSession) closeStatus() (closeCode int, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closeCode == 0 {
+		return CloseGoingAway, ""
+	}
+	return s.closeCode, s.closeReason
+}
+
+func (s *HttpSession) IsClosed() bool {
+	return s.CloseState.R().Done()
+}
+
+func (s *HttpSession) Closed() <-chan struct{} {
+	return s.CloseState
+}
+
+func (s *HttpSession) QueueLen() (depth, capacity int) {
+	return len(s.SendChan), cap(s.SendChan)
+}
+
+func (s *HttpSession) LoginTime() time.Time {
+	return s.OnLineTime
+}
+
+func (s *HttpSession) Statistics() *SessionStats {
+	return s.Stats
+}
+
+func (s *HttpSession) Eventf(format string, a ...interface{}) {
+	s.events.printf(false, format, a...)
+}
+
+func (s *HttpSession) EventErrorf(format string, a ...interface{}) {
+	s.events.printf(true, format, a...)
+}
+
+func (s *HttpSession) closeTask() {
+	s.OffLineTime = time.Now()
+	s.Eventf("closed,online:%s,bytesIn:%d,bytesOut:%d", s.OffLineTime.Sub(s.OnLineTime), s.Stats.BytesIn.Load(), s.Stats.BytesOut.Load())
+	s.events.finish()
+	if s.onClose != nil {
+		s.onClose()
+	}
+	if s.OffChan != nil {
+		s.OffChan <- s.SessionId
+	}
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type pollResult struct {
+	Messages []json.RawMessage `json:"messages"`
+	Closed   bool              `json:"closed"`
+	Code     int               `json:"code"`
+	Reason   string            `json:"reason"`
+}
+
+func newTestTransport(t *testing.T, opts *Options) (*httptest.Server, chan Session) {
+	accepted := make(chan Session, 1)
+	var sessions []Session
+	opts.OffChan = make(chan int64, 4)
+	transport := NewHttpTransport(func() *Options { return opts }, func(s Session) {
+		s.HandleConn(nil)
+		sessions = append(sessions, s)
+		accepted <- s
+	})
+	transport.PollWait = 100 * time.Millisecond
+	server := httptest.NewServer(transport)
+	t.Cleanup(func() {
+		server.Close()
+		//等待会话清理结束
+		for _, s := range sessions {
+			s.Close()
+			<-opts.OffChan
+		}
+	})
+	return server, accepted
+}
+
+func openTestSession(t *testing.T, server *httptest.Server) string {
+	resp, err := http.Post(server.URL+"/poll/open", "", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var res struct {
+		Sid   int64  `json:"sid"`
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&res))
+	require.NotEmpty(t, res.Token)
+	return "?sid=" + strconv.FormatInt(res.Sid, 10) + "&token=" + res.Token
+}
+
+func pollTestSession(t *testing.T, server *httptest.Server, query string) *pollResult {
+	resp, err := http.Get(server.URL + "/poll/recv" + query)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	res := &pollResult{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+	return res
+}
+
+func TestHttpTransport_SendRecv(t *testing.T) {
+	server, accepted := newTestTransport(t, &Options{ReadBuffer: 4, SendBuffer: 4, MaxRecvSize: 64})
+	query := openTestSession(t, server)
+	s := <-accepted
+
+	resp, err := http.Post(server.URL+"/poll/send"+query, "text/plain", strings.NewReader(`{"type":1001}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	msg := <-s.Recv()
+	require.Equal(t, `{"type":1001}`, string(msg.Data))
+	require.False(t, msg.ReceiveTime.IsZero())
+
+	//令牌错误
+	resp, err = http.Get(server.URL + "/poll/recv" + query[:strings.Index(query, "&")] + "&token=bad")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	//无消息时等待超时返回空列表
+	res := pollTestSession(t, server, query)
+	require.Empty(t, res.Messages)
+	require.False(t, res.Closed)
+
+	require.True(t, s.Send(&NetPacket{MsgType: TextMessage, Data: []byte(`{"type":1002}`)}))
+	require.True(t, s.Send(&NetPacket{MsgType: TextMessage, Data: []byte(`{"type":4001}`)}))
+	res = pollTestSession(t, server, query)
+	require.Len(t, res.Messages, 2)
+	require.JSONEq(t, `{"type":1002}`, string(res.Messages[0]))
+	require.Equal(t, int64(len(`{"type":1002}{"type":4001}`)), s.Statistics().BytesOut.Load())
+
+	//关闭原因在最后一次轮询中返回
+	s.CloseWithReason(ClosePolicyViolation, "kicked")
+	res = pollTestSession(t, server, query)
+	require.True(t, res.Closed)
+	require.Equal(t, ClosePolicyViolation, res.Code)
+	require.Equal(t, "kicked", res.Reason)
+
+	resp, err = http.Post(server.URL+"/poll/send"+query, "text/plain", strings.NewReader("hi"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func TestHttpTransport_Limits(t *testing.T) {
+	server, accepted := newTestTransport(t, &Options{ReadBuffer: 8, SendBuffer: 4, MaxRecvSize: 8, RpmLimit: 2, RpmInterval: time.Minute})
+	query := openTestSession(t, server)
+	s := <-accepted
+	post := func(body string) int {
+		resp, err := http.Post(server.URL+"/poll/send"+query, "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, post("a"))
+	require.Equal(t, http.StatusOK, post("b"))
+	require.Equal(t, http.StatusTooManyRequests, post("c"))
+	require.True(t, s.IsClosed())
+	require.Equal(t, int64(1), s.Statistics().RpmHits.Load())
+
+	query = openTestSession(t, server)
+	s = <-accepted
+	require.Equal(t, http.StatusRequestEntityTooLarge, post("too long message"))
+	require.True(t, s.IsClosed())
+	res := pollTestSession(t, server, query)
+	require.True(t, res.Closed)
+	require.Equal(t, CloseMessageTooBig, res.Code)
+}
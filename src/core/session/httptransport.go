@@ -0,0 +1,262 @@
+package session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/log"
+)
+
+//http长轮询和事件流传输
+//	POST open            创建会话，返回 {"sid":会话id,"token":会话令牌}
+//	POST send?sid=&token= 请求体为一条消息
+//	GET  recv?sid=&token= 长轮询，返回 {"messages":[消息...],"closed":是否已关闭,"code":关闭码,"reason":关闭原因}
+//	GET  stream?sid=&token= 事件流，每条消息一个 data 事件，关闭时发送 close 事件
+//	POST close?sid=&token= 关闭会话
+type HttpTransport struct {
+	//创建会话的参数
+	Options func() *Options
+	//接入新创建的会话
+	Accept func(s Session)
+	//长轮询的最长等待时间
+	PollWait time.Duration
+	//每次长轮询最多返回的消息数
+	PollMax int
+	//事件流的最长时长，避免被http服务器的写超时强制断开，<=0 不限制
+	StreamDuration time.Duration
+	//事件流的心跳间隔
+	StreamHeartbeat time.Duration
+	//会话关闭后保留的时长，供客户端获取关闭原因
+	ClosedRetention time.Duration
+
+	sessions sync.Map
+}
+
+func NewHttpTransport(options func() *Options, accept func(s Session)) *HttpTransport {
+	return &HttpTransport{
+		Options:         options,
+		Accept:          accept,
+		PollWait:        25 * time.Second,
+		PollMax:         64,
+		StreamHeartbeat: 15 * time.Second,
+		ClosedRetention: 30 * time.Second,
+	}
+}
+
+func newSessionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(v)
+}
+
+//创建会话
+func (t *HttpTransport) Open(w http.ResponseWriter, req *http.Request) {
+	token, err := newSessionToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s := NewHttpSession(req.RemoteAddr, token, t.Options())
+	s.onClose = func() {
+		time.AfterFunc(t.ClosedRetention, func() {
+			t.sessions.Delete(s.SessionId)
+		})
+	}
+	t.sessions.Store(s.SessionId, s)
+	t.Accept(s)
+	writeJson(w, &struct {
+		Sid   int64  `json:"sid"`
+		Token string `json:"token"`
+	}{
+		Sid:   s.SessionId,
+		Token: token,
+	})
+}
+
+//请求对应的会话
+func (t *HttpTransport) session(w http.ResponseWriter, req *http.Request) *HttpSession {
+	sid, _ := strconv.ParseInt(req.URL.Query().Get("sid"), 10, 64)
+	if tmp, ok := t.sessions.Load(sid); ok {
+		s := tmp.(*HttpSession)
+		if subtle.ConstantTimeCompare([]byte(req.URL.Query().Get("token")), []byte(s.token)) == 1 {
+			return s
+		}
+	}
+	http.Error(w, "no session found", http.StatusNotFound)
+	return nil
+}
+
+//提交消息
+func (t *HttpTransport) Send(w http.ResponseWriter, req *http.Request) {
+	s := t.session(w, req)
+	if s == nil {
+		return
+	}
+	limit := int64(s.opts.MaxRecvSize)
+	if limit <= 0 {
+		limit = 1 << 20
+	}
+	message, err := ioutil.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch err = s.receive(req.Context(), message); err {
+	case nil:
+		writeJson(w, &struct {
+			Code int `json:"code"`
+		}{})
+	case errMessageTooBig:
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errRpmLimit:
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		http.Error(w, err.Error(), http.StatusGone)
+	}
+}
+
+//长轮询接收消息
+func (t *HttpTransport) Recv(w http.ResponseWriter, req *http.Request) {
+	s := t.session(w, req)
+	if s == nil {
+		return
+	}
+	packets, closed := s.poll(req.Context(), t.PollWait, t.PollMax)
+	var buf bytes.Buffer
+	buf.WriteString(`{"messages":[`)
+	for i, packet := range packets {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(packet.Data)
+	}
+	buf.WriteString(`]`)
+	if closed {
+		code, reason := s.closeStatus()
+		reasonJson, _ := json.Marshal(reason)
+		fmt.Fprintf(&buf, `,"closed":true,"code":%d,"reason":%s`, code, reasonJson)
+	}
+	buf.WriteString("}\n")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		//客户端已断开，消息丢失
+		s.EventErrorf("write err:%v,lost:%d", err, len(packets))
+		return
+	}
+	s.written(packets)
+}
+
+//事件流接收消息
+func (t *HttpTransport) Stream(w http.ResponseWriter, req *http.Request) {
+	s := t.session(w, req)
+	if s == nil {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 1000\n\n")
+	flusher.Flush()
+
+	var deadline time.Time
+	if t.StreamDuration > 0 {
+		deadline = time.Now().Add(t.StreamDuration)
+	}
+	for {
+		wait := t.StreamHeartbeat
+		if !deadline.IsZero() {
+			if left := time.Until(deadline); left <= 0 {
+				return
+			} else if left < wait {
+				wait = left
+			}
+		}
+		packets, closed := s.poll(req.Context(), wait, t.PollMax)
+		if req.Context().Err() != nil {
+			if len(packets) > 0 {
+				s.EventErrorf("write err:%v,lost:%d", req.Context().Err(), len(packets))
+			}
+			return
+		}
+		var buf bytes.Buffer
+		for _, packet := range packets {
+			fmt.Fprintf(&buf, "data: %s\n\n", packet.Data)
+		}
+		if closed {
+			code, reason := s.closeStatus()
+			reasonJson, _ := json.Marshal(reason)
+			fmt.Fprintf(&buf, "event: close\ndata: {\"code\":%d,\"reason\":%s}\n\n", code, reasonJson)
+		} else if len(packets) == 0 {
+			buf.WriteString(": ping\n\n")
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			s.EventErrorf("write err:%v,lost:%d", err, len(packets))
+			return
+		}
+		flusher.Flush()
+		s.written(packets)
+		if closed {
+			return
+		}
+	}
+}
+
+//客户端关闭会话
+func (t *HttpTransport) Close(w http.ResponseWriter, req *http.Request) {
+	s := t.session(w, req)
+	if s == nil {
+		return
+	}
+	s.Eventf("read closed:client close")
+	s.Close()
+	writeJson(w, &struct {
+		Code int `json:"code"`
+	}{})
+}
+
+//按路径末尾的操作名分发请求
+func (t *HttpTransport) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer log.PrintPanicStack()
+	path := req.URL.Path
+	switch {
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/open"):
+		t.Open(w, req)
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/send"):
+		t.Send(w, req)
+	case req.Method == http.MethodGet && strings.HasSuffix(path, "/recv"):
+		t.Recv(w, req)
+	case req.Method == http.MethodGet && strings.HasSuffix(path, "/stream"):
+		t.Stream(w, req)
+	case req.Method == http.MethodPost && strings.HasSuffix(path, "/close"):
+		t.Close(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
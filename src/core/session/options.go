@@ -0,0 +1,39 @@
+package session
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//会话参数，各传输协议共用
+type Options struct {
+	//收到消息的管道容量
+	ReadBuffer int
+	//发送管道容量
+	SendBuffer int
+	//读超时，长轮询会话没有收发请求的最长空闲时间
+	ReadDelay time.Duration
+	//写超时
+	SendDelay time.Duration
+	//单条消息的最大长度
+	MaxRecvSize uint32
+	//发送管道满后是否需要关闭连接
+	SendFullClose bool
+	//包频率包数，0不限制
+	RpmLimit uint32
+	//包频率检测间隔
+	RpmInterval time.Duration
+	//心跳间隔，0使用读超时的9/10，目前只用于tcp会话
+	PingPeriod time.Duration
+	//离线消息管道
+	OffChan chan int64
+}
+
+//创建websocket会话
+func NewWsSessionWithOptions(conn *websocket.Conn, opts *Options) *WsSession {
+	s := NewSession(conn, make(chan *NetPacket, opts.ReadBuffer), make(chan *NetPacket, opts.SendBuffer), opts.OffChan)
+	s.SetParameter(opts.ReadDelay, opts.SendDelay, opts.MaxRecvSize, opts.SendFullClose)
+	s.SetRpmParameter(opts.RpmLimit, opts.RpmInterval, nil)
+	return s
+}
@@ -0,0 +1,20 @@
+package session
+
+import "time"
+
+//消息包的链路耗时跟踪，开始分发后不再修改
+type PacketTrace struct {
+	//进入房间广播队列的时间
+	EnqueueTime time.Time
+	//房间开始分发的时间
+	FanoutTime time.Time
+	//接收者的发送协程写出消息后回调，会被多个协程并发调用
+	OnWritten func(writeTime time.Time)
+}
+
+//消息写出后回调链路跟踪
+func (p *NetPacket) written(writeTime time.Time) {
+	if p.Trace != nil && p.Trace.OnWritten != nil {
+		p.Trace.OnWritten(writeTime)
+	}
+}
@@ -3,6 +3,7 @@ package session
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net"
 	"sync/atomic"
 	"time"
@@ -30,6 +31,8 @@ type NetPacket struct {
 
 	//收到该消息包的时间戳 毫秒
 	ReceiveTime time.Time
+	//链路耗时跟踪，为空不跟踪
+	Trace *PacketTrace
 }
 
 func NewSession(conn *websocket.Conn, readChan, sendChan chan *NetPacket, offChan chan int64) *WsSession {
@@ -46,7 +49,10 @@ func NewSession(conn *websocket.Conn, readChan, sendChan chan *NetPacket, offCha
 		sendFullClose: true,
 		OnLineTime:    &now,
 		CloseState:    chanutil.NewDoneChan(),
+		Stats:         &SessionStats{},
 	}
+	s.events = newSessionEvents(fmt.Sprintf("session:%d remote:%s", s.SessionId, conn.RemoteAddr()))
+	s.Eventf("connect remote:%s", conn.RemoteAddr())
 	s.Conn.SetReadLimit(1024)
 	// log.Debugf("new connection from:%v", conn.RemoteAddr().String())
 	return s
@@ -81,6 +87,10 @@ type WsSession struct {
 	OnLineTime *time.Time
 	//离线时间
 	OffLineTime *time.Time
+	//收发统计
+	Stats *SessionStats
+	//事件日志
+	events *sessionEvents
 }
 
 //filter:true 过滤成功，抛弃该报文；false:过滤失败，继续执行该报文消息
@@ -118,6 +128,8 @@ func (s *WsSession) Send(packet *NetPacket) bool {
 			}
 			return true
 		default:
+			sendOverflowTotal.Inc()
+			s.EventErrorf("send queue overflow,waitChan:%d", len(s.SendChan))
 			log.Errorf("session sender overflow,close session,waitChan:%d,msg:%v,session:%d,remote:%s", len(s.SendChan), packet.MsgType, s.SessionId, s.RemoteAddr())
 			s.Close()
 			return false
@@ -131,9 +143,9 @@ func (s *WsSession) ReadLoop(filter func(*NetPacket) bool) {
 	// 关闭发送
 	defer s.Close()
 
-	rpmStart := time.Now()
-	rpmCount := uint32(0)
-	s.Conn.SetPongHandler(func(string) error {
+	rpm := rpmCounter{start: time.Now()}
+	s.Conn.SetPongHandler(func(appData string) error {
+		s.Stats.onPong(appData, time.Now())
 		if s.readDelay > 0 {
 			s.Conn.SetReadDeadline(time.Now().Add(s.readDelay))
 		}
@@ -152,32 +164,22 @@ func (s *WsSession) ReadLoop(filter func(*NetPacket) bool) {
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Error(err)
+				s.EventErrorf("read err:%v", err)
+			} else {
+				s.Eventf("read closed:%v", err)
 			}
 			return
 		}
+		s.Stats.BytesIn.Add(int64(len(message)))
 		message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
 		// 收包频率控制
-		if s.rpmLimit > 0 {
-			rpmCount++
-
-			// 达到限制包数
-			if rpmCount > s.rpmLimit {
-				now := time.Now()
-				// 检测时间间隔
-				if now.Sub(rpmStart) < s.rpmInterval {
-					// 提示操作太频繁三次后踢下线
-					//rpmMsgCount++
-					//if rpmMsgCount > 3 {
-					s.DirectSendAndClose(s.rpmLimitMsg)
-					log.Errorf("session rpm too high,%d/%s qps,session:%d,remote:%s", rpmCount, s.rpmInterval, s.SessionId, s.RemoteAddr())
-					return
-					//}
-				}
-
-				// 未超过限制
-				rpmCount = 0
-				rpmStart = now
-			}
+		if s.rpmLimit > 0 && rpm.hit(s.rpmLimit, s.rpmInterval, time.Now()) {
+			s.Stats.RpmHits.Inc()
+			rpmKickTotal.Inc()
+			s.EventErrorf("rpm too high,%d/%s", rpm.count, s.rpmInterval)
+			s.DirectSendAndClose(s.rpmLimitMsg)
+			log.Errorf("session rpm too high,%d/%s qps,session:%d,remote:%s", rpm.count, s.rpmInterval, s.SessionId, s.RemoteAddr())
+			return
 		}
 
 		pack := &NetPacket{MsgType: messageType, Data: message, ReceiveTime: time.Now()}
@@ -192,6 +194,49 @@ func (s *WsSession) ReadLoop(filter func(*NetPacket) bool) {
 	}
 }
 
+//会话id
+func (s *WsSession) ID() int64 {
+	return s.SessionId
+}
+
+//收到的消息
+func (s *WsSession) Recv() <-chan *NetPacket {
+	return s.ReadChan
+}
+
+//代替客户端提交一条消息，管道满了返回false
+func (s *WsSession) Push(packet *NetPacket) bool {
+	select {
+	case s.ReadChan <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+//会话关闭后该管道被关闭
+func (s *WsSession) Closed() <-chan struct{} {
+	return s.CloseState
+}
+
+//发送管道中待发送的消息数和管道容量
+func (s *WsSession) QueueLen() (depth, capacity int) {
+	return len(s.SendChan), cap(s.SendChan)
+}
+
+//登录时间
+func (s *WsSession) LoginTime() time.Time {
+	if s.OnLineTime == nil {
+		return time.Time{}
+	}
+	return *s.OnLineTime
+}
+
+//收发统计
+func (s *WsSession) Statistics() *SessionStats {
+	return s.Stats
+}
+
 func (s *WsSession) Close() {
 	s.CloseState.SetDone()
 }
@@ -203,6 +248,8 @@ func (s *WsSession) IsClosed() bool {
 func (s *WsSession) closeTask() {
 	offTime := time.Now()
 	s.OffLineTime = &offTime
+	s.Eventf("closed,online:%s,bytesIn:%d,bytesOut:%d", offTime.Sub(*s.OnLineTime), s.Stats.BytesIn.Load(), s.Stats.BytesOut.Load())
+	s.events.finish()
 	if s.OffChan != nil {
 		s.OffChan <- s.SessionId
 	}
@@ -225,9 +272,11 @@ func (s *WsSession) SendLoop() {
 			s.closeTask()
 			return
 		case <-ticker.C:
-			s.DirectSend(&NetPacket{MsgType: websocket.PingMessage})
+			s.DirectSend(&NetPacket{MsgType: websocket.PingMessage, Data: pingPayload(time.Now())})
 		case packet := <-s.SendChan:
-			s.DirectSend(packet)
+			if s.DirectSend(packet) {
+				packet.written(time.Now())
+			}
 		}
 	}
 }
@@ -241,6 +290,21 @@ func (s *WsSession) DirectSendAndClose(packet *NetPacket) {
 	}()
 }
 
+//通过发送协程写出关闭原因后关闭连接，发送管道满了则直接关闭
+func (s *WsSession) CloseWithReason(closeCode int, reason string) {
+	s.Eventf("close code:%d,reason:%s", closeCode, reason)
+	packet := &NetPacket{
+		MsgType: websocket.CloseMessage,
+		Data:    websocket.FormatCloseMessage(closeCode, reason),
+	}
+	select {
+	case s.SendChan <- packet:
+		time.AfterFunc(time.Second, s.Close)
+	default:
+		s.Close()
+	}
+}
+
 func (s *WsSession) DirectSend(packet *NetPacket) bool {
 	if packet == nil {
 		return true
@@ -251,6 +315,7 @@ func (s *WsSession) DirectSend(packet *NetPacket) bool {
 	err := s.performSend(packet, 0)
 	if err != nil {
 		log.Debugf("error writing msg,session:%d,remote:%s,err:%v", s.SessionId, s.RemoteAddr(), err)
+		s.EventErrorf("write err:%v", err)
 		s.Close()
 		return false
 	}
@@ -272,6 +337,7 @@ func (s *WsSession) performSend(msg *NetPacket, sendRetries int) error {
 	if err != nil {
 		return s.processSendError(err, msg, sendRetries)
 	}
+	s.Stats.BytesOut.Add(int64(len(msg.Data)))
 	return nil
 }
 
@@ -0,0 +1,44 @@
+package session
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/atomic"
+	"github.com/zxfonline/IMDemo/core/metrics"
+)
+
+var (
+	//发送管道满后被关闭的会话数
+	sendOverflowTotal = metrics.NewCounter("im_session_send_overflow_total", "Sessions closed because the send queue overflowed.")
+	//超过收包频率被踢下线的会话数
+	rpmKickTotal = metrics.NewCounter("im_session_rpm_kick_total", "Sessions kicked for exceeding the rpm limit.")
+)
+
+//会话的收发统计，允许并发读取
+type SessionStats struct {
+	//收到的字节数
+	BytesIn atomic.Int64
+	//发送的字节数
+	BytesOut atomic.Int64
+	//触发收包频率限制的次数
+	RpmHits atomic.Int64
+	//最近一次ping的往返时间 纳秒
+	PingRTT atomic.Int64
+}
+
+//ping消息携带发送时间，收到pong时计算往返时间
+func pingPayload(now time.Time) []byte {
+	return []byte(strconv.FormatInt(now.UnixNano(), 10))
+}
+
+func (st *SessionStats) onPong(appData string, now time.Time) {
+	if sendNano, err := strconv.ParseInt(appData, 10, 64); err == nil && sendNano > 0 && sendNano <= now.UnixNano() {
+		st.PingRTT.Store(now.UnixNano() - sendNano)
+	}
+}
+
+//最近一次ping的往返时间
+func (st *SessionStats) RTT() time.Duration {
+	return time.Duration(st.PingRTT.Load())
+}
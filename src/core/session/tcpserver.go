@@ -0,0 +1,101 @@
+package session
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/log"
+)
+
+//tcp长度前缀帧监听服务
+type TcpServer struct {
+	//创建会话的参数
+	Options func() *Options
+	//接入新创建的会话
+	Accept func(s Session)
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+func NewTcpServer(options func() *Options, accept func(s Session)) *TcpServer {
+	return &TcpServer{
+		Options: options,
+		Accept:  accept,
+	}
+}
+
+//监听地址并开始接受连接
+func (t *TcpServer) ListenAndServe(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.listener = ln
+	t.mu.Unlock()
+	go t.Serve(ln)
+	return nil
+}
+
+//接受连接直到监听关闭
+func (t *TcpServer) Serve(ln net.Listener) error {
+	t.mu.Lock()
+	t.listener = ln
+	t.mu.Unlock()
+	var tempDelay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if t.isClosed() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else if tempDelay *= 2; tempDelay > time.Second {
+					tempDelay = time.Second
+				}
+				log.Warnf("tcp accept err:%v,retrying in %v", err, tempDelay)
+				time.Sleep(tempDelay)
+				continue
+			}
+			log.Errorf("tcp accept err:%v", err)
+			return err
+		}
+		tempDelay = 0
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.SetNoDelay(true)
+		}
+		t.Accept(NewTcpSessionWithOptions(conn, t.Options()))
+	}
+}
+
+func (t *TcpServer) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+//监听地址
+func (t *TcpServer) Addr() net.Addr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+//停止接受新连接，已建立的会话不受影响
+func (t *TcpServer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Close()
+}
@@ -0,0 +1,365 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/log"
+)
+
+//tcp帧格式，整数均为大端
+//	| 长度 uint32 | 类型 uint8 | 内容 |
+//长度为类型和内容的字节数，类型与websocket的消息类型一致:
+//	1 文本(json) 2 二进制 8 关闭(2字节关闭码+关闭原因) 9 ping 10 pong
+const tcpFrameHeaderSize = 5
+
+var errFrameTooBig = errors.New("frame too big")
+
+//读取一帧，maxSize<=0 不限制内容长度
+func ReadFrame(r io.Reader, maxSize uint32) (msgType int, payload []byte, err error) {
+	var header [tcpFrameHeaderSize]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size == 0 {
+		err = io.ErrUnexpectedEOF
+		return
+	}
+	size--
+	if maxSize > 0 && size > maxSize {
+		err = errFrameTooBig
+		return
+	}
+	msgType = int(header[4])
+	payload = make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	return
+}
+
+//写出一帧
+func WriteFrame(w io.Writer, msgType int, payload []byte) error {
+	frame := make([]byte, tcpFrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)+1))
+	frame[4] = byte(msgType)
+	copy(frame[tcpFrameHeaderSize:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+//tcp长度前缀帧会话
+type TcpSession struct {
+	Conn     net.Conn
+	SendChan chan *NetPacket
+	ReadChan chan *NetPacket
+	//离线消息管道,用于外部接收连接断开的消息并处理后续
+	OffChan chan int64
+	// ID
+	SessionId int64
+
+	readDelay   time.Duration
+	sendDelay   time.Duration
+	pingPeriod  time.Duration
+	maxRecvSize uint32
+	//发送管道满后是否需要关闭连接
+	sendFullClose bool
+	CloseState    chanutil.DoneChan
+	//写锁，心跳回复和发送协程可能同时写
+	writeMu sync.Mutex
+
+	// 包频率包数
+	rpmLimit uint32
+	// 包频率检测间隔
+	rpmInterval time.Duration
+
+	//登录时间
+	OnLineTime time.Time
+	//离线时间
+	OffLineTime time.Time
+	//收发统计
+	Stats *SessionStats
+	//事件日志
+	events *sessionEvents
+}
+
+//创建tcp会话
+func NewTcpSessionWithOptions(conn net.Conn, opts *Options) *TcpSession {
+	now := time.Now()
+	s := &TcpSession{
+		Conn:          conn,
+		SendChan:      make(chan *NetPacket, opts.SendBuffer),
+		ReadChan:      make(chan *NetPacket, opts.ReadBuffer),
+		OffChan:       opts.OffChan,
+		SessionId:     atomic.AddInt64(&_sessionID, 1),
+		readDelay:     opts.ReadDelay,
+		sendDelay:     opts.SendDelay,
+		pingPeriod:    opts.PingPeriod,
+		maxRecvSize:   opts.MaxRecvSize,
+		sendFullClose: opts.SendFullClose,
+		CloseState:    chanutil.NewDoneChan(),
+		rpmLimit:      opts.RpmLimit,
+		rpmInterval:   opts.RpmInterval,
+		OnLineTime:    now,
+		Stats:         &SessionStats{},
+	}
+	if s.pingPeriod <= 0 {
+		s.pingPeriod = opts.ReadDelay * 9 / 10
+	}
+	s.events = newSessionEvents(fmt.Sprintf("session:%d remote:%s", s.SessionId, conn.RemoteAddr()))
+	s.Eventf("connect tcp remote:%s", conn.RemoteAddr())
+	return s
+}
+
+func (s *TcpSession) ID() int64 {
+	return s.SessionId
+}
+
+func (s *TcpSession) RemoteAddr() net.Addr {
+	return s.Conn.RemoteAddr()
+}
+
+//filter:true 过滤成功，抛弃该报文；false:过滤失败，继续执行该报文消息
+func (s *TcpSession) HandleConn(filter func(*NetPacket) bool) {
+	go s.ReadLoop(filter)
+	go s.SendLoop()
+}
+
+func (s *TcpSession) Recv() <-chan *NetPacket {
+	return s.ReadChan
+}
+
+func (s *TcpSession) Push(packet *NetPacket) bool {
+	select {
+	case s.ReadChan <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *TcpSession) Send(packet *NetPacket) bool {
+	if packet == nil {
+		return false
+	}
+	if !s.sendFullClose { //阻塞发送，直到管道关闭
+		select {
+		case s.SendChan <- packet:
+			return true
+		case <-s.CloseState:
+			return false
+		}
+	}
+	select {
+	case <-s.CloseState:
+		return false
+	case s.SendChan <- packet:
+		return true
+	default:
+		sendOverflowTotal.Inc()
+		s.EventErrorf("send queue overflow,waitChan:%d", len(s.SendChan))
+		log.Errorf("session sender overflow,close session,waitChan:%d,msg:%v,session:%d,remote:%s", len(s.SendChan), packet.MsgType, s.SessionId, s.RemoteAddr())
+		s.Close()
+		return false
+	}
+}
+
+func (s *TcpSession) ReadLoop(filter func(*NetPacket) bool) {
+	defer log.PrintPanicStack()
+
+	// 关闭发送
+	defer s.Close()
+
+	reader := bufio.NewReader(s.Conn)
+	rpm := rpmCounter{start: time.Now()}
+	for {
+		// 读取超时，客户端需要在超时前发送消息或回复心跳
+		if s.readDelay > 0 {
+			s.Conn.SetReadDeadline(time.Now().Add(s.readDelay))
+		}
+		msgType, message, err := ReadFrame(reader, s.maxRecvSize)
+		if err != nil {
+			switch {
+			case err == errFrameTooBig:
+				s.EventErrorf("read err:%v", err)
+				s.writeClose(CloseMessageTooBig, err.Error())
+			case err == io.EOF || s.IsClosed():
+				s.Eventf("read closed:%v", err)
+			default:
+				s.EventErrorf("read err:%v", err)
+			}
+			return
+		}
+		s.Stats.BytesIn.Add(int64(len(message)))
+		switch msgType {
+		case TextMessage, BinaryMessage:
+		case PingMessage:
+			s.writeFrame(PongMessage, message)
+			continue
+		case PongMessage:
+			s.Stats.onPong(string(message), time.Now())
+			continue
+		case CloseMessage:
+			closeCode, reason := ParseCloseMessage(message)
+			s.Eventf("read closed:client close %d %s", closeCode, reason)
+			return
+		default:
+			s.EventErrorf("read err:unsupport frame type %d", msgType)
+			s.writeClose(CloseUnsupportedData, "unsupport frame type")
+			return
+		}
+		if msgType == TextMessage {
+			message = bytes.TrimSpace(bytes.Replace(message, newline, space, -1))
+		}
+		// 收包频率控制
+		if s.rpmLimit > 0 && rpm.hit(s.rpmLimit, s.rpmInterval, time.Now()) {
+			s.Stats.RpmHits.Inc()
+			rpmKickTotal.Inc()
+			s.EventErrorf("rpm too high,%d/%s", rpm.count, s.rpmInterval)
+			s.writeClose(CloseNormalClosure, "messages are sent too frequently")
+			log.Errorf("session rpm too high,%d/%s qps,session:%d,remote:%s", rpm.count, s.rpmInterval, s.SessionId, s.RemoteAddr())
+			return
+		}
+
+		pack := &NetPacket{MsgType: msgType, Data: message, ReceiveTime: time.Now()}
+		if filter == nil || !filter(pack) {
+			select {
+			case s.ReadChan <- pack:
+			case <-s.CloseState:
+				return
+			}
+		}
+	}
+}
+
+func (s *TcpSession) SendLoop() {
+	defer log.PrintPanicStack()
+	pingPeriod := 1 * time.Minute
+	if s.pingPeriod > 0 {
+		pingPeriod = s.pingPeriod
+	}
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.CloseState:
+			s.closeTask()
+			return
+		case <-ticker.C:
+			s.DirectSend(&NetPacket{MsgType: PingMessage, Data: pingPayload(time.Now())})
+		case packet := <-s.SendChan:
+			if s.DirectSend(packet) {
+				packet.written(time.Now())
+			}
+			if packet.MsgType == CloseMessage {
+				s.Close()
+			}
+		}
+	}
+}
+
+func (s *TcpSession) DirectSend(packet *NetPacket) bool {
+	if packet == nil {
+		return true
+	}
+	if s.IsClosed() {
+		return false
+	}
+	msgType, ok := packet.MsgType.(int)
+	if !ok {
+		s.EventErrorf("write err:unsupport message type %v", packet.MsgType)
+		return false
+	}
+	if err := s.writeFrame(msgType, packet.Data); err != nil {
+		log.Debugf("error writing msg,session:%d,remote:%s,err:%v", s.SessionId, s.RemoteAddr(), err)
+		s.EventErrorf("write err:%v", err)
+		s.Close()
+		return false
+	}
+	return true
+}
+
+func (s *TcpSession) writeFrame(msgType int, payload []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	// 写超时
+	if s.sendDelay > 0 {
+		s.Conn.SetWriteDeadline(time.Now().Add(s.sendDelay))
+	}
+	if err := WriteFrame(s.Conn, msgType, payload); err != nil {
+		return err
+	}
+	s.Stats.BytesOut.Add(int64(len(payload)))
+	return nil
+}
+
+//读协程退出前直接写出关闭原因
+func (s *TcpSession) writeClose(closeCode int, reason string) {
+	s.Eventf("close code:%d,reason:%s", closeCode, reason)
+	s.writeFrame(CloseMessage, FormatCloseMessage(closeCode, reason))
+}
+
+//通过发送协程写出关闭原因后关闭连接，发送管道满了则直接关闭
+func (s *TcpSession) CloseWithReason(closeCode int, reason string) {
+	s.Eventf("close code:%d,reason:%s", closeCode, reason)
+	packet := &NetPacket{
+		MsgType: CloseMessage,
+		Data:    FormatCloseMessage(closeCode, reason),
+	}
+	select {
+	case s.SendChan <- packet:
+		time.AfterFunc(time.Second, s.Close)
+	default:
+		s.Close()
+	}
+}
+
+func (s *TcpSession) Close() {
+	s.CloseState.SetDone()
+}
+
+func (s *TcpSession) IsClosed() bool {
+	return s.CloseState.R().Done()
+}
+
+func (s *TcpSession) Closed() <-chan struct{} {
+	return s.CloseState
+}
+
+func (s *TcpSession) QueueLen() (depth, capacity int) {
+	return len(s.SendChan), cap(s.SendChan)
+}
+
+func (s *TcpSession) LoginTime() time.Time {
+	return s.OnLineTime
+}
+
+func (s *TcpSession) Statistics() *SessionStats {
+	return s.Stats
+}
+
+func (s *TcpSession) Eventf(format string, a ...interface{}) {
+	s.events.printf(false, format, a...)
+}
+
+func (s *TcpSession) EventErrorf(format string, a ...interface{}) {
+	s.events.printf(true, format, a...)
+}
+
+func (s *TcpSession) closeTask() {
+	s.OffLineTime = time.Now()
+	s.Eventf("closed,online:%s,bytesIn:%d,bytesOut:%d", s.OffLineTime.Sub(s.OnLineTime), s.Stats.BytesIn.Load(), s.Stats.BytesOut.Load())
+	s.events.finish()
+	if s.OffChan != nil {
+		s.OffChan <- s.SessionId
+	}
+	s.Conn.Close()
+}
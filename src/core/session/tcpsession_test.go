@@ -0,0 +1,99 @@
+package session
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteFrame(&buf, TextMessage, []byte(`{"type":1001}`)))
+	require.NoError(t, WriteFrame(&buf, PingMessage, nil))
+	require.Equal(t, []byte{0, 0, 0, 14, TextMessage}, buf.Bytes()[:5])
+
+	msgType, payload, err := ReadFrame(&buf, 64)
+	require.NoError(t, err)
+	require.Equal(t, TextMessage, msgType)
+	require.Equal(t, `{"type":1001}`, string(payload))
+	msgType, payload, err = ReadFrame(&buf, 64)
+	require.NoError(t, err)
+	require.Equal(t, PingMessage, msgType)
+	require.Empty(t, payload)
+
+	require.NoError(t, WriteFrame(&buf, BinaryMessage, make([]byte, 65)))
+	_, _, err = ReadFrame(&buf, 64)
+	require.Equal(t, errFrameTooBig, err)
+}
+
+func TestTcpServer(t *testing.T) {
+	opts := &Options{ReadBuffer: 4, SendBuffer: 4, ReadDelay: time.Second, MaxRecvSize: 64, OffChan: make(chan int64, 2)}
+	accepted := make(chan Session, 1)
+	server := NewTcpServer(func() *Options { return opts }, func(s Session) {
+		s.HandleConn(nil)
+		accepted <- s
+	})
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	s := <-accepted
+
+	require.NoError(t, WriteFrame(conn, TextMessage, []byte("{\"type\":1001}\n")))
+	msg := <-s.Recv()
+	require.Equal(t, TextMessage, msg.MsgType)
+	require.Equal(t, `{"type":1001}`, string(msg.Data))
+
+	//ping原样回复pong
+	require.NoError(t, WriteFrame(conn, PingMessage, []byte("p1")))
+	msgType, payload, err := ReadFrame(conn, 0)
+	require.NoError(t, err)
+	require.Equal(t, PongMessage, msgType)
+	require.Equal(t, "p1", string(payload))
+
+	require.True(t, s.Send(&NetPacket{MsgType: TextMessage, Data: []byte(`{"type":1002}`)}))
+	msgType, payload, err = ReadFrame(conn, 0)
+	require.NoError(t, err)
+	require.Equal(t, TextMessage, msgType)
+	require.Equal(t, `{"type":1002}`, string(payload))
+
+	//超长帧返回关闭原因后断开
+	require.NoError(t, WriteFrame(conn, TextMessage, make([]byte, 65)))
+	msgType, payload, err = ReadFrame(conn, 0)
+	require.NoError(t, err)
+	require.Equal(t, CloseMessage, msgType)
+	closeCode, _ := ParseCloseMessage(payload)
+	require.Equal(t, CloseMessageTooBig, closeCode)
+	require.Equal(t, s.ID(), <-opts.OffChan)
+	require.True(t, s.IsClosed())
+}
+
+func TestTcpServer_BinaryFrame(t *testing.T) {
+	opts := &Options{ReadBuffer: 4, SendBuffer: 4, ReadDelay: time.Second, MaxRecvSize: 64, OffChan: make(chan int64, 1)}
+	accepted := make(chan Session, 1)
+	server := NewTcpServer(func() *Options { return opts }, func(s Session) {
+		s.HandleConn(nil)
+		accepted <- s
+	})
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	s := <-accepted
+
+	//二进制帧原样投递，不处理换行
+	require.NoError(t, WriteFrame(conn, BinaryMessage, []byte{1, '\n', 3}))
+	msg := <-s.Recv()
+	require.Equal(t, BinaryMessage, msg.MsgType)
+	require.Equal(t, []byte{1, '\n', 3}, msg.Data)
+	require.False(t, s.IsClosed())
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+//消息类型，各传输协议统一使用websocket的消息类型
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+	CloseMessage  = websocket.CloseMessage
+	PingMessage   = websocket.PingMessage
+	PongMessage   = websocket.PongMessage
+)
+
+//关闭码
+const (
+	CloseNormalClosure           = websocket.CloseNormalClosure
+	CloseGoingAway               = websocket.CloseGoingAway
+	ClosePolicyViolation         = websocket.ClosePolicyViolation
+	CloseUnsupportedData         = websocket.CloseUnsupportedData
+	CloseInvalidFramePayloadData = websocket.CloseInvalidFramePayloadData
+	CloseMessageTooBig           = websocket.CloseMessageTooBig
+)
+
+//会话，聊天逻辑通过会话收发消息，和具体的传输协议无关
+type Session interface {
+	//会话id
+	ID() int64
+	//远程地址
+	RemoteAddr() net.Addr
+	//开始收发消息 filter:true 过滤成功，抛弃该报文；false:过滤失败，继续执行该报文消息
+	HandleConn(filter func(*NetPacket) bool)
+	//收到的消息
+	Recv() <-chan *NetPacket
+	//代替客户端提交一条消息，管道满了返回false
+	Push(packet *NetPacket) bool
+	//发送消息，CloseMessage 类型的消息会在发送后关闭会话
+	Send(packet *NetPacket) bool
+	//关闭会话
+	Close()
+	//告知客户端关闭原因后关闭会话
+	CloseWithReason(closeCode int, reason string)
+	IsClosed() bool
+	//会话关闭后该管道被关闭
+	Closed() <-chan struct{}
+	//发送管道中待发送的消息数和管道容量
+	QueueLen() (depth, capacity int)
+	//登录时间
+	LoginTime() time.Time
+	//收发统计
+	Statistics() *SessionStats
+	//记录会话事件
+	Eventf(format string, a ...interface{})
+	//记录会话异常事件
+	EventErrorf(format string, a ...interface{})
+}
+
+//构建关闭消息
+func FormatCloseMessage(closeCode int, text string) []byte {
+	return websocket.FormatCloseMessage(closeCode, text)
+}
+
+//解析关闭消息
+func ParseCloseMessage(data []byte) (closeCode int, text string) {
+	if len(data) < 2 {
+		return websocket.CloseNoStatusReceived, ""
+	}
+	return int(binary.BigEndian.Uint16(data)), string(data[2:])
+}
+
+//收包频率计数
+type rpmCounter struct {
+	count uint32
+	start time.Time
+}
+
+//每个检测间隔内收包数超过limit返回true
+func (rc *rpmCounter) hit(limit uint32, interval time.Duration, now time.Time) bool {
+	rc.count++
+	if rc.count <= limit {
+		return false
+	}
+	if now.Sub(rc.start) < interval {
+		return true
+	}
+	rc.count = 0
+	rc.start = now
+	return false
+}
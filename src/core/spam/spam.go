@@ -0,0 +1,483 @@
+package spam
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//检测配置，各信号的得分为0时不检测该信号，其他零值使用默认值
+type Config struct {
+	//同一玩家在窗口内发送相同消息的次数达到 RepeatCount
+	RepeatWindow time.Duration
+	RepeatCount  int
+	RepeatScore  float64
+
+	//窗口内同一房间至少 SwarmUsers 个玩家发送相似消息(机器人刷屏)
+	SwarmWindow time.Duration
+	SwarmUsers  int
+	//相似消息的最低相似度(相邻两个字符切分的 Jaccard 系数)
+	SwarmSimilarity float64
+	//参与相似比较的最少字数，过短的消息(如"哈哈")不比较
+	SwarmMinLen int
+	SwarmScore  float64
+
+	//链接数达到 MaxLinks，或链接字数占比达到 LinkRatio
+	MaxLinks  int
+	LinkRatio float64
+	LinkScore float64
+
+	//大小写字母不少于 CapsMinLetters 且大写占比达到 CapsRatio
+	CapsRatio      float64
+	CapsMinLetters int
+	CapsScore      float64
+
+	//同一字符连续 FloodRun 次，或表情符号达到 FloodEmoji 个
+	FloodRun   int
+	FloodEmoji int
+	FloodScore float64
+
+	//登录不足 NewAge 的玩家在 NewWindow 内发言超过 NewBurst 条
+	NewAge    time.Duration
+	NewWindow time.Duration
+	NewBurst  int
+	NewScore  float64
+}
+
+//补全默认值
+func (c *Config) init() error {
+	if c.RepeatWindow < 0 || c.SwarmWindow < 0 || c.NewAge < 0 || c.NewWindow < 0 ||
+		c.RepeatCount < 0 || c.SwarmUsers < 0 || c.SwarmSimilarity < 0 || c.SwarmMinLen < 0 ||
+		c.MaxLinks < 0 || c.LinkRatio < 0 || c.CapsRatio < 0 || c.CapsMinLetters < 0 ||
+		c.FloodRun < 0 || c.FloodEmoji < 0 || c.NewBurst < 0 {
+		return fmt.Errorf("negative spam config")
+	}
+	if c.RepeatWindow == 0 {
+		c.RepeatWindow = time.Minute
+	}
+	if c.RepeatCount == 0 {
+		c.RepeatCount = 3
+	}
+	if c.SwarmWindow == 0 {
+		c.SwarmWindow = time.Minute
+	}
+	if c.SwarmUsers == 0 {
+		c.SwarmUsers = 3
+	}
+	if c.SwarmSimilarity == 0 {
+		c.SwarmSimilarity = 0.6
+	}
+	if c.SwarmMinLen == 0 {
+		c.SwarmMinLen = 8
+	}
+	if c.MaxLinks == 0 {
+		c.MaxLinks = 3
+	}
+	if c.LinkRatio == 0 {
+		c.LinkRatio = 0.6
+	}
+	if c.CapsRatio == 0 {
+		c.CapsRatio = 0.7
+	}
+	if c.CapsMinLetters == 0 {
+		c.CapsMinLetters = 12
+	}
+	if c.FloodRun == 0 {
+		c.FloodRun = 12
+	}
+	if c.FloodEmoji == 0 {
+		c.FloodEmoji = 10
+	}
+	if c.NewAge == 0 {
+		c.NewAge = time.Minute
+	}
+	if c.NewWindow == 0 {
+		c.NewWindow = 10 * time.Second
+	}
+	if c.NewBurst == 0 {
+		c.NewBurst = 5
+	}
+	return nil
+}
+
+//待检测的消息
+type Message struct {
+	//发送者，通常为会话id
+	UserID int64
+	//发送者所在房间，相似消息只在同一房间内比较
+	RoomID int64
+	Text   string
+	//发送者的登录时间，零值不检测新玩家
+	LoginTime time.Time
+	Now       time.Time
+}
+
+//检测结果
+type Verdict struct {
+	//命中信号的得分之和
+	Score float64
+	//命中的信号说明
+	Reasons []string
+}
+
+func (v *Verdict) hit(score float64, format string, args ...interface{}) {
+	v.Score += score
+	v.Reasons = append(v.Reasons, fmt.Sprintf(format, args...))
+}
+
+//每个玩家保留的最近发言记录数
+const userHistory = 32
+
+//每个房间相似比较保留的最近消息数
+const swarmHistory = 512
+
+//玩家发言记录按玩家分片，减少并发检测时的锁竞争
+const userShards = 16
+
+//玩家的最近发言
+type userState struct {
+	//最近消息的规范化内容哈希
+	texts []uint64
+	times []time.Time
+	last  time.Time
+}
+
+//消息指纹
+type fingerprint struct {
+	userID int64
+	//排序后的相邻两个字符的哈希
+	shingles []uint64
+	time     time.Time
+}
+
+//一个分片的玩家发言记录
+type userShard struct {
+	sync.Mutex
+	users     map[int64]*userState
+	lastSweep time.Time
+}
+
+//房间最近消息指纹的环形队列
+type swarmRing struct {
+	sync.Mutex
+	recent [swarmHistory]fingerprint
+	pos    int
+}
+
+//垃圾消息检测引擎，允许并发调用
+type Engine struct {
+	conf Config
+
+	shards [userShards]userShard
+	//各房间的最近消息指纹
+	ringLock sync.RWMutex
+	rings    map[int64]*swarmRing
+}
+
+func NewEngine(conf Config) (*Engine, error) {
+	if err := conf.init(); err != nil {
+		return nil, err
+	}
+	e := &Engine{
+		conf:  conf,
+		rings: make(map[int64]*swarmRing),
+	}
+	for i := range e.shards {
+		e.shards[i].users = make(map[int64]*userState)
+	}
+	return e, nil
+}
+
+func (e *Engine) shard(userID int64) *userShard {
+	return &e.shards[uint64(userID)%userShards]
+}
+
+//房间的最近消息指纹，不存在时创建
+func (e *Engine) ring(roomID int64) *swarmRing {
+	e.ringLock.RLock()
+	ring := e.rings[roomID]
+	e.ringLock.RUnlock()
+	if ring != nil {
+		return ring
+	}
+	e.ringLock.Lock()
+	defer e.ringLock.Unlock()
+	if ring = e.rings[roomID]; ring == nil {
+		ring = &swarmRing{}
+		e.rings[roomID] = ring
+	}
+	return ring
+}
+
+//补全默认值后的配置
+func (e *Engine) Config() Config {
+	return e.conf
+}
+
+//检测消息并记录发言，返回命中的信号和得分
+func (e *Engine) Check(msg *Message) *Verdict {
+	v := &Verdict{}
+	conf := &e.conf
+	if conf.LinkScore > 0 {
+		if links, ratio := linkDensity(msg.Text); links >= conf.MaxLinks || (links > 0 && ratio >= conf.LinkRatio) {
+			v.hit(conf.LinkScore, "links:%d(%.0f%%)", links, ratio*100)
+		}
+	}
+	if conf.CapsScore > 0 {
+		if letters, ratio := capsRatio(msg.Text); letters >= conf.CapsMinLetters && ratio >= conf.CapsRatio {
+			v.hit(conf.CapsScore, "caps:%.0f%%", ratio*100)
+		}
+	}
+	if conf.FloodScore > 0 {
+		if run, emoji := floods(msg.Text); run >= conf.FloodRun {
+			v.hit(conf.FloodScore, "flood run:%d", run)
+		} else if emoji >= conf.FloodEmoji {
+			v.hit(conf.FloodScore, "flood emoji:%d", emoji)
+		}
+	}
+
+	e.checkUser(msg, v)
+	e.checkSwarm(msg, v)
+	return v
+}
+
+//检测同一玩家的重复消息和新玩家刷屏，并记录发言
+func (e *Engine) checkUser(msg *Message, v *Verdict) {
+	conf := &e.conf
+	shard := e.shard(msg.UserID)
+	shard.Lock()
+	defer shard.Unlock()
+	e.sweep(shard, msg.Now)
+	user := shard.users[msg.UserID]
+	if user == nil {
+		user = &userState{}
+		shard.users[msg.UserID] = user
+	}
+	//只有表情和标点的消息按原文比较
+	text := normalize(msg.Text, false)
+	if text == "" {
+		text = msg.Text
+	}
+	textHash := fnvHash(text)
+	if conf.RepeatScore > 0 {
+		count := 1
+		for i, t := range user.times {
+			if msg.Now.Sub(t) < conf.RepeatWindow && user.texts[i] == textHash {
+				count++
+			}
+		}
+		if count >= conf.RepeatCount {
+			v.hit(conf.RepeatScore, "repeat:%d/%s", count, conf.RepeatWindow)
+		}
+	}
+	if conf.NewScore > 0 && !msg.LoginTime.IsZero() && msg.Now.Sub(msg.LoginTime) < conf.NewAge {
+		count := 1
+		for _, t := range user.times {
+			if msg.Now.Sub(t) < conf.NewWindow {
+				count++
+			}
+		}
+		if count > conf.NewBurst {
+			v.hit(conf.NewScore, "new user burst:%d/%s", count, conf.NewWindow)
+		}
+	}
+	if len(user.times) >= userHistory {
+		copy(user.texts, user.texts[1:])
+		copy(user.times, user.times[1:])
+		user.texts = user.texts[:userHistory-1]
+		user.times = user.times[:userHistory-1]
+	}
+	user.texts = append(user.texts, textHash)
+	user.times = append(user.times, msg.Now)
+	user.last = msg.Now
+}
+
+//检测同一房间内多个玩家发送的相似消息，并记录消息指纹
+func (e *Engine) checkSwarm(msg *Message, v *Verdict) {
+	conf := &e.conf
+	swarm := normalize(msg.Text, true)
+	if conf.SwarmScore <= 0 || utf8.RuneCountInString(swarm) < conf.SwarmMinLen {
+		return
+	}
+	shingles := shingle(swarm)
+	ring := e.ring(msg.RoomID)
+	ring.Lock()
+	defer ring.Unlock()
+	users := make(map[int64]struct{})
+	for i := range ring.recent {
+		fp := &ring.recent[i]
+		if fp.userID == msg.UserID || fp.time.IsZero() || msg.Now.Sub(fp.time) >= conf.SwarmWindow {
+			continue
+		}
+		if _, ok := users[fp.userID]; !ok && jaccard(fp.shingles, shingles) >= conf.SwarmSimilarity {
+			users[fp.userID] = struct{}{}
+		}
+	}
+	if len(users)+1 >= conf.SwarmUsers {
+		v.hit(conf.SwarmScore, "swarm:%d users", len(users)+1)
+	}
+	ring.recent[ring.pos] = fingerprint{userID: msg.UserID, shingles: shingles, time: msg.Now}
+	ring.pos = (ring.pos + 1) % swarmHistory
+}
+
+//移除玩家的发言记录，玩家下线时调用
+func (e *Engine) Forget(userID int64) {
+	shard := e.shard(userID)
+	shard.Lock()
+	defer shard.Unlock()
+	delete(shard.users, userID)
+}
+
+//每分钟清理一次分片中长时间未发言的玩家，只允许在持有分片锁时调用
+func (e *Engine) sweep(shard *userShard, now time.Time) {
+	if now.Sub(shard.lastSweep) < time.Minute {
+		return
+	}
+	shard.lastSweep = now
+	keep := e.conf.RepeatWindow
+	if e.conf.NewWindow > keep {
+		keep = e.conf.NewWindow
+	}
+	for userID, user := range shard.users {
+		if now.Sub(user.last) >= keep {
+			delete(shard.users, userID)
+		}
+	}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*\.(com|net|org|io|cn|ru|xyz|top|info|cc|me|ly|gg|link|site|club|vip)\b\S*`)
+
+//链接数和链接字数占比
+func linkDensity(text string) (int, float64) {
+	total := utf8.RuneCountInString(strings.Join(strings.Fields(text), ""))
+	if total == 0 {
+		return 0, 0
+	}
+	links := linkPattern.FindAllString(text, -1)
+	size := 0
+	for _, link := range links {
+		size += utf8.RuneCountInString(link)
+	}
+	return len(links), float64(size) / float64(total)
+}
+
+//大小写字母数和大写占比
+func capsRatio(text string) (int, float64) {
+	letters, upper := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+			letters++
+		case unicode.IsLower(r):
+			letters++
+		}
+	}
+	if letters == 0 {
+		return 0, 0
+	}
+	return letters, float64(upper) / float64(letters)
+}
+
+//表情符号
+func isEmoji(r rune) bool {
+	return (r >= 0x1f000 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf) || unicode.Is(unicode.So, r)
+}
+
+//同一字符(空白除外)的最长连续次数和表情符号数
+func floods(text string) (maxRun, emoji int) {
+	var last rune = -1
+	run := 0
+	for _, r := range text {
+		if isEmoji(r) {
+			emoji++
+		}
+		if unicode.IsSpace(r) {
+			last, run = -1, 0
+			continue
+		}
+		if r == last {
+			run++
+		} else {
+			last, run = r, 1
+		}
+		if run > maxRun {
+			maxRun = run
+		}
+	}
+	return
+}
+
+//规范化消息，只保留小写的字母和数字
+//	loose: 同时去掉数字和连续重复的字符，用于识别刷屏机器人添加的随机后缀
+func normalize(text string, loose bool) string {
+	var sb strings.Builder
+	sb.Grow(len(text))
+	var last rune = -1
+	for _, r := range text {
+		if !unicode.IsLetter(r) && (loose || !unicode.IsNumber(r)) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if loose && r == last {
+			continue
+		}
+		last = r
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func fnvHash(s string) uint64 {
+	const prime = 1099511628211
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime
+	}
+	return h
+}
+
+//按相邻两个字符切分，返回去重排序后的哈希
+func shingle(text string) []uint64 {
+	runes := []rune(text)
+	hashes := make([]uint64, 0, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		hashes = append(hashes, fnvHash(string(runes[i:i+2])))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	n := 0
+	for i, h := range hashes {
+		if i == 0 || h != hashes[n-1] {
+			hashes[n] = h
+			n++
+		}
+	}
+	return hashes[:n]
+}
+
+//两个排序集合的 Jaccard 系数
+func jaccard(a, b []uint64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	same := 0
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			same++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return float64(same) / float64(len(a)+len(b)-same)
+}
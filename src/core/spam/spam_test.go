@@ -0,0 +1,114 @@
+package spam
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEngine(t *testing.T) *Engine {
+	e, err := NewEngine(Config{
+		RepeatScore: 1,
+		SwarmScore:  1,
+		LinkScore:   1,
+		CapsScore:   1,
+		FloodScore:  1,
+		NewScore:    1,
+	})
+	require.NoError(t, err)
+	return e
+}
+
+func TestEngine_Content(t *testing.T) {
+	e := newTestEngine(t)
+	now := time.Now()
+	check := func(text string) *Verdict {
+		return e.Check(&Message{UserID: 1, Text: text, Now: now})
+	}
+	require.Zero(t, check("今天天气不错，一起去 github.com 看看吗").Score)
+	require.Equal(t, []string{"links:3(100%)"}, check("http://a.cn/x www.b.com c.xyz").Reasons)
+	require.Equal(t, []string{"links:1(97%)"}, check("看 https://spam.example.com/free").Reasons)
+	require.Equal(t, []string{"caps:100%"}, check("BUY CHEAP GOLD NOW").Reasons)
+	require.Zero(t, check("I like NASA and the USA").Score)
+	require.Equal(t, []string{"flood run:15"}, check("哈"+strings.Repeat("!", 15)).Reasons)
+	require.Equal(t, []string{"flood emoji:10"}, check(strings.Repeat("😀🎉", 5)).Reasons)
+	require.Zero(t, check("a a a a a a a a a a a a a a a").Score)
+}
+
+func TestEngine_Repeat(t *testing.T) {
+	e := newTestEngine(t)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		require.Zero(t, e.Check(&Message{UserID: 1, Text: "hello world", Now: now}).Score)
+	}
+	//大小写和标点不同也算重复
+	require.Equal(t, []string{"repeat:3/1m0s"}, e.Check(&Message{UserID: 1, Text: "Hello, World!", Now: now}).Reasons)
+	require.Zero(t, e.Check(&Message{UserID: 2, Text: "hello world", Now: now}).Score)
+	//超过窗口后不再计数
+	require.Zero(t, e.Check(&Message{UserID: 1, Text: "hello world", Now: now.Add(2 * time.Minute)}).Score)
+	e.Forget(1)
+	require.Empty(t, e.shard(1).users[1])
+}
+
+func TestEngine_Swarm(t *testing.T) {
+	e := newTestEngine(t)
+	now := time.Now()
+	require.Zero(t, e.Check(&Message{UserID: 1, Text: "buy cheap gold at goldshop 123", Now: now}).Score)
+	require.Zero(t, e.Check(&Message{UserID: 2, Text: "BUY cheap gold at goldshop!! 456", Now: now}).Score)
+	v := e.Check(&Message{UserID: 3, Text: "buy cheaap gold at goldshop 789", Now: now})
+	require.Equal(t, []string{"swarm:3 users"}, v.Reasons)
+	//改动个别词的相似消息
+	require.Zero(t, e.Check(&Message{UserID: 10, Text: "join my server for free nitro giveaway today", Now: now}).Score)
+	require.Zero(t, e.Check(&Message{UserID: 11, Text: "join our server for free nitro giveaway today", Now: now}).Score)
+	require.Equal(t, []string{"swarm:3 users"}, e.Check(&Message{UserID: 12, Text: "free nitro giveaway, join my server today", Now: now}).Reasons)
+	//短消息和不相似的消息不计入
+	for id := int64(4); id < 8; id++ {
+		require.Zero(t, e.Check(&Message{UserID: id, Text: "哈哈哈", Now: now}).Score)
+	}
+	require.Zero(t, e.Check(&Message{UserID: 8, Text: "does anyone know when the event starts", Now: now}).Score)
+	require.Zero(t, e.Check(&Message{UserID: 9, Text: "buy cheap gold at goldshop", Now: now.Add(time.Hour)}).Score)
+	//其他房间的相似消息不计入
+	require.Zero(t, e.Check(&Message{UserID: 13, RoomID: 2, Text: "buy cheap gold at goldshop 000", Now: now}).Score)
+	require.Zero(t, e.Check(&Message{UserID: 14, RoomID: 2, Text: "buy cheap gold at goldshop 111", Now: now}).Score)
+}
+
+//多个房间并发检测，使用 go test -race 检测
+func TestEngine_Concurrent(t *testing.T) {
+	e := newTestEngine(t)
+	now := time.Now()
+	wg := &sync.WaitGroup{}
+	for room := int64(1); room <= 4; room++ {
+		wg.Add(1)
+		go func(room int64) {
+			defer wg.Done()
+			for i := int64(0); i < 200; i++ {
+				userID := room*1000 + i%10
+				e.Check(&Message{UserID: userID, RoomID: room, Text: fmt.Sprintf("buy cheap gold at goldshop %d", i), Now: now})
+				if i%50 == 0 {
+					e.Forget(userID)
+				}
+			}
+		}(room)
+	}
+	wg.Wait()
+	require.Len(t, e.rings, 4)
+}
+
+func TestEngine_NewUserBurst(t *testing.T) {
+	e := newTestEngine(t)
+	now := time.Now()
+	login := now.Add(-10 * time.Second)
+	for i := 0; i < 5; i++ {
+		require.Zero(t, e.Check(&Message{UserID: 1, Text: strings.Repeat("x", i+1), LoginTime: login, Now: now}).Score)
+	}
+	require.Equal(t, []string{"new user burst:6/10s"}, e.Check(&Message{UserID: 1, Text: "hi", LoginTime: login, Now: now}).Reasons)
+	//老玩家不限制
+	require.Zero(t, e.Check(&Message{UserID: 1, Text: "hey", LoginTime: now.Add(-time.Hour), Now: now}).Score)
+
+	_, err := NewEngine(Config{RepeatCount: -1})
+	require.Error(t, err)
+}
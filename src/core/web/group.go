@@ -0,0 +1,31 @@
+package web
+
+import "net/http"
+
+//路由分组，分组内的路由使用相同的前缀和过滤器
+type Group struct {
+	s      *Server
+	prefix string
+	filter func(*Context) error
+}
+
+//创建路由分组 filter:为空不过滤，返回错误则拒绝该请求
+func (s *Server) Group(prefix string, filter func(*Context) error) *Group {
+	return &Group{s: s, prefix: prefix, filter: filter}
+}
+
+func (g *Group) Get(route string, handler interface{}) {
+	g.s.addFilterRoute(g.prefix+route, "GET", handler, g.filter)
+}
+
+func (g *Group) Post(route string, handler interface{}) {
+	g.s.addFilterRoute(g.prefix+route, "POST", handler, g.filter)
+}
+
+func (g *Group) Match(route string, handler interface{}, method string) {
+	g.s.addFilterRoute(g.prefix+route, method, handler, g.filter)
+}
+
+func (g *Group) Handler(route string, method string, httpHandler http.Handler) {
+	g.s.addFilterRoute(g.prefix+route, method, httpHandler, g.filter)
+}
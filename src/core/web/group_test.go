@@ -0,0 +1,43 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/gerror"
+)
+
+func TestGroup_Filter(t *testing.T) {
+	server := NewServer()
+	server.initServer()
+	admin := server.Group("/admin", func(ctx *Context) error {
+		if ctx.Param("token") != "secret" {
+			return gerror.NewError(gerror.SERVER_ACCESS_REFUSED, "admin token required")
+		}
+		return nil
+	})
+	admin.Get("/rooms/([1-9]\\d*)", func(ctx *Context, room string) (interface{}, error) {
+		return "room:" + room, nil
+	})
+	admin.Handler("/raw", "GET", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("raw"))
+	}))
+	server.Get("/open", func(ctx *Context) (interface{}, error) {
+		return nil, errors.New("open err")
+	})
+
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		return w.Body.String()
+	}
+	require.Equal(t, `"room:2"`, get("/admin/rooms/2?token=secret"))
+	require.Contains(t, get("/admin/rooms/2"), "admin token required")
+	require.Equal(t, "raw", get("/admin/raw?token=secret"))
+	require.False(t, strings.Contains(get("/admin/raw"), "raw"))
+	require.Contains(t, get("/open"), "open err")
+}
@@ -139,6 +139,8 @@ type route struct {
 	httpHandler    http.Handler
 	contextHandler ContextHandler
 	svc            *Service
+	//路由过滤器，返回错误则不再执行处理方法
+	filter func(*Context) error
 }
 
 type Service struct {
@@ -215,6 +217,10 @@ func InvokeService(handler interface{}, methodName string) *Service {
 }
 
 func (s *Server) addRoute(r string, method string, handler interface{}) {
+	s.addFilterRoute(r, method, handler, nil)
+}
+
+func (s *Server) addFilterRoute(r string, method string, handler interface{}, filter func(*Context) error) {
 	cr, err := regexp.Compile(r)
 	if err != nil {
 		log.Errorf("add route err,regex:%q,err:%v", r, err)
@@ -222,15 +228,15 @@ func (s *Server) addRoute(r string, method string, handler interface{}) {
 	}
 	switch v := handler.(type) {
 	case http.Handler:
-		s.routes = append(s.routes, route{r: r, cr: cr, method: method, httpHandler: v})
+		s.routes = append(s.routes, route{r: r, cr: cr, method: method, filter: filter, httpHandler: v})
 	case ContextHandler:
-		s.routes = append(s.routes, route{r: r, cr: cr, method: method, contextHandler: v})
+		s.routes = append(s.routes, route{r: r, cr: cr, method: method, filter: filter, contextHandler: v})
 	case *Service:
-		s.routes = append(s.routes, route{r: r, cr: cr, method: method, svc: v})
+		s.routes = append(s.routes, route{r: r, cr: cr, method: method, filter: filter, svc: v})
 	case reflect.Value:
-		s.routes = append(s.routes, route{r: r, cr: cr, method: method, handler: v})
+		s.routes = append(s.routes, route{r: r, cr: cr, method: method, filter: filter, handler: v})
 	default:
-		s.routes = append(s.routes, route{r: r, cr: cr, method: method, handler: reflect.ValueOf(handler)})
+		s.routes = append(s.routes, route{r: r, cr: cr, method: method, filter: filter, handler: reflect.ValueOf(handler)})
 	}
 	log.Debugf("register http service handler:%s,method:%s", r, method)
 }
@@ -560,6 +566,12 @@ func (s *Server) routeHandler(req *http.Request, w http.ResponseWriter) (unused
 			continue
 		}
 
+		if route.filter != nil {
+			if err := route.filter(&ctx); err != nil {
+				s.abortError(&ctx, err)
+				return
+			}
+		}
 		if route.httpHandler != nil {
 			unused = &route
 			// We can not handle custom http handlers here, give back to the caller.
@@ -600,31 +612,7 @@ func (s *Server) routeHandler(req *http.Request, w http.ResponseWriter) (unused
 			ret, err = s.safelyCall(route.handler, args)
 		}
 		if err != nil {
-			stt := http.StatusInternalServerError
-			switch err.(type) {
-			case *gerror.SysError:
-				//				if err.(*gerror.SysError).Code == gerror.OK {
-				stt = http.StatusOK
-				//				}
-			case error:
-				err = gerror.New(gerror.SERVER_CMSG_ERROR, err.(error))
-			default:
-				err = gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("%v", err))
-			}
-			var bb []byte
-			var err1 error
-			if !IndentJson {
-				bb, err1 = json.Marshal(err)
-			} else {
-				bb, err1 = json.MarshalIndent(err, "", " ")
-			}
-			if err1 == nil {
-				ctx.SetHeader("Content-Type", "text/plain; charset=utf-8", true)
-				ctx.SetHeader("Content-Length", strconv.Itoa(len(bb)), true)
-				ctx.AbortBytes(stt, bb)
-			} else {
-				ctx.Abort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
-			}
+			s.abortError(&ctx, err)
 			return
 		}
 		if len(ret) == 0 {
@@ -682,6 +670,35 @@ func (s *Server) routeHandler(req *http.Request, w http.ResponseWriter) (unused
 	return
 }
 
+//输出处理方法的错误
+func (s *Server) abortError(ctx *Context, err interface{}) {
+	stt := http.StatusInternalServerError
+	switch err.(type) {
+	case *gerror.SysError:
+		//				if err.(*gerror.SysError).Code == gerror.OK {
+		stt = http.StatusOK
+		//				}
+	case error:
+		err = gerror.New(gerror.SERVER_CMSG_ERROR, err.(error))
+	default:
+		err = gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("%v", err))
+	}
+	var bb []byte
+	var err1 error
+	if !IndentJson {
+		bb, err1 = json.Marshal(err)
+	} else {
+		bb, err1 = json.MarshalIndent(err, "", " ")
+	}
+	if err1 == nil {
+		ctx.SetHeader("Content-Type", "text/plain; charset=utf-8", true)
+		ctx.SetHeader("Content-Length", strconv.Itoa(len(bb)), true)
+		ctx.AbortBytes(stt, bb)
+	} else {
+		ctx.Abort(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
 func asBytes(buf []byte, rv reflect.Value) (b []byte, ok bool) {
 	switch rv.Kind() {
 	case reflect.Ptr:
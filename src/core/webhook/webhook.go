@@ -0,0 +1,519 @@
+package webhook
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/fileutil"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/metrics"
+)
+
+//请求头
+const (
+	HeaderEvent     = "X-IM-Event"
+	HeaderDelivery  = "X-IM-Delivery"
+	HeaderAttempt   = "X-IM-Attempt"
+	HeaderTimestamp = "X-IM-Timestamp"
+	//签名 sha256=hex(hmac_sha256(secret, 时间戳 + "." + 请求体))
+	HeaderSignature = "X-IM-Signature"
+)
+
+//死信文件名，每行一条投递失败的记录
+const DeadLetterFile = "dead.jsonl"
+
+var (
+	deliveryTotal = metrics.NewCounterVec("im_webhook_deliveries_total", "Webhook delivery attempts by result.", "result")
+	deliveryOK    = deliveryTotal.With("ok")
+	deliveryRetry = deliveryTotal.With("retry")
+	deliveryDead  = deliveryTotal.With("dead")
+	//待投递的数量超过上限时丢弃
+	deliveryDropped = deliveryTotal.With("dropped")
+)
+
+var ErrSpoolFull = errors.New("webhook spool full")
+
+//一次投递，落盘保存直到成功或进入死信文件
+type Delivery struct {
+	ID    string          `json:"id"`
+	URL   string          `json:"url"`
+	Event string          `json:"event"`
+	Body  json.RawMessage `json:"body"`
+	//已尝试次数
+	Attempts int `json:"attempts"`
+	//下次尝试时间 unix毫秒
+	NextTry int64 `json:"nextTry"`
+	//最后一次失败原因
+	LastError string `json:"lastError,omitempty"`
+
+	//所在的批量落盘文件，单独落盘后为空
+	batch *spoolBatch
+}
+
+//批量加入投递队列的一项
+type Entry struct {
+	URL   string
+	Event string
+	Body  []byte
+}
+
+//批量落盘文件，其中的投递全部结束或单独落盘后删除
+type spoolBatch struct {
+	file string
+	left int32
+}
+
+//计算签名
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//webhook投递，待投递的请求保存在磁盘上，失败后按指数退避重试，超过次数写入死信文件
+type Dispatcher struct {
+	//落盘目录
+	Dir string
+	//url对应的签名密钥
+	Secrets map[string]string
+	//最多尝试次数
+	MaxAttempts int
+	//最多待投递数量
+	MaxPending int
+	//并发投递数
+	Workers int
+	//首次重试的等待时间，之后每次翻倍
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Client     *http.Client
+
+	mu      sync.Mutex
+	queue   deliveryQueue
+	pending int
+	wake    chan struct{}
+	seq     int64
+	deadMu  sync.Mutex
+}
+
+//创建投递器并加载上次未完成的投递
+func NewDispatcher(dir string, secrets map[string]string, maxAttempts int) (*Dispatcher, error) {
+	d := &Dispatcher{
+		Dir:         dir,
+		Secrets:     secrets,
+		MaxAttempts: maxAttempts,
+		MaxPending:  10000,
+		Workers:     4,
+		MinBackoff:  time.Second,
+		MaxBackoff:  10 * time.Minute,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		wake:        make(chan struct{}, 1),
+	}
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = 8
+	}
+	if err := os.MkdirAll(d.pendingDir(), 0755); err != nil {
+		return nil, err
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Dispatcher) pendingDir() string {
+	return filepath.Join(d.Dir, "pending")
+}
+
+func (d *Dispatcher) pendingFile(id string) string {
+	return filepath.Join(d.pendingDir(), id+".json")
+}
+
+func (d *Dispatcher) batchFile(id string) string {
+	return filepath.Join(d.pendingDir(), id+".jsonl")
+}
+
+func (d *Dispatcher) load() error {
+	files, err := ioutil.ReadDir(d.pendingDir())
+	if err != nil {
+		return err
+	}
+	//重试时会单独落盘，先加载单独落盘的投递，批量文件中相同的记录较旧
+	seen := make(map[string]bool)
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		name := filepath.Join(d.pendingDir(), fi.Name())
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		delivery := &Delivery{}
+		if err = json.Unmarshal(data, delivery); err != nil {
+			log.Warnf("webhook bad spool file:%s,err:%v", name, err)
+			os.Remove(name)
+			continue
+		}
+		seen[delivery.ID] = true
+		heap.Push(&d.queue, delivery)
+		d.pending++
+	}
+	for _, fi := range files {
+		if fi.IsDir() || !strings.HasSuffix(fi.Name(), ".jsonl") {
+			continue
+		}
+		name := filepath.Join(d.pendingDir(), fi.Name())
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		batch := &spoolBatch{file: name}
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+			delivery := &Delivery{}
+			if err = json.Unmarshal(line, delivery); err != nil {
+				log.Warnf("webhook bad spool line:%s,err:%v", name, err)
+				continue
+			}
+			if seen[delivery.ID] {
+				continue
+			}
+			seen[delivery.ID] = true
+			delivery.batch = batch
+			batch.left++
+			heap.Push(&d.queue, delivery)
+			d.pending++
+		}
+		if batch.left == 0 {
+			os.Remove(name)
+		}
+	}
+	if d.pending > 0 {
+		log.Infof("webhook load pending deliveries:%d", d.pending)
+	}
+	return nil
+}
+
+//待投递数量
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.pending
+}
+
+//落盘后加入投递队列
+func (d *Dispatcher) Enqueue(url, event string, body []byte) error {
+	return d.EnqueueBatch([]Entry{{URL: url, Event: event, Body: body}})
+}
+
+//批量落盘后加入投递队列，多项写入同一个文件只同步一次磁盘，超过待投递上限的部分丢弃并返回ErrSpoolFull
+func (d *Dispatcher) EnqueueBatch(entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	n := len(entries)
+	if d.MaxPending > 0 && d.pending+n > d.MaxPending {
+		n = d.MaxPending - d.pending
+		if n < 0 {
+			n = 0
+		}
+	}
+	d.pending += n
+	d.mu.Unlock()
+	var err error
+	if dropped := len(entries) - n; dropped > 0 {
+		deliveryDropped.Add(int64(dropped))
+		err = ErrSpoolFull
+	}
+	if n == 0 {
+		return err
+	}
+	now := time.Now()
+	deliveries := make([]*Delivery, n)
+	for i, entry := range entries[:n] {
+		deliveries[i] = &Delivery{
+			ID:      fmt.Sprintf("%d-%d", now.UnixNano(), atomic.AddInt64(&d.seq, 1)),
+			URL:     entry.URL,
+			Event:   entry.Event,
+			Body:    entry.Body,
+			NextTry: now.UnixNano() / int64(time.Millisecond),
+		}
+	}
+	var saveErr error
+	if n == 1 {
+		saveErr = d.save(deliveries[0])
+	} else {
+		saveErr = d.saveBatch(deliveries)
+	}
+	if saveErr != nil {
+		d.mu.Lock()
+		d.pending -= n
+		d.mu.Unlock()
+		return saveErr
+	}
+	for _, delivery := range deliveries {
+		d.push(delivery)
+	}
+	return err
+}
+
+func (d *Dispatcher) save(delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFileAtomic(d.pendingFile(delivery.ID), data, 0644)
+}
+
+func (d *Dispatcher) saveBatch(deliveries []*Delivery) error {
+	var buf bytes.Buffer
+	for _, delivery := range deliveries {
+		data, err := json.Marshal(delivery)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	batch := &spoolBatch{file: d.batchFile(deliveries[0].ID), left: int32(len(deliveries))}
+	if err := fileutil.WriteFileAtomic(batch.file, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	for _, delivery := range deliveries {
+		delivery.batch = batch
+	}
+	return nil
+}
+
+//投递结束或已单独落盘，批量文件中的投递全部释放后删除该文件
+func (d *Dispatcher) release(delivery *Delivery) {
+	batch := delivery.batch
+	if batch == nil {
+		return
+	}
+	delivery.batch = nil
+	if atomic.AddInt32(&batch.left, -1) == 0 {
+		os.Remove(batch.file)
+	}
+}
+
+func (d *Dispatcher) push(delivery *Delivery) {
+	d.mu.Lock()
+	heap.Push(&d.queue, delivery)
+	d.mu.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+//开始投递直到ctx结束，未完成的投递留在磁盘上，重启后继续
+func (d *Dispatcher) Run(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+	work := make(chan *Delivery)
+	var workers sync.WaitGroup
+	for i := 0; i < d.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer log.PrintPanicStack()
+			for delivery := range work {
+				d.deliver(ctx, delivery)
+			}
+		}()
+	}
+	defer func() {
+		close(work)
+		workers.Wait()
+	}()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		delivery, wait := d.next(time.Now())
+		if delivery != nil {
+			select {
+			case work <- delivery:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+//取出到期的投递，没有则返回需要等待的时间
+func (d *Dispatcher) next(now time.Time) (*Delivery, time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.queue) == 0 {
+		return nil, time.Hour
+	}
+	ms := now.UnixNano() / int64(time.Millisecond)
+	if wait := d.queue[0].NextTry - ms; wait > 0 {
+		return nil, time.Duration(wait) * time.Millisecond
+	}
+	return heap.Pop(&d.queue).(*Delivery), 0
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) {
+	err := d.post(ctx, delivery)
+	if err == nil {
+		deliveryOK.Inc()
+		os.Remove(d.pendingFile(delivery.ID))
+		d.release(delivery)
+		d.done()
+		return
+	}
+	if ctx.Err() != nil {
+		//关服中断的投递不计入次数，重启后继续
+		return
+	}
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		deliveryDead.Inc()
+		log.Warnf("webhook delivery dead,id:%s,url:%s,event:%s,attempts:%d,err:%v", delivery.ID, delivery.URL, delivery.Event, delivery.Attempts, err)
+		if err = d.dead(delivery); err != nil {
+			log.Errorf("webhook write dead letter err:%v,id:%s", err, delivery.ID)
+		}
+		os.Remove(d.pendingFile(delivery.ID))
+		d.release(delivery)
+		d.done()
+		return
+	}
+	deliveryRetry.Inc()
+	backoff := d.backoff(delivery.Attempts)
+	delivery.NextTry = time.Now().Add(backoff).UnixNano() / int64(time.Millisecond)
+	log.Debugf("webhook delivery retry in %s,id:%s,url:%s,attempts:%d,err:%v", backoff, delivery.ID, delivery.URL, delivery.Attempts, err)
+	if err = d.save(delivery); err != nil {
+		//保留批量文件中的记录，重启后按旧的尝试次数继续
+		log.Errorf("webhook save spool err:%v,id:%s", err, delivery.ID)
+	} else {
+		d.release(delivery)
+	}
+	d.push(delivery)
+}
+
+func (d *Dispatcher) done() {
+	d.mu.Lock()
+	d.pending--
+	d.mu.Unlock()
+}
+
+//第n次失败后的等待时间，加上最多1/5的随机抖动
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	backoff := d.MinBackoff
+	for i := 1; i < attempts && backoff < d.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > d.MaxBackoff {
+		backoff = d.MaxBackoff
+	}
+	if jitter := int64(backoff / 5); jitter > 0 {
+		backoff += time.Duration(rand.Int63n(jitter))
+	}
+	return backoff
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery *Delivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(delivery.Attempts+1))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if secret := d.Secrets[delivery.URL]; secret != "" {
+		req.Header.Set(HeaderSignature, Sign(secret, timestamp, delivery.Body))
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+//追加到死信文件
+func (d *Dispatcher) dead(delivery *Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	d.deadMu.Lock()
+	defer d.deadMu.Unlock()
+	fi, err := os.OpenFile(filepath.Join(d.Dir, DeadLetterFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = fi.Write(append(data, '\n')); err != nil {
+		fi.Close()
+		return err
+	}
+	return fi.Close()
+}
+
+//按下次尝试时间排序的最小堆
+type deliveryQueue []*Delivery
+
+func (q deliveryQueue) Len() int           { return len(q) }
+func (q deliveryQueue) Less(i, j int) bool { return q[i].NextTry < q[j].NextTry }
+func (q deliveryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *deliveryQueue) Push(x interface{}) {
+	*q = append(*q, x.(*Delivery))
+}
+
+func (q *deliveryQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	delivery := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return delivery
+}
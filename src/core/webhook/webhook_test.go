@@ -0,0 +1,133 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/atomic"
+)
+
+func newTestDispatcher(t *testing.T, dir string, secrets map[string]string, maxAttempts int) *Dispatcher {
+	d, err := NewDispatcher(dir, secrets, maxAttempts)
+	require.NoError(t, err)
+	d.MinBackoff = 10 * time.Millisecond
+	d.MaxBackoff = 20 * time.Millisecond
+	return d
+}
+
+func runDispatcher(d *Dispatcher) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	go d.Run(ctx, wg)
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	var calls atomic.Int32
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//前两次失败
+		if calls.Inc() <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		timestamp, _ := strconv.ParseInt(req.Header.Get(HeaderTimestamp), 10, 64)
+		require.Equal(t, Sign("secret", timestamp, body), req.Header.Get(HeaderSignature))
+		require.Equal(t, "3", req.Header.Get(HeaderAttempt))
+		require.Equal(t, "join", req.Header.Get(HeaderEvent))
+		received <- string(body)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	d := newTestDispatcher(t, dir, map[string]string{server.URL: "secret"}, 5)
+	require.NoError(t, d.Enqueue(server.URL, "join", []byte(`{"type":"join"}`)))
+	files, _ := filepath.Glob(filepath.Join(dir, "pending", "*.json"))
+	require.Len(t, files, 1)
+
+	stop := runDispatcher(d)
+	defer stop()
+	select {
+	case body := <-received:
+		require.JSONEq(t, `{"type":"join"}`, body)
+	case <-time.After(3 * time.Second):
+		t.Fatal("delivery timeout")
+	}
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, time.Second, time.Millisecond)
+	files, _ = filepath.Glob(filepath.Join(dir, "pending", "*.json"))
+	require.Empty(t, files)
+}
+
+func TestDispatcher_DeadLetter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	//未运行时只落盘，重启后加载继续投递
+	d := newTestDispatcher(t, dir, nil, 2)
+	require.NoError(t, d.Enqueue(server.URL, "message", []byte(`{"type":"message"}`)))
+	d = newTestDispatcher(t, dir, nil, 2)
+	require.Equal(t, 1, d.Pending())
+
+	stop := runDispatcher(d)
+	defer stop()
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 3*time.Second, time.Millisecond)
+	data, err := ioutil.ReadFile(filepath.Join(dir, DeadLetterFile))
+	require.NoError(t, err)
+	dead := &Delivery{}
+	require.NoError(t, json.Unmarshal(data, dead))
+	require.Equal(t, 2, dead.Attempts)
+	require.Equal(t, "http status 500", dead.LastError)
+	require.JSONEq(t, `{"type":"message"}`, string(dead.Body))
+	_, err = os.Stat(filepath.Join(dir, "pending", dead.ID+".json"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestDispatcher_EnqueueBatch(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		//第一次失败，重试的投递单独落盘
+		if calls.Inc() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	d := newTestDispatcher(t, dir, nil, 5)
+	d.MaxPending = 3
+	entries := make([]Entry, 4)
+	for i := range entries {
+		entries[i] = Entry{URL: server.URL, Event: "message", Body: []byte(`{"type":"message"}`)}
+	}
+	require.Equal(t, ErrSpoolFull, d.EnqueueBatch(entries))
+	files, _ := filepath.Glob(filepath.Join(dir, "pending", "*"))
+	require.Len(t, files, 1)
+	require.Equal(t, ".jsonl", filepath.Ext(files[0]))
+
+	//重启后从批量文件加载
+	d = newTestDispatcher(t, dir, nil, 5)
+	require.Equal(t, 3, d.Pending())
+	stop := runDispatcher(d)
+	defer stop()
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 3*time.Second, time.Millisecond)
+	require.EqualValues(t, 4, calls.Load())
+	files, _ = filepath.Glob(filepath.Join(dir, "pending", "*"))
+	require.Empty(t, files)
+}
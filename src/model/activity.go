@@ -0,0 +1,244 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/fileutil"
+	"github.com/zxfonline/IMDemo/core/golangtrace/timeseries"
+	"github.com/zxfonline/IMDemo/core/log"
+)
+
+//房间活跃度时间序列的分辨率：分钟、小时、天
+var activityResolutions = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
+
+//每个分辨率保留的时间桶数量，小时级别可以覆盖7天
+const activityBuckets = 7*24 + 1
+
+//活跃度快照写入磁盘的间隔
+var ActivitySaveInterval = 10 * time.Minute
+
+//活跃度查询范围
+type ActivityRange struct {
+	//查询的时长
+	Span time.Duration
+	//每个数据点的时长
+	Step time.Duration
+}
+
+//支持的活跃度查询范围
+var ActivityRanges = map[string]ActivityRange{
+	"1h":  {Span: time.Hour, Step: time.Minute},
+	"24h": {Span: 24 * time.Hour, Step: time.Hour},
+	"7d":  {Span: 7 * 24 * time.Hour, Step: time.Hour},
+}
+
+//活跃度数据点
+type ActivityPoint struct {
+	//数据点的开始时间 unix秒
+	Time        int64   `json:"time"`
+	Messages    float64 `json:"messages"`
+	ActiveUsers float64 `json:"activeUsers"`
+	Joins       float64 `json:"joins"`
+}
+
+//房间活跃度统计，只允许在房间协程中访问
+type roomActivity struct {
+	//聊天消息数
+	messages *timeseries.TimeSeries
+	//每分钟发言的玩家数，小时和天的数据点取峰值
+	activeUsers *timeseries.TimeSeries
+	//进入房间的次数
+	joins *timeseries.TimeSeries
+	//当前分钟发言的玩家
+	speakers       map[string]struct{}
+	speakersMinute time.Time
+	lastSave       time.Time
+}
+
+func newRoomActivity() *roomActivity {
+	return &roomActivity{
+		messages:    timeseries.NewTimeSeriesWithResolutions(timeseries.NewFloat, activityResolutions, activityBuckets, nil),
+		activeUsers: timeseries.NewTimeSeriesWithResolutions(newMaxFloat, activityResolutions, activityBuckets, nil),
+		joins:       timeseries.NewTimeSeriesWithResolutions(timeseries.NewFloat, activityResolutions, activityBuckets, nil),
+		speakers:    make(map[string]struct{}),
+	}
+}
+
+//记录一条聊天消息
+func (ra *roomActivity) onMessage(userName string, now time.Time) {
+	one := timeseries.Float(1)
+	ra.messages.AddWithTime(&one, now)
+	if userName == "" {
+		return
+	}
+	if minute := now.Truncate(time.Minute); !minute.Equal(ra.speakersMinute) {
+		ra.speakersMinute = minute
+		ra.speakers = make(map[string]struct{})
+	}
+	if _, ok := ra.speakers[userName]; !ok {
+		ra.speakers[userName] = struct{}{}
+		//按峰值合并，当前分钟的数据点保留最终的发言人数
+		active := maxFloat(len(ra.speakers))
+		ra.activeUsers.AddWithTime(&active, now)
+	}
+}
+
+//记录一次进入房间
+func (ra *roomActivity) onJoin(now time.Time) {
+	one := timeseries.Float(1)
+	ra.joins.AddWithTime(&one, now)
+}
+
+//查询范围内的活跃度数据点
+func (ra *roomActivity) points(r ActivityRange, now time.Time) []*ActivityPoint {
+	num := int(r.Span / r.Step)
+	finish := now.Truncate(r.Step).Add(r.Step)
+	start := finish.Add(-r.Span)
+	messages := ra.messages.ComputeRange(start, finish, num)
+	activeUsers := ra.activeUsers.ComputeRange(start, finish, num)
+	joins := ra.joins.ComputeRange(start, finish, num)
+	points := make([]*ActivityPoint, num)
+	for i := range points {
+		points[i] = &ActivityPoint{
+			Time:        start.Add(time.Duration(i) * r.Step).Unix(),
+			Messages:    messages[i].(*timeseries.Float).Value(),
+			ActiveUsers: float64(*activeUsers[i].(*maxFloat)),
+			Joins:       joins[i].(*timeseries.Float).Value(),
+		}
+	}
+	return points
+}
+
+//活跃度快照文件
+type activitySnapshot struct {
+	RoomID      int64                `json:"roomID"`
+	Messages    *timeseries.Snapshot `json:"messages"`
+	ActiveUsers *timeseries.Snapshot `json:"activeUsers"`
+	Joins       *timeseries.Snapshot `json:"joins"`
+}
+
+func floatValue(o timeseries.Observable) float64 {
+	return o.(*timeseries.Float).Value()
+}
+
+func newFloatValue(v float64) timeseries.Observable {
+	f := timeseries.Float(v)
+	return &f
+}
+
+func maxFloatValue(o timeseries.Observable) float64 {
+	return float64(*o.(*maxFloat))
+}
+
+func newMaxFloatValue(v float64) timeseries.Observable {
+	f := maxFloat(v)
+	return &f
+}
+
+func (ra *roomActivity) save(roomID int64, file string) error {
+	data, err := json.Marshal(&activitySnapshot{
+		RoomID:      roomID,
+		Messages:    ra.messages.Export(floatValue),
+		ActiveUsers: ra.activeUsers.Export(maxFloatValue),
+		Joins:       ra.joins.Export(floatValue),
+	})
+	if err != nil {
+		return err
+	}
+	return fileutil.WriteFileAtomic(file, data, 0644)
+}
+
+//读取快照文件，文件不存在时忽略
+func (ra *roomActivity) load(roomID int64, file string) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var snapshot activitySnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	if snapshot.RoomID != roomID || snapshot.Messages == nil || snapshot.ActiveUsers == nil || snapshot.Joins == nil {
+		return fmt.Errorf("bad activity snapshot of room:%d", snapshot.RoomID)
+	}
+	restored := newRoomActivity()
+	if err = restored.messages.Import(snapshot.Messages, newFloatValue); err != nil {
+		return err
+	}
+	if err = restored.activeUsers.Import(snapshot.ActiveUsers, newMaxFloatValue); err != nil {
+		return err
+	}
+	if err = restored.joins.Import(snapshot.Joins, newFloatValue); err != nil {
+		return err
+	}
+	*ra = *restored
+	return nil
+}
+
+//取最大值的观测值，用于统计峰值
+type maxFloat float64
+
+func newMaxFloat() timeseries.Observable {
+	f := maxFloat(0)
+	return &f
+}
+
+//峰值不随时间比例缩放
+func (f *maxFloat) Multiply(ratio float64) {}
+
+func (f *maxFloat) Add(other timeseries.Observable) {
+	if o := *other.(*maxFloat); o > *f {
+		*f = o
+	}
+}
+
+func (f *maxFloat) Clear() { *f = 0 }
+
+func (f *maxFloat) CopyFrom(other timeseries.Observable) {
+	*f = *other.(*maxFloat)
+}
+
+//房间活跃度，range 为 ActivityRanges 中的查询范围
+func (cr *ChatRoom) Activity(rangeName string) ([]*ActivityPoint, error) {
+	r, ok := ActivityRanges[rangeName]
+	if !ok {
+		return nil, fmt.Errorf("unsupport range:%s", rangeName)
+	}
+	var points []*ActivityPoint
+	if err := cr.Query(func() {
+		points = cr.activity.points(r, time.Now())
+	}); err != nil {
+		return nil, err
+	}
+	return points, nil
+}
+
+//读取活跃度快照，需要在房间协程启动前调用
+func (cr *ChatRoom) LoadActivity() error {
+	if cr.ActivityFile == "" {
+		return nil
+	}
+	return cr.activity.load(cr.RoomID, cr.ActivityFile)
+}
+
+//定时保存活跃度快照，只允许在房间协程中调用
+func (cr *ChatRoom) saveActivity(force bool) {
+	defer log.PrintPanicStack()
+	if cr.ActivityFile == "" {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(cr.activity.lastSave) < ActivitySaveInterval {
+		return
+	}
+	cr.activity.lastSave = now
+	if err := cr.activity.save(cr.RoomID, cr.ActivityFile); err != nil {
+		log.Warnf("save room activity err:%v,room:%d,file:%s", err, cr.RoomID, cr.ActivityFile)
+	}
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/golangtrace"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+//聊天消息链路的采样跟踪间隔，每个房间每N条消息跟踪一条，<=0不跟踪
+var ChatTraceSampling int64 = 100
+
+//采样跟踪等待接收者写出消息的最长时间
+var ChatTraceTimeout = 10 * time.Second
+
+//采样跟踪在 /debug/requests 页面中的分类
+const ChatTraceFamily = "ChatMessage"
+
+//一条聊天消息分发后的写出跟踪
+type chatTrace struct {
+	fanoutTime time.Time
+	//尚未写出的接收者数量，重复回调使其小于0后忽略
+	remaining    int64
+	writeLatency *golangtrace.Histogram
+
+	mu sync.Mutex
+	//采样的跟踪，为空表示未采样或已结束
+	tr           golangtrace.Trace
+	first, last  time.Duration
+	writtenCount int64
+}
+
+//开始分发前记录排队耗时，并设置接收者写出回调，只允许在房间协程中调用
+func (cr *ChatRoom) traceFanout(message *session.NetPacket, recipients int) *chatTrace {
+	pt := message.Trace
+	pt.FanoutTime = time.Now()
+	m := cr.metrics
+	start := pt.EnqueueTime
+	if !message.ReceiveTime.IsZero() {
+		start = message.ReceiveTime
+		m.processLatency.Observe(micros(pt.EnqueueTime.Sub(message.ReceiveTime)))
+	}
+	m.queueLatency.Observe(micros(pt.FanoutTime.Sub(pt.EnqueueTime)))
+	ct := &chatTrace{
+		fanoutTime:   pt.FanoutTime,
+		remaining:    int64(recipients),
+		writeLatency: m.writeLatency,
+	}
+	cr.traceSeq++
+	if ChatTraceSampling > 0 && cr.traceSeq%ChatTraceSampling == 0 {
+		ct.tr = golangtrace.NewWithStart(ChatTraceFamily, fmt.Sprintf("room:%d", cr.RoomID), false, start)
+		ct.tr.LazyPrintf("process:%s queue:%s recipients:%d", pt.EnqueueTime.Sub(start), pt.FanoutTime.Sub(pt.EnqueueTime), recipients)
+		if recipients > 0 {
+			time.AfterFunc(ChatTraceTimeout, ct.finish)
+		}
+	}
+	pt.OnWritten = ct.written
+	return ct
+}
+
+//分发结束，只允许在房间协程中调用
+func (ct *chatTrace) fanoutDone(fanout time.Duration) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.tr == nil {
+		return
+	}
+	ct.tr.LazyPrintf("fanout:%s", fanout)
+	if atomic.LoadInt64(&ct.remaining) <= 0 {
+		ct.finishLocked()
+	}
+}
+
+//接收者写出消息
+func (ct *chatTrace) written(writeTime time.Time) {
+	left := atomic.AddInt64(&ct.remaining, -1)
+	if left < 0 {
+		return
+	}
+	d := writeTime.Sub(ct.fanoutTime)
+	ct.writeLatency.Observe(micros(d))
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	if ct.tr == nil {
+		return
+	}
+	if ct.writtenCount == 0 || d < ct.first {
+		ct.first = d
+	}
+	if d > ct.last {
+		ct.last = d
+	}
+	ct.writtenCount++
+	if left == 0 {
+		ct.finishLocked()
+	}
+}
+
+//等待超时，结束跟踪
+func (ct *chatTrace) finish() {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	ct.finishLocked()
+}
+
+func (ct *chatTrace) finishLocked() {
+	if ct.tr == nil {
+		return
+	}
+	ct.tr.LazyPrintf("written:%d first:%s last:%s", ct.writtenCount, ct.first, ct.last)
+	if left := atomic.LoadInt64(&ct.remaining); left > 0 {
+		ct.tr.LazyPrintf("%d recipients not written in %s", left, ChatTraceTimeout)
+		ct.tr.SetError()
+	}
+	ct.tr.Finish()
+	ct.tr = nil
+}
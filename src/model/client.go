@@ -2,34 +2,48 @@ package model
 
 import (
 	"sync"
+	"time"
 
 	"github.com/zxfonline/IMDemo/core/atomic"
 	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/nametrie"
 	"github.com/zxfonline/IMDemo/core/session"
 )
 
 var (
 	//key=sessionID value=*ClientAgent
 	_clientKv sync.Map
+	//在线玩家名字索引 key=userName value=*ClientAgent
+	_nameKv   = make(map[string]*ClientAgent, 1024)
+	_nameTrie = nametrie.NewNameMatchTrie()
+	_nameLock sync.RWMutex
 )
 
 type ClientAgent struct {
-	Session  *session.WsSession
+	Session  session.Session
 	UserName string
 	//-1掉线,0大厅,1,2,3...房间id
 	State *atomic.Int64
+	//行为统计
+	Stats *AgentStats
+	//禁言截止时间 unix纳秒，0不禁言
+	muteUntil atomic.Int64
+	//请求限流
+	limiter agentLimiter
 }
 
-func NewClientAgent(session *session.WsSession) *ClientAgent {
+func NewClientAgent(session session.Session) *ClientAgent {
 	return &ClientAgent{
 		Session: session,
 		State:   atomic.NewInt64(0),
+		Stats:   &AgentStats{},
 	}
 }
 
 func ClientAgentAdd(client *ClientAgent) {
-	_clientKv.Store(client.Session.SessionId, client)
-	log.Debugf("connected client,session:%d,remote:%s", client.Session.SessionId, client.Session.RemoteAddr())
+	_clientKv.Store(client.Session.ID(), client)
+	onlineCount.Inc()
+	log.Debugf("connected client,session:%d,remote:%s", client.Session.ID(), client.Session.RemoteAddr())
 }
 
 func ClientAgentGet(sessionID int64) *ClientAgent {
@@ -52,10 +66,91 @@ func RangeSessions(callback func(clientAgent *ClientAgent) bool) {
 
 func ClientAgentOffline(sessionID int64) int64 {
 	defer log.PrintPanicStack()
-	if tmp, ok := _clientKv.Load(sessionID); ok {
+	if tmp, ok := _clientKv.LoadAndDelete(sessionID); ok {
 		client := tmp.(*ClientAgent)
-		_clientKv.Delete(sessionID)
+		onlineCount.Dec()
 		client.State.Store(-1)
+		_nameLock.Lock()
+		client.unindexName()
+		_nameLock.Unlock()
 	}
 	return 0
 }
+
+//禁言 d:<=0 解除禁言
+func (client *ClientAgent) Mute(d time.Duration) {
+	if d <= 0 {
+		client.muteUntil.Store(0)
+		return
+	}
+	client.muteUntil.Store(time.Now().Add(d).UnixNano())
+}
+
+//禁言截止时间，未禁言返回零值
+func (client *ClientAgent) MuteUntil(now time.Time) time.Time {
+	if until := client.muteUntil.Load(); until > now.UnixNano() {
+		return time.Unix(0, until)
+	}
+	return time.Time{}
+}
+
+//设置玩家名字(登录或改名)并更新在线玩家名字索引
+func ClientAgentRename(client *ClientAgent, userName string) {
+	_nameLock.Lock()
+	defer _nameLock.Unlock()
+	client.unindexName()
+	client.UserName = userName
+	if userName == "" || client.State.Load() == -1 {
+		return
+	}
+	_nameKv[userName] = client
+	_nameTrie.Add(userName)
+}
+
+//玩家名字，其他协程读取时使用
+func (client *ClientAgent) Name() string {
+	_nameLock.RLock()
+	defer _nameLock.RUnlock()
+	return client.UserName
+}
+
+//从名字索引中移除，只允许在持有_nameLock时调用
+func (client *ClientAgent) unindexName() {
+	if client.UserName != "" && _nameKv[client.UserName] == client {
+		delete(_nameKv, client.UserName)
+		_nameTrie.Remove(client.UserName)
+	}
+}
+
+//按名字查找在线玩家
+func ClientAgentFind(userName string) *ClientAgent {
+	_nameLock.RLock()
+	client := _nameKv[userName]
+	_nameLock.RUnlock()
+	if client == nil || client.Session.IsClosed() || client.State.Load() == -1 {
+		return nil
+	}
+	return client
+}
+
+//按字典序查找名字包含prefix前缀的在线玩家，最多返回limit个
+//filter 为空则不过滤
+func SearchClientAgents(prefix string, limit int, filter func(clientAgent *ClientAgent) bool) []*ClientAgent {
+	var founds []*ClientAgent
+	if limit <= 0 {
+		return founds
+	}
+	_nameLock.RLock()
+	defer _nameLock.RUnlock()
+	_nameTrie.RangePrefix(prefix, func(userName string) bool {
+		client := _nameKv[userName]
+		if client == nil || client.Session.IsClosed() || client.State.Load() == -1 {
+			return true
+		}
+		if filter == nil || filter(client) {
+			founds = append(founds, client)
+		}
+		return len(founds) < limit
+	})
+	return founds
+}
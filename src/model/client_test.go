@@ -0,0 +1,91 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+func newTestClient(sessionID int64, userName string, roomID int64) *ClientAgent {
+	client := NewClientAgent(&session.WsSession{SessionId: sessionID, CloseState: chanutil.NewDoneChan()})
+	_clientKv.Store(sessionID, client)
+	onlineCount.Inc()
+	client.State.Store(roomID)
+	ClientAgentRename(client, userName)
+	return client
+}
+
+func TestClientAgent_NameIndex(t *testing.T) {
+	zhangsan := newTestClient(1001, "zhangsan", 1)
+	newTestClient(1002, "zhangsi", 2)
+	newTestClient(1003, "lisi", 1)
+	defer func() {
+		for id := int64(1001); id <= 1003; id++ {
+			ClientAgentOffline(id)
+		}
+	}()
+
+	require.Equal(t, zhangsan, ClientAgentFind("zhangsan"))
+	require.Nil(t, ClientAgentFind("wangwu"))
+	names := func(clients []*ClientAgent) (ns []string) {
+		for _, c := range clients {
+			ns = append(ns, c.UserName)
+		}
+		return
+	}
+	require.Equal(t, []string{"zhangsan", "zhangsi"}, names(SearchClientAgents("zh", 10, nil)))
+	require.Equal(t, []string{"zhangsan"}, names(SearchClientAgents("zh", 1, nil)))
+	require.Equal(t, []string{"zhangsi"}, names(SearchClientAgents("zh", 10, func(c *ClientAgent) bool {
+		return c.State.Load() == 2
+	})))
+
+	//改名后旧名字不再可查
+	ClientAgentRename(zhangsan, "wangwu")
+	require.Nil(t, ClientAgentFind("zhangsan"))
+	require.Equal(t, zhangsan, ClientAgentFind("wangwu"))
+	require.Equal(t, []string{"zhangsi"}, names(SearchClientAgents("zh", 10, nil)))
+
+	//离线后从索引中移除
+	ClientAgentOffline(1001)
+	require.Nil(t, ClientAgentFind("wangwu"))
+	require.Empty(t, SearchClientAgents("wang", 10, nil))
+}
+
+func TestClientAgent_TopStats(t *testing.T) {
+	spammer := newTestClient(2001, "spammer", 1)
+	idler := newTestClient(2002, "idler", 1)
+	defer func() {
+		ClientAgentOffline(2001)
+		ClientAgentOffline(2002)
+	}()
+	now := time.Now()
+	spammer.Session.(*session.WsSession).OnLineTime = &now
+	idler.Session.(*session.WsSession).OnLineTime = &now
+	spammer.Stats.Messages.Add(30)
+	spammer.Stats.BadwordHits.Inc()
+	spammer.Stats.Active(now)
+	idler.Stats.Messages.Inc()
+	idler.Stats.Active(now.Add(-time.Hour))
+
+	top, ok := TopStats("messages", 10)
+	require.True(t, ok)
+	require.Len(t, top, 2)
+	require.Equal(t, "spammer", top[0].UserName)
+	require.EqualValues(t, 30, top[0].Messages)
+	require.EqualValues(t, 1, top[0].BadwordHits)
+
+	top, ok = TopStats("idle", 1)
+	require.True(t, ok)
+	require.Len(t, top, 1)
+	require.Equal(t, "idler", top[0].UserName)
+
+	top, ok = TopStats("messages", -1)
+	require.True(t, ok)
+	require.Empty(t, top)
+
+	_, ok = TopStats("unknown", 1)
+	require.False(t, ok)
+}
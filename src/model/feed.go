@@ -0,0 +1,169 @@
+package model
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/core/atomic"
+	"github.com/zxfonline/IMDemo/core/metrics"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+//房间事件类型
+const (
+	FeedJoin     = "join"
+	FeedLeave    = "leave"
+	FeedMessage  = "message"
+	FeedAnnounce = "announce"
+	FeedBadword  = "badword"
+	FeedKick     = "kick"
+	FeedMute     = "mute"
+	FeedMove     = "move"
+)
+
+//订阅者默认的事件缓存数量
+const FeedBufferSize = 256
+
+//房间事件，生成后不再修改
+type RoomEvent struct {
+	Type string `json:"type"`
+	//事件时间 unix毫秒
+	Time      int64  `json:"time"`
+	RoomID    int64  `json:"roomID"`
+	SessionID int64  `json:"sessionID,omitempty"`
+	UserName  string `json:"userName,omitempty"`
+	Message   string `json:"message,omitempty"`
+	//管理操作的原因或参数
+	Reason string `json:"reason,omitempty"`
+}
+
+//房间事件的订阅分发，事件只在有订阅者时生成
+//发送不阻塞，订阅者读取太慢时丢弃事件
+type RoomFeed struct {
+	roomID int64
+	mu     sync.Mutex
+	subs   map[*FeedSubscriber]struct{}
+	count  atomic.Int32
+	//丢弃的事件数
+	droppedTotal *metrics.Counter
+}
+
+//事件订阅者
+type FeedSubscriber struct {
+	C       <-chan *RoomEvent
+	c       chan *RoomEvent
+	dropped atomic.Int64
+	feed    *RoomFeed
+	once    sync.Once
+}
+
+func newRoomFeed(roomID int64) *RoomFeed {
+	return &RoomFeed{
+		roomID:       roomID,
+		subs:         make(map[*FeedSubscriber]struct{}),
+		droppedTotal: roomFeedDroppedTotal.With(strconv.FormatInt(roomID, 10)),
+	}
+}
+
+//订阅房间事件 buffer:<=0 使用 FeedBufferSize
+func (f *RoomFeed) Subscribe(buffer int) *FeedSubscriber {
+	if buffer <= 0 {
+		buffer = FeedBufferSize
+	}
+	c := make(chan *RoomEvent, buffer)
+	sub := &FeedSubscriber{C: c, c: c, feed: f}
+	f.mu.Lock()
+	f.subs[sub] = struct{}{}
+	f.count.Store(int32(len(f.subs)))
+	f.mu.Unlock()
+	return sub
+}
+
+//订阅者数量
+func (f *RoomFeed) Subscribers() int {
+	return int(f.count.Load())
+}
+
+//是否有订阅者，没有订阅者时不用生成事件
+func (f *RoomFeed) active() bool {
+	return f.count.Load() > 0
+}
+
+//分发事件，不阻塞
+func (f *RoomFeed) publish(event *RoomEvent) {
+	event.RoomID = f.roomID
+	if event.Time == 0 {
+		event.Time = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for sub := range f.subs {
+		select {
+		case sub.c <- event:
+		default:
+			sub.dropped.Inc()
+			f.droppedTotal.Inc()
+		}
+	}
+}
+
+//取消订阅
+func (sub *FeedSubscriber) Close() {
+	sub.once.Do(func() {
+		f := sub.feed
+		f.mu.Lock()
+		delete(f.subs, sub)
+		f.count.Store(int32(len(f.subs)))
+		f.mu.Unlock()
+	})
+}
+
+//读取太慢被丢弃的事件数
+func (sub *FeedSubscriber) Dropped() int64 {
+	return sub.dropped.Load()
+}
+
+//房间事件订阅
+func (cr *ChatRoom) Feed() *RoomFeed {
+	return cr.feed
+}
+
+//发布房间事件，可在任意协程调用
+func (cr *ChatRoom) Notify(event *RoomEvent) {
+	if cr.feed.active() {
+		cr.feed.publish(event)
+	}
+}
+
+//房间协程中的事件截取
+func (cr *ChatRoom) tapMember(eventType string, client *ClientAgent) {
+	if !cr.feed.active() {
+		return
+	}
+	event := &RoomEvent{Type: eventType, UserName: client.Name()}
+	if client.Session != nil {
+		event.SessionID = client.Session.ID()
+	}
+	cr.feed.publish(event)
+}
+
+func (cr *ChatRoom) tapMessage(message *session.NetPacket) {
+	if !cr.feed.active() {
+		return
+	}
+	v, err := fastjson.ParseBytes(message.Data)
+	if err != nil {
+		return
+	}
+	if notice := v.GetStringBytes("data", "notice"); notice != nil {
+		cr.feed.publish(&RoomEvent{Type: FeedAnnounce, Message: string(notice)})
+	} else if chat := v.GetStringBytes("data", "message"); chat != nil {
+		cr.feed.publish(&RoomEvent{
+			Type:     FeedMessage,
+			UserName: string(v.GetStringBytes("data", "userName")),
+			Message:  string(chat),
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/atomic"
+	"github.com/zxfonline/IMDemo/core/golangtrace"
+	"github.com/zxfonline/IMDemo/core/metrics"
+)
+
+var (
+	//在线会话数
+	onlineCount atomic.Int64
+
+	roomBroadcastTotal   = metrics.NewCounterVec("im_room_messages_broadcast_total", "Messages broadcast by each chat room.", "room")
+	roomDeliveryTotal    = metrics.NewCounterVec("im_room_messages_delivered_total", "Messages queued to members by each chat room.", "room")
+	roomBroadcastLatency = metrics.NewHistogramVec("im_room_broadcast_latency_seconds", "Time from receiving a chat message to finishing its fan-out.", "room", microsPerSecond)
+
+	//聊天消息链路各阶段的耗时
+	chatProcessLatency = metrics.NewHistogramVec("im_chat_process_seconds", "Time from receiving a chat message to enqueueing it on the room broadcast channel.", "room", microsPerSecond)
+	chatQueueLatency   = metrics.NewHistogramVec("im_chat_queue_seconds", "Time chat messages wait in the room broadcast channel.", "room", microsPerSecond)
+	chatFanoutLatency  = metrics.NewHistogramVec("im_chat_fanout_seconds", "Time the room loop spends fanning a chat message out to members.", "room", microsPerSecond)
+	chatWriteLatency   = metrics.NewHistogramVec("im_chat_write_seconds", "Time from the start of fan-out to the chat message being written to each recipient.", "room", microsPerSecond)
+
+	//超过房间广播上限的消息
+	roomBroadcastDelayedTotal  = metrics.NewCounterVec("im_room_broadcast_delayed_total", "Messages queued because the room broadcast cap was reached.", "room")
+	roomBroadcastDroppedTotal  = metrics.NewCounterVec("im_room_broadcast_dropped_total", "Messages dropped because the room broadcast backlog was full.", "room")
+	roomBroadcastRejectedTotal = metrics.NewCounterVec("im_room_broadcast_rejected_total", "Chat messages rejected because the room broadcast cap was reached.", "room")
+
+	//房间事件订阅中因读取太慢被丢弃的事件
+	roomFeedDroppedTotal = metrics.NewCounterVec("im_room_feed_dropped_total", "Room feed events dropped for slow subscribers.", "room")
+)
+
+//直方图观测值使用微秒
+const microsPerSecond = float64(time.Second / time.Microsecond)
+
+func micros(d time.Duration) int64 {
+	return int64(d / time.Microsecond)
+}
+
+func init() {
+	metrics.NewGaugeFunc("im_sessions", "Connected sessions.", func() float64 {
+		return float64(onlineCount.Load())
+	})
+}
+
+//在线会话数
+func OnlineCount() int64 {
+	return onlineCount.Load()
+}
+
+//房间的指标
+type roomMetrics struct {
+	broadcastTotal   *metrics.Counter
+	deliveryTotal    *metrics.Counter
+	broadcastLatency *golangtrace.Histogram
+	processLatency   *golangtrace.Histogram
+	queueLatency     *golangtrace.Histogram
+	fanoutLatency    *golangtrace.Histogram
+	writeLatency     *golangtrace.Histogram
+
+	broadcastDelayed  *metrics.Counter
+	broadcastDropped  *metrics.Counter
+	broadcastRejected *metrics.Counter
+}
+
+func newRoomMetrics(roomID int64) *roomMetrics {
+	label := strconv.FormatInt(roomID, 10)
+	return &roomMetrics{
+		broadcastTotal:   roomBroadcastTotal.With(label),
+		deliveryTotal:    roomDeliveryTotal.With(label),
+		broadcastLatency: roomBroadcastLatency.With(label),
+		processLatency:   chatProcessLatency.With(label),
+		queueLatency:     chatQueueLatency.With(label),
+		fanoutLatency:    chatFanoutLatency.With(label),
+		writeLatency:     chatWriteLatency.With(label),
+
+		broadcastDelayed:  roomBroadcastDelayedTotal.With(label),
+		broadcastDropped:  roomBroadcastDroppedTotal.With(label),
+		broadcastRejected: roomBroadcastRejectedTotal.With(label),
+	}
+}
@@ -0,0 +1,38 @@
+//Package modeltest 房间和插件测试共用的消息构造和接收方法
+package modeltest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+//玩家的聊天广播消息，userName 为空时和未登录的消息一样
+func ChatPacket(userName, message string) *session.NetPacket {
+	return &session.NetPacket{
+		Data:        []byte(fmt.Sprintf(`{"type":4001,"data":{"userName":%q,"message":%q}}`, userName, message)),
+		ReceiveTime: time.Now(),
+	}
+}
+
+//机器人的聊天广播消息，可以直接作为 ChatRoom.BotPacket
+func BotPacket(botName, message string, now time.Time) *session.NetPacket {
+	return &session.NetPacket{
+		Data:        []byte(fmt.Sprintf(`{"type":4001,"data":{"userName":%q,"message":%q,"bot":true}}`, botName, message)),
+		ReceiveTime: now,
+	}
+}
+
+//接收一条消息，1秒内没有收到则测试失败
+func Recv(t testing.TB, c chan *session.NetPacket) string {
+	t.Helper()
+	select {
+	case packet := <-c:
+		return string(packet.Data)
+	case <-time.After(time.Second):
+		t.Fatal("recv timeout")
+		return ""
+	}
+}
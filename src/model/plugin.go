@@ -0,0 +1,217 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+//插件回调的间隔
+var PluginTickInterval = time.Second
+
+//房间插件，所有回调都在房间协程中执行，不能阻塞
+type Plugin interface {
+	//成员进入房间
+	OnJoin(ctx *PluginContext, client *ClientAgent)
+	//成员离开房间
+	OnLeave(ctx *PluginContext, client *ClientAgent)
+	//聊天消息广播前调用，可以修改 msg.Message，返回false则否决该消息，不再广播
+	OnMessage(ctx *PluginContext, msg *ChatMessage) bool
+	//定时回调，间隔为 PluginTickInterval
+	OnTick(ctx *PluginContext, now time.Time)
+}
+
+//空实现，插件只需要重写关心的回调
+type BasePlugin struct{}
+
+func (BasePlugin) OnJoin(ctx *PluginContext, client *ClientAgent)      {}
+func (BasePlugin) OnLeave(ctx *PluginContext, client *ClientAgent)     {}
+func (BasePlugin) OnMessage(ctx *PluginContext, msg *ChatMessage) bool { return true }
+func (BasePlugin) OnTick(ctx *PluginContext, now time.Time)            {}
+
+//插件看到的聊天消息
+type ChatMessage struct {
+	//发送者，机器人消息或发送者已离线时为空
+	Sender   *ClientAgent
+	UserName string
+	Message  string
+	//是否是机器人发送的消息
+	Bot bool
+}
+
+//插件的房间上下文，只能在回调中使用
+type PluginContext struct {
+	room *ChatRoom
+	//插件名
+	Name string
+	//插件发消息使用的机器人名字
+	BotName string
+}
+
+//房间号
+func (pc *PluginContext) RoomID() int64 {
+	return pc.room.RoomID
+}
+
+//以机器人身份向房间发送消息，回调结束后广播，不再经过插件
+func (pc *PluginContext) Say(message string) {
+	if packet := pc.room.botPacket(pc.BotName, message); packet != nil {
+		pc.room.pluginOutbox = append(pc.room.pluginOutbox, packet)
+	}
+}
+
+//以机器人身份只发给一个成员
+func (pc *PluginContext) Whisper(client *ClientAgent, message string) {
+	if packet := pc.room.botPacket(pc.BotName, message); packet != nil {
+		client.Session.Send(packet)
+	}
+}
+
+//房间成员数
+func (pc *PluginContext) ClientCount() int {
+	return len(pc.room.clients)
+}
+
+//房间中的插件
+type roomPlugin struct {
+	plugin Plugin
+	ctx    *PluginContext
+}
+
+//插件工厂 options:房间配置的插件参数
+type PluginFactory func(options map[string]string) (Plugin, error)
+
+var (
+	pluginLock      sync.RWMutex
+	pluginFactories = make(map[string]PluginFactory)
+)
+
+//注册插件工厂，重名时覆盖
+func RegisterPlugin(name string, factory PluginFactory) {
+	pluginLock.Lock()
+	defer pluginLock.Unlock()
+	pluginFactories[name] = factory
+}
+
+//按名字创建插件
+func NewPlugin(name string, options map[string]string) (Plugin, error) {
+	pluginLock.RLock()
+	factory := pluginFactories[name]
+	pluginLock.RUnlock()
+	if factory == nil {
+		return nil, fmt.Errorf("unsupport plugin:%s,plugins:%v", name, PluginNames())
+	}
+	return factory(options)
+}
+
+//已注册的插件名
+func PluginNames() []string {
+	pluginLock.RLock()
+	defer pluginLock.RUnlock()
+	names := make([]string, 0, len(pluginFactories))
+	for name := range pluginFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//添加插件，只能在房间协程启动前调用 botName:为空使用插件名
+func (cr *ChatRoom) AddPlugin(name, botName string, plugin Plugin) {
+	if botName == "" {
+		botName = name
+	}
+	cr.plugins = append(cr.plugins, &roomPlugin{
+		plugin: plugin,
+		ctx:    &PluginContext{room: cr, Name: name, BotName: botName},
+	})
+}
+
+func (cr *ChatRoom) botPacket(botName, message string) *session.NetPacket {
+	if cr.BotPacket == nil || message == "" {
+		return nil
+	}
+	return cr.BotPacket(botName, message, time.Now())
+}
+
+//执行插件回调，插件异常不影响房间协程
+func (cr *ChatRoom) callPlugin(p *roomPlugin, f func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Errorf("room plugin panic:%v,room:%d,plugin:%s", err, cr.RoomID, p.ctx.Name)
+		}
+	}()
+	f()
+}
+
+//广播插件发送的消息
+func (cr *ChatRoom) flushPluginOutbox() {
+	for i, packet := range cr.pluginOutbox {
+		cr.pluginOutbox[i] = nil
+		cr.broadcast(packet)
+	}
+	cr.pluginOutbox = cr.pluginOutbox[:0]
+}
+
+func (cr *ChatRoom) pluginJoin(client *ClientAgent) {
+	for _, p := range cr.plugins {
+		cr.callPlugin(p, func() { p.plugin.OnJoin(p.ctx, client) })
+	}
+	cr.flushPluginOutbox()
+}
+
+func (cr *ChatRoom) pluginLeave(client *ClientAgent) {
+	for _, p := range cr.plugins {
+		cr.callPlugin(p, func() { p.plugin.OnLeave(p.ctx, client) })
+	}
+	cr.flushPluginOutbox()
+}
+
+func (cr *ChatRoom) pluginTick(now time.Time) {
+	for _, p := range cr.plugins {
+		cr.callPlugin(p, func() { p.plugin.OnTick(p.ctx, now) })
+	}
+	cr.flushPluginOutbox()
+}
+
+//聊天消息经过插件处理，返回false表示被否决
+func (cr *ChatRoom) pluginMessage(message *session.NetPacket) bool {
+	v, err := fastjson.ParseBytes(message.Data)
+	if err != nil {
+		return true
+	}
+	data := v.Get("data")
+	if data == nil || data.Get("message") == nil {
+		//不是聊天消息
+		return true
+	}
+	msg := &ChatMessage{
+		UserName: string(data.GetStringBytes("userName")),
+		Message:  string(data.GetStringBytes("message")),
+		Bot:      data.GetBool("bot"),
+	}
+	if !msg.Bot {
+		msg.Sender = ClientAgentFind(msg.UserName)
+	}
+	origin := msg.Message
+	for _, p := range cr.plugins {
+		pass := true
+		cr.callPlugin(p, func() { pass = p.plugin.OnMessage(p.ctx, msg) })
+		if !pass {
+			log.Debugf("room plugin veto message,room:%d,plugin:%s,user:%s", cr.RoomID, p.ctx.Name, msg.UserName)
+			return false
+		}
+	}
+	if msg.Message != origin {
+		text, _ := json.Marshal(msg.Message)
+		data.Set("message", fastjson.MustParseBytes(text))
+		message.Data = v.MarshalTo(nil)
+	}
+	return true
+}
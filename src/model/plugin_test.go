@@ -0,0 +1,94 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model/modeltest"
+)
+
+//屏蔽 "spam"，把 "hi" 改成 "hello"，并回复 "ping"
+type testPlugin struct {
+	BasePlugin
+	joined []string
+}
+
+func (p *testPlugin) OnJoin(ctx *PluginContext, client *ClientAgent) {
+	p.joined = append(p.joined, client.UserName)
+	ctx.Whisper(client, "welcome "+client.UserName)
+}
+
+func (p *testPlugin) OnMessage(ctx *PluginContext, msg *ChatMessage) bool {
+	switch {
+	case msg.Bot:
+	case strings.Contains(msg.Message, "spam"):
+		return false
+	case msg.Message == "hi":
+		msg.Message = "hello"
+	case msg.Message == "ping":
+		ctx.Say("pong")
+	}
+	return true
+}
+
+//插件异常不影响房间
+type panicPlugin struct {
+	BasePlugin
+}
+
+func (panicPlugin) OnMessage(ctx *PluginContext, msg *ChatMessage) bool {
+	panic("boom")
+}
+
+func TestChatRoom_Plugin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	room.BotPacket = modeltest.BotPacket
+	plugin := &testPlugin{}
+	room.AddPlugin("panic", "", panicPlugin{})
+	room.AddPlugin("test", "robot", plugin)
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	sendChan := make(chan *session.NetPacket, 10)
+	client := NewClientAgent(&session.WsSession{SessionId: 9, SendChan: sendChan, CloseState: chanutil.NewDoneChan()})
+	client.UserName = "bob"
+	client.State.Store(1)
+	room.Register <- client
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"welcome bob"`)
+
+	room.Broadcast <- modeltest.ChatPacket("bob", "spam spam")
+	room.Broadcast <- modeltest.ChatPacket("bob", "hi")
+	require.JSONEq(t, `{"type":4001,"data":{"userName":"bob","message":"hello"}}`, modeltest.Recv(t, sendChan))
+
+	room.Broadcast <- modeltest.ChatPacket("bob", "ping")
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"ping"`)
+	require.Contains(t, modeltest.Recv(t, sendChan), `"userName":"robot","message":"pong"`)
+
+	require.NoError(t, room.Query(func() {
+		require.Equal(t, []string{"bob"}, plugin.joined)
+		require.Len(t, room.RecentMsgs(), 3)
+	}))
+	require.Empty(t, sendChan)
+}
+
+func TestNewPlugin(t *testing.T) {
+	RegisterPlugin("test", func(options map[string]string) (Plugin, error) {
+		return &testPlugin{}, nil
+	})
+	p, err := NewPlugin("test", nil)
+	require.NoError(t, err)
+	require.IsType(t, &testPlugin{}, p)
+	require.Contains(t, PluginNames(), "test")
+	_, err = NewPlugin("none", nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+//令牌桶限流参数
+type RateLimit struct {
+	//每秒补充的令牌数
+	Rate float64
+	//桶容量，允许的突发请求数
+	Burst int
+}
+
+//令牌桶，不是并发安全的
+type TokenBucket struct {
+	limit  *RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(limit *RateLimit, now time.Time) *TokenBucket {
+	return &TokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+}
+
+//取一个令牌，令牌不足时返回还需等待的时间
+func (tb *TokenBucket) Take(now time.Time) (bool, time.Duration) {
+	ok, retryAfter := tb.Peek(now)
+	if ok {
+		tb.tokens--
+	}
+	return ok, retryAfter
+}
+
+//检查是否有令牌，不取出，令牌不足时返回还需等待的时间
+func (tb *TokenBucket) Peek(now time.Time) (bool, time.Duration) {
+	if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens = math.Min(float64(tb.limit.Burst), tb.tokens+elapsed.Seconds()*tb.limit.Rate)
+		tb.last = now
+	}
+	if tb.tokens >= 1 {
+		return true, 0
+	}
+	if tb.limit.Rate <= 0 {
+		return false, math.MaxInt64
+	}
+	return false, time.Duration(math.Ceil((1 - tb.tokens) / tb.limit.Rate * float64(time.Second)))
+}
+
+//玩家各类请求的令牌桶
+type agentLimiter struct {
+	sync.Mutex
+	buckets map[string]*TokenBucket
+}
+
+//按请求类别限流，返回是否允许和被拒绝时的重试等待时间
+func (client *ClientAgent) Allow(key string, limit *RateLimit, now time.Time) (bool, time.Duration) {
+	client.limiter.Lock()
+	defer client.limiter.Unlock()
+	return client.bucket(key, limit, now).Take(now)
+}
+
+//检查请求类别是否会被限流，不消耗令牌
+func (client *ClientAgent) PeekAllow(key string, limit *RateLimit, now time.Time) (bool, time.Duration) {
+	client.limiter.Lock()
+	defer client.limiter.Unlock()
+	return client.bucket(key, limit, now).Peek(now)
+}
+
+//请求类别的令牌桶，限流参数变化时重建，持有锁时调用
+func (client *ClientAgent) bucket(key string, limit *RateLimit, now time.Time) *TokenBucket {
+	tb := client.limiter.buckets[key]
+	if tb == nil || tb.limit != limit {
+		if client.limiter.buckets == nil {
+			client.limiter.buckets = make(map[string]*TokenBucket, 4)
+		}
+		tb = NewTokenBucket(limit, now)
+		client.limiter.buckets[key] = tb
+	}
+	return tb
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	tb := NewTokenBucket(&RateLimit{Rate: 2, Burst: 3}, now)
+	for i := 0; i < 3; i++ {
+		ok, _ := tb.Take(now)
+		require.True(t, ok)
+	}
+	ok, retryAfter := tb.Take(now)
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+
+	//补充的令牌不超过桶容量
+	now = now.Add(250 * time.Millisecond)
+	ok, retryAfter = tb.Take(now)
+	require.False(t, ok)
+	require.Equal(t, 250*time.Millisecond, retryAfter)
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ = tb.Take(now)
+		require.True(t, ok)
+	}
+	ok, _ = tb.Take(now)
+	require.False(t, ok)
+}
+
+func TestClientAgent_Allow(t *testing.T) {
+	client := NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()})
+	now := time.Now()
+	chat := &RateLimit{Rate: 1, Burst: 1}
+	ok, _ := client.Allow("roomChat", chat, now)
+	require.True(t, ok)
+	ok, retryAfter := client.Allow("roomChat", chat, now)
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+	//不同请求使用各自的令牌桶
+	ok, _ = client.Allow("userSearch", &RateLimit{Rate: 1, Burst: 1}, now)
+	require.True(t, ok)
+	ok, _ = client.Allow("roomChat", chat, now.Add(time.Second))
+	require.True(t, ok)
+}
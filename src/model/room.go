@@ -2,7 +2,9 @@ package model
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/valyala/fastjson"
@@ -11,28 +13,117 @@ import (
 	"github.com/zxfonline/IMDemo/core/session"
 )
 
+//热词快照的刷新间隔，最小统计窗口按该间隔刷新，更大的统计窗口按窗口大小的倍数降低刷新频率
+var HotSnapshotInterval = 5 * time.Second
+
+//热词快照中每个统计窗口保留的热词数量
+const HotSnapshotTopX = 100
+
+//房间协程内查询的超时时间
+var RoomQueryTimeout = 3 * time.Second
+
 type ChatRoom struct {
 	RoomID     int64
 	clients    map[*ClientAgent]bool
 	Broadcast  chan *session.NetPacket
 	Register   chan *ClientAgent
 	Unregister chan *ClientAgent
-	//最新的缓存消息
-	RecentMsg []*session.NetPacket
-	//热门消息记录
-	HotMsg *hotword.TimeTrie
+	//系统公告，不受房间广播上限限制
+	announce chan *session.NetPacket
+	//在房间协程中执行的查询
+	query chan func()
+	//最新的缓存消息 []*session.NetPacket，只读快照
+	recentMsg     atomic.Value
+	cacheChatSize int
+	//热门消息记录，只允许在房间协程中访问
+	hotMsg hotword.Engine
+	//热词快照 *HotSnapshot，由房间协程定时生成，供外部并发读取
+	hotSnapshot atomic.Value
+	//各统计窗口的热词上次统计的时间，只允许在房间协程中访问
+	hotRefreshed map[time.Duration]time.Time
+	//热词趋势配置
+	Trending *TrendingOption
+	//已推送过的趋势热词
+	trendingWords map[string]bool
+	//房间成员数，由房间协程维护
+	clientCount int64
+	metrics     *roomMetrics
+	//分发消息时复用的接收者列表，只允许在房间协程中访问
+	recipients []*ClientAgent
+	//聊天消息链路跟踪的序号
+	traceSeq int64
+	//房间活跃度统计，只允许在房间协程中访问
+	activity *roomActivity
+	//活跃度快照文件，为空不保存
+	ActivityFile string
+	//房间事件订阅
+	feed *RoomFeed
+	//房间插件，只允许在房间协程中访问
+	plugins []*roomPlugin
+	//插件回调中待广播的消息
+	pluginOutbox []*session.NetPacket
+	//构建机器人聊天消息
+	BotPacket func(botName, message string, now time.Time) *session.NetPacket
+	//发言限制 *RoomLimits，运行时可以修改
+	limits atomic.Value
+	//房间广播上限
+	broadcastCap roomCap
+}
+
+//热词趋势配置
+type TrendingOption struct {
+	//最近统计窗口
+	Window time.Duration
+	//最近窗口内的最少次数
+	MinCount int64
+	//推送的最低得分，<=0 不推送
+	MinScore float64
+	//构建趋势广播消息
+	Packet func(words []*hotword.HotWord) *session.NetPacket
 }
 
-func NewChatRoom(roomID int64, cacheChatSize int32) *ChatRoom {
+//热词快照，生成后不再修改
+type HotSnapshot struct {
+	Time time.Time
+	//统计窗口列表
+	Windows []time.Duration
+	//默认统计窗口
+	DefaultWindow time.Duration
+	//最大统计窗口(趋势基线)
+	MaxWindow time.Duration
+	//各统计窗口的热词
+	Hots map[time.Duration][]*hotword.HotWord
+	//各最近窗口的趋势热词
+	Trends map[time.Duration][]*hotword.HotWord
+}
+
+//hotMsg 房间的热词统计引擎，为空则使用默认引擎
+func NewChatRoom(roomID int64, cacheChatSize int32, hotMsg hotword.Engine) *ChatRoom {
+	if hotMsg == nil {
+		hotMsg = hotword.NewEngine()
+	}
 	room := &ChatRoom{
-		RoomID:     roomID,
-		clients:    make(map[*ClientAgent]bool, 128),
-		Broadcast:  make(chan *session.NetPacket, 1024),
-		Register:   make(chan *ClientAgent, 16),
-		Unregister: make(chan *ClientAgent, 16),
-		RecentMsg:  make([]*session.NetPacket, 0, cacheChatSize),
-		HotMsg:     hotword.NewTimeTrie(),
+		RoomID:        roomID,
+		clients:       make(map[*ClientAgent]bool, 128),
+		Broadcast:     make(chan *session.NetPacket, 1024),
+		Register:      make(chan *ClientAgent, 16),
+		Unregister:    make(chan *ClientAgent, 16),
+		announce:      make(chan *session.NetPacket, 64),
+		query:         make(chan func(), 16),
+		cacheChatSize: int(cacheChatSize),
+		hotMsg:        hotMsg,
+		trendingWords: make(map[string]bool),
+		hotRefreshed:  make(map[time.Duration]time.Time),
+		metrics:       newRoomMetrics(roomID),
+		activity:      newRoomActivity(),
+		feed:          newRoomFeed(roomID),
 	}
+	room.recentMsg.Store([]*session.NetPacket{})
+	limits := &RoomLimits{}
+	limits.init()
+	room.limits.Store(limits)
+	room.broadcastCap.changed = make(chan struct{}, 1)
+	room.refreshHotSnapshot()
 	return room
 }
 
@@ -41,48 +132,301 @@ func (cr *ChatRoom) Run(ctx context.Context, wg *sync.WaitGroup) {
 	var interval int64 = 60
 	realExpire := interval - (time.Now().Unix() % interval)
 	ticker := time.NewTimer(time.Duration(realExpire) * time.Second)
+	snapshotTicker := time.NewTicker(HotSnapshotInterval)
+	//没有插件时不定时回调
+	var pluginTick <-chan time.Time
+	if len(cr.plugins) > 0 {
+		pluginTicker := time.NewTicker(PluginTickInterval)
+		defer pluginTicker.Stop()
+		pluginTick = pluginTicker.C
+	}
 	defer func() {
 		wg.Done()
 		ticker.Stop()
+		snapshotTicker.Stop()
+		if cr.broadcastCap.drainTimer != nil {
+			cr.broadcastCap.drainTimer.Stop()
+		}
 	}()
 	for {
 		select {
 		case <-ctx.Done():
+			cr.saveActivity(true)
 			return
 		case <-ticker.C:
 			ticker.Reset(time.Duration(interval) * time.Second)
-			//清理当前时间十分钟以前的热词信息
-			cr.HotMsg.OnTimeout(time.Now().Unix() - 10*60)
+			//清理最大统计窗口以前的热词信息
+			cr.hotMsg.OnTimeout(time.Now().Add(-cr.hotMsg.MaxWindow()).Unix())
+			cr.refreshHotSnapshot()
+			cr.notifyTrending()
+			cr.saveActivity(false)
+		case <-snapshotTicker.C:
+			cr.refreshHotSnapshot()
 		case client := <-cr.Register:
 			cr.clients[client] = true
+			cr.activity.onJoin(time.Now())
+			cr.tapMember(FeedJoin, client)
+			atomic.StoreInt64(&cr.clientCount, int64(len(cr.clients)))
+			if len(cr.plugins) > 0 {
+				cr.pluginJoin(client)
+			}
 		case client := <-cr.Unregister:
 			delete(cr.clients, client)
+			cr.tapMember(FeedLeave, client)
+			atomic.StoreInt64(&cr.clientCount, int64(len(cr.clients)))
+			if len(cr.plugins) > 0 {
+				cr.pluginLeave(client)
+			}
 		case message := <-cr.Broadcast:
+			cr.admitLogic(message)
+		case message := <-cr.announce:
 			cr.broadcastLogic(message)
+		case now := <-cr.drainChan():
+			cr.drainBacklog(now)
+		case <-cr.broadcastCap.changed:
+			cr.drainBacklog(time.Now())
+		case f := <-cr.query:
+			f()
+		case now := <-pluginTick:
+			cr.pluginTick(now)
 		}
 	}
 }
 func (cr *ChatRoom) broadcastLogic(message *session.NetPacket) {
+	if len(cr.plugins) > 0 {
+		//插件回复在原消息之后广播
+		defer cr.flushPluginOutbox()
+		if !cr.pluginMessage(message) {
+			return
+		}
+	}
+	cr.broadcast(message)
+}
+
+func (cr *ChatRoom) broadcast(message *session.NetPacket) {
+	defer log.PrintPanicStack()
+	recipients := cr.recipients[:0]
+	for client := range cr.clients {
+		if client.State.Load() == cr.RoomID {
+			recipients = append(recipients, client)
+		}
+	}
+	var ct *chatTrace
+	cached := message
+	if message.Trace != nil {
+		ct = cr.traceFanout(message, len(recipients))
+		//缓存不带跟踪的副本，重放给新成员时不影响跟踪
+		cp := *message
+		cp.Trace = nil
+		cached = &cp
+	}
+	cr.addRecentMsg(cached)
+	cr.tapMessage(message)
+	fanoutStart := time.Now()
+	for _, client := range recipients {
+		client.Session.Send(message)
+	}
+	fanoutEnd := time.Now()
+	for i := range recipients {
+		recipients[i] = nil
+	}
+	cr.recipients = recipients
+	cr.metrics.broadcastTotal.Inc()
+	cr.metrics.deliveryTotal.Add(int64(len(recipients)))
+	cr.metrics.fanoutLatency.Observe(micros(fanoutEnd.Sub(fanoutStart)))
+	if !message.ReceiveTime.IsZero() {
+		cr.metrics.broadcastLatency.Observe(micros(fanoutEnd.Sub(message.ReceiveTime)))
+	}
+	if ct != nil {
+		ct.fanoutDone(fanoutEnd.Sub(fanoutStart))
+	}
+}
+
+//将消息放入房间广播队列，并跟踪消息链路耗时
+func (cr *ChatRoom) Publish(message *session.NetPacket) {
+	message.Trace = &session.PacketTrace{EnqueueTime: time.Now()}
+	cr.Broadcast <- message
+}
+
+//将系统公告放入房间广播队列，不受房间广播上限限制，不排队
+func (cr *ChatRoom) Announce(message *session.NetPacket) {
+	message.Trace = &session.PacketTrace{EnqueueTime: time.Now()}
+	cr.announce <- message
+}
+
+//房间成员数
+func (cr *ChatRoom) ClientCount() int64 {
+	return atomic.LoadInt64(&cr.clientCount)
+}
+
+//在房间协程中执行f并等待其完成，用于无法通过快照回答的查询
+func (cr *ChatRoom) Query(f func()) error {
+	done := make(chan struct{})
+	timer := time.NewTimer(RoomQueryTimeout)
+	defer timer.Stop()
+	select {
+	case cr.query <- func() {
+		defer close(done)
+		defer log.PrintPanicStack()
+		f()
+	}:
+	case <-timer.C:
+		return errors.New("room busy")
+	}
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return errors.New("room query timeout")
+	}
+}
+
+//以prefix开头的前x个热词
+func (cr *ChatRoom) SuggestTopX(prefix string, topX int, window time.Duration) ([]*hotword.HotWord, error) {
+	var suggests []*hotword.HotWord
+	if err := cr.Query(func() {
+		suggests = cr.hotMsg.SuggestTopX(hotword.Normalize(prefix), topX, window)
+	}); err != nil {
+		return nil, err
+	}
+	return suggests, nil
+}
+
+//最新的缓存消息，返回的切片不可修改
+func (cr *ChatRoom) RecentMsgs() []*session.NetPacket {
+	return cr.recentMsg.Load().([]*session.NetPacket)
+}
+
+//最新的热词快照
+func (cr *ChatRoom) HotSnapshot() *HotSnapshot {
+	return cr.hotSnapshot.Load().(*HotSnapshot)
+}
+
+//重新统计到期的统计窗口并发布快照，未到期的窗口沿用上次的结果，只允许在房间协程中调用
+func (cr *ChatRoom) refreshHotSnapshot() {
 	defer log.PrintPanicStack()
-	cr.addRecentMsg(message)
+	now := time.Now()
+	old, _ := cr.hotSnapshot.Load().(*HotSnapshot)
+	snapshot := &HotSnapshot{
+		Time:          now,
+		Windows:       cr.hotMsg.Windows(),
+		DefaultWindow: cr.hotMsg.DefaultWindow(),
+		MaxWindow:     cr.hotMsg.MaxWindow(),
+		Hots:          make(map[time.Duration][]*hotword.HotWord),
+		Trends:        make(map[time.Duration][]*hotword.HotWord),
+	}
+	//窗口越大变化越慢，刷新间隔按最小窗口的倍数增加
+	minWindow := snapshot.Windows[0]
+	due := func(w time.Duration) bool {
+		last, ok := cr.hotRefreshed[w]
+		return !ok || old == nil || now.Sub(last) >= time.Duration(float64(HotSnapshotInterval)*float64(w)/float64(minWindow))
+	}
+	refresh := func(w time.Duration, trend bool) {
+		if !due(w) {
+			snapshot.Hots[w] = old.Hots[w]
+			if trend {
+				snapshot.Trends[w] = old.Trends[w]
+			}
+			return
+		}
+		cr.hotRefreshed[w] = now
+		snapshot.Hots[w] = cr.hotMsg.HotTopX(HotSnapshotTopX, w)
+		if trend {
+			snapshot.Trends[w] = cr.hotMsg.TrendingTopX(HotSnapshotTopX, w, 1)
+		}
+	}
+	for _, w := range snapshot.Windows {
+		refresh(w, w < snapshot.MaxWindow)
+	}
+	if opt := cr.Trending; opt != nil && snapshot.Trends[opt.Window] == nil {
+		if due(opt.Window) || old.Trends[opt.Window] == nil {
+			cr.hotRefreshed[opt.Window] = now
+			snapshot.Trends[opt.Window] = cr.hotMsg.TrendingTopX(HotSnapshotTopX, opt.Window, 1)
+		} else {
+			snapshot.Trends[opt.Window] = old.Trends[opt.Window]
+		}
+	}
+	cr.hotSnapshot.Store(snapshot)
+}
+
+//统计窗口内前x的热词
+func (s *HotSnapshot) HotTopX(topX int, window time.Duration) []*hotword.HotWord {
+	hots := s.Hots[window]
+	if topX <= 0 {
+		return nil
+	}
+	if topX < len(hots) {
+		hots = hots[:topX]
+	}
+	return hots
+}
+
+//最近窗口内趋势上升最快的前x个热词
+func (s *HotSnapshot) TrendingTopX(topX int, window time.Duration, minCount int64) []*hotword.HotWord {
+	if topX <= 0 {
+		return nil
+	}
+	trends := make([]*hotword.HotWord, 0, topX)
+	for _, hw := range s.Trends[window] {
+		if len(trends) >= topX {
+			break
+		}
+		if hw.Count >= minCount {
+			trends = append(trends, hw)
+		}
+	}
+	return trends
+}
+
+//推送新上榜的趋势热词，跌出榜单的热词可以再次推送
+func (cr *ChatRoom) notifyTrending() {
+	defer log.PrintPanicStack()
+	opt := cr.Trending
+	if opt == nil || opt.MinScore <= 0 || opt.Packet == nil {
+		return
+	}
+	trends := cr.HotSnapshot().TrendingTopX(10, opt.Window, opt.MinCount)
+	founds := make(map[string]bool, len(trends))
+	var news []*hotword.HotWord
+	for _, hw := range trends {
+		if hw.Score < opt.MinScore {
+			continue
+		}
+		founds[hw.Word] = true
+		if !cr.trendingWords[hw.Word] {
+			news = append(news, hw)
+		}
+	}
+	cr.trendingWords = founds
+	if len(news) == 0 {
+		return
+	}
+	message := opt.Packet(news)
 	for client := range cr.clients {
 		if client.State.Load() == cr.RoomID {
 			client.Session.Send(message)
 		}
 	}
 }
+
 func (cr *ChatRoom) addRecentMsg(msg *session.NetPacket) {
-	arr := cr.RecentMsg
-	if len(arr) >= cap(arr) {
-		copy(arr[:], arr[1:])
-		arr[cap(arr)-1] = msg
-	} else {
+	if cr.cacheChatSize > 0 {
+		//生成新的快照，读取方持有的旧切片不受影响
+		old := cr.RecentMsgs()
+		if len(old) >= cr.cacheChatSize {
+			old = old[len(old)-cr.cacheChatSize+1:]
+		}
+		arr := make([]*session.NetPacket, 0, len(old)+1)
+		arr = append(arr, old...)
 		arr = append(arr, msg)
+		cr.recentMsg.Store(arr)
 	}
-	cr.RecentMsg = arr
 	if chat := fastjson.GetString(msg.Data, "data", "message"); chat != "" {
-		//FIXME 可以考虑使用分词器进行优化，目前默认将一句话作为热词
-		cr.HotMsg.Add(chat)
+		cr.activity.onMessage(fastjson.GetString(msg.Data, "data", "userName"), time.Now())
+		//分词后统计热词
+		for _, word := range hotword.Tokenize(chat) {
+			cr.hotMsg.Add(word)
+		}
 	}
 
 }
@@ -0,0 +1,301 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/hotword"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model/modeltest"
+)
+
+//房间协程写入热词的同时并发读取快照，使用 go test -race 检测
+func TestChatRoom_ConcurrentHotQuery(t *testing.T) {
+	interval := HotSnapshotInterval
+	HotSnapshotInterval = 10 * time.Millisecond
+	defer func() { HotSnapshotInterval = interval }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	go room.Run(ctx, wg)
+
+	readers := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for j := 0; j < 500; j++ {
+				snapshot := room.HotSnapshot()
+				for _, w := range snapshot.Windows {
+					for _, hw := range snapshot.HotTopX(10, w) {
+						_ = hw.Word
+					}
+				}
+				snapshot.TrendingTopX(10, snapshot.DefaultWindow, 1)
+				require.LessOrEqual(t, len(room.RecentMsgs()), 10)
+			}
+		}()
+	}
+	for i := 0; i < 2000; i++ {
+		room.Broadcast <- modeltest.ChatPacket("", fmt.Sprintf("hello world %d", i%7))
+	}
+	readers.Wait()
+
+	//等待房间协程处理完消息并刷新快照
+	require.Eventually(t, func() bool {
+		hots := room.HotSnapshot().HotTopX(2, time.Minute)
+		return len(hots) == 2 && hots[0].Count == 2000
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Len(t, room.RecentMsgs(), 10)
+	cancel()
+	wg.Wait()
+}
+
+func TestChatRoom_SuggestTopX(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	room.Broadcast <- modeltest.ChatPacket("", "golang gopher")
+	room.Broadcast <- modeltest.ChatPacket("", "Golang java")
+	//查询和广播在房间协程中的处理顺序不确定
+	require.Eventually(t, func() bool {
+		suggests, err := room.SuggestTopX("GO", 10, time.Minute)
+		require.NoError(t, err)
+		return len(suggests) == 2 && suggests[0].Word == "golang" && suggests[0].Count == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestChatRoom_TraceChatMessage(t *testing.T) {
+	sampling := ChatTraceSampling
+	ChatTraceSampling = 1
+	defer func() { ChatTraceSampling = sampling }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(100, 10, nil)
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	var members []*ClientAgent
+	for i := 0; i < 3; i++ {
+		client := NewClientAgent(&session.WsSession{SendChan: make(chan *session.NetPacket, 1), CloseState: chanutil.NewDoneChan()})
+		client.State.Store(room.RoomID)
+		room.Register <- client
+		members = append(members, client)
+	}
+	require.Eventually(t, func() bool { return room.ClientCount() == 3 }, time.Second, time.Millisecond)
+
+	//指标按房间号全局累计，比较增量
+	counts := func() (write, queue, process int64) {
+		_, write, _ = room.metrics.writeLatency.Snapshot()
+		_, queue, _ = room.metrics.queueLatency.Snapshot()
+		_, process, _ = room.metrics.processLatency.Snapshot()
+		return
+	}
+	write0, queue0, process0 := counts()
+	room.Publish(modeltest.ChatPacket("", "hello"))
+	for _, client := range members {
+		packet := <-client.Session.(*session.WsSession).SendChan
+		require.False(t, packet.Trace.FanoutTime.IsZero())
+		packet.Trace.OnWritten(time.Now())
+		//重复回调不再统计
+		packet.Trace.OnWritten(time.Now())
+	}
+	write, queue, process := counts()
+	require.EqualValues(t, 3, write-write0)
+	require.EqualValues(t, 1, queue-queue0)
+	require.EqualValues(t, 1, process-process0)
+	for _, packet := range room.RecentMsgs() {
+		require.Nil(t, packet.Trace)
+	}
+}
+
+//跟踪广播的同时有成员登录并重放缓存消息，使用 go test -race 检测
+func TestChatRoom_TraceWithReplay(t *testing.T) {
+	sampling := ChatTraceSampling
+	ChatTraceSampling = 1
+	defer func() { ChatTraceSampling = sampling }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(101, 10, nil)
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	const count = 200
+	member := NewClientAgent(&session.WsSession{SendChan: make(chan *session.NetPacket, count), CloseState: chanutil.NewDoneChan()})
+	member.State.Store(room.RoomID)
+	room.Register <- member
+	require.Eventually(t, func() bool { return room.ClientCount() == 1 }, time.Second, time.Millisecond)
+
+	done := make(chan struct{})
+	replays := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		replays.Add(1)
+		go func() {
+			defer replays.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				//模拟登录时把缓存消息写给新成员
+				for _, packet := range room.RecentMsgs() {
+					if packet.Trace != nil {
+						packet.Trace.OnWritten(time.Now())
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		room.Publish(modeltest.ChatPacket("", fmt.Sprintf("hello %d", i)))
+	}
+	for i := 0; i < count; i++ {
+		packet := <-member.Session.(*session.WsSession).SendChan
+		require.NotNil(t, packet.Trace)
+		packet.Trace.OnWritten(time.Now())
+	}
+	close(done)
+	replays.Wait()
+	for _, packet := range room.RecentMsgs() {
+		require.Nil(t, packet.Trace)
+	}
+}
+
+func TestChatRoom_Activity(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "room_1.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	room.ActivityFile = file
+	go room.Run(ctx, wg)
+
+	room.Register <- NewClientAgent(&session.WsSession{SendChan: make(chan *session.NetPacket, 1), CloseState: chanutil.NewDoneChan()})
+	for _, name := range []string{"a", "b", "a"} {
+		room.Broadcast <- modeltest.ChatPacket(name, "hello")
+	}
+	_, err := room.Activity("1y")
+	require.Error(t, err)
+
+	var last *ActivityPoint
+	require.Eventually(t, func() bool {
+		points, err := room.Activity("1h")
+		require.NoError(t, err)
+		require.Len(t, points, 60)
+		last = points[len(points)-1]
+		return last.Messages == 3 && last.Joins == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, float64(2), last.ActiveUsers)
+
+	//退出时保存快照，重启后恢复
+	cancel()
+	wg.Wait()
+	restored := NewChatRoom(1, 10, nil)
+	restored.ActivityFile = file
+	require.NoError(t, restored.LoadActivity())
+	points := restored.activity.points(ActivityRanges["24h"], time.Now())
+	require.Len(t, points, 24)
+	require.Equal(t, float64(3), points[len(points)-1].Messages)
+	require.Equal(t, float64(2), points[len(points)-1].ActiveUsers)
+
+	//其他房间的快照不能导入
+	other := NewChatRoom(2, 10, nil)
+	other.ActivityFile = file
+	require.Error(t, other.LoadActivity())
+}
+
+func TestChatRoom_Feed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	//没有订阅者时不生成事件
+	room.Notify(&RoomEvent{Type: FeedKick})
+	sub := room.Feed().Subscribe(0)
+	slow := room.Feed().Subscribe(2)
+	require.Equal(t, 2, room.Feed().Subscribers())
+
+	client := NewClientAgent(&session.WsSession{SessionId: 9, SendChan: make(chan *session.NetPacket, 1), CloseState: chanutil.NewDoneChan()})
+	client.UserName = "bob"
+	room.Register <- client
+	room.Broadcast <- modeltest.ChatPacket("bob", "hello")
+	room.Notify(&RoomEvent{Type: FeedMute, SessionID: 9, UserName: "bob", Reason: "1m0s"})
+
+	var events []*RoomEvent
+	for len(events) < 3 {
+		select {
+		case event := <-sub.C:
+			events = append(events, event)
+		case <-time.After(time.Second):
+			t.Fatalf("events:%+v", events)
+		}
+	}
+	types := make(map[string]*RoomEvent)
+	for _, event := range events {
+		require.Equal(t, int64(1), event.RoomID)
+		types[event.Type] = event
+	}
+	require.Equal(t, int64(9), types[FeedJoin].SessionID)
+	require.Equal(t, "hello", types[FeedMessage].Message)
+	require.Equal(t, "bob", types[FeedMessage].UserName)
+	require.Equal(t, "1m0s", types[FeedMute].Reason)
+
+	//读取太慢的订阅者丢弃事件，不影响其他订阅者
+	require.Equal(t, int64(1), slow.Dropped())
+	require.Equal(t, int64(0), sub.Dropped())
+	slow.Close()
+	slow.Close()
+	sub.Close()
+	require.Equal(t, 0, room.Feed().Subscribers())
+}
+
+func TestChatRoom_RefreshHotSnapshot(t *testing.T) {
+	interval := HotSnapshotInterval
+	HotSnapshotInterval = 20 * time.Millisecond
+	defer func() { HotSnapshotInterval = interval }()
+
+	room := NewChatRoom(1, 10, nil)
+	room.hotMsg.Add("golang")
+	time.Sleep(HotSnapshotInterval)
+	room.refreshHotSnapshot()
+	snapshot := room.HotSnapshot()
+	require.Equal(t, []string{"golang"}, hotWords(snapshot.HotTopX(10, time.Minute)))
+	//大窗口按窗口倍数降低刷新频率，沿用上次的结果
+	require.Empty(t, snapshot.HotTopX(10, time.Hour))
+	require.Nil(t, snapshot.HotTopX(-1, time.Minute))
+	require.Nil(t, snapshot.TrendingTopX(-1, time.Minute, 1))
+}
+
+func hotWords(hots []*hotword.HotWord) []string {
+	words := make([]string, 0, len(hots))
+	for _, hw := range hots {
+		words = append(words, hw.Word)
+	}
+	return words
+}
@@ -0,0 +1,246 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/atomic"
+	"github.com/zxfonline/IMDemo/core/session"
+)
+
+//超过房间广播上限时的策略
+const (
+	//排队，按上限速度延迟广播
+	PolicyQueue = "queue"
+	//拒绝玩家的聊天消息
+	PolicyReject = "reject"
+)
+
+//排队广播的默认最大消息数
+const DefaultBroadcastBacklog = 1000
+
+//房间发言限制，设置后不再修改
+type RoomLimits struct {
+	//慢速模式，每个成员两次发言的最小间隔，0不限制
+	SlowMode time.Duration
+	//房间每秒最多广播的消息数，0不限制
+	BroadcastRate float64
+	//允许的突发广播数(默认为每秒广播数，至少1)
+	BroadcastBurst int
+	//超过广播上限时的策略 queue:排队(默认) reject:拒绝
+	Policy string
+	//排队的最大消息数，超过后丢弃(默认 DefaultBroadcastBacklog)
+	MaxBacklog int
+
+	slowLimit *RateLimit
+	capLimit  *RateLimit
+}
+
+//校验并补全默认值
+func (l *RoomLimits) init() error {
+	if l.SlowMode < 0 || l.BroadcastRate < 0 || l.BroadcastBurst < 0 || l.MaxBacklog < 0 {
+		return fmt.Errorf("negative room limits")
+	}
+	switch l.Policy {
+	case "":
+		l.Policy = PolicyQueue
+	case PolicyQueue, PolicyReject:
+	default:
+		return fmt.Errorf("unsupport broadcast policy:%s", l.Policy)
+	}
+	if l.MaxBacklog == 0 {
+		l.MaxBacklog = DefaultBroadcastBacklog
+	}
+	l.slowLimit, l.capLimit = nil, nil
+	if l.SlowMode > 0 {
+		l.slowLimit = &RateLimit{Rate: 1 / l.SlowMode.Seconds(), Burst: 1}
+	}
+	if l.BroadcastRate > 0 {
+		if l.BroadcastBurst == 0 {
+			l.BroadcastBurst = int(math.Max(1, math.Ceil(l.BroadcastRate)))
+		}
+		l.capLimit = &RateLimit{Rate: l.BroadcastRate, Burst: l.BroadcastBurst}
+	}
+	return nil
+}
+
+//房间广播上限，拒绝策略时在玩家协程中检查，排队策略时在房间协程中检查
+type roomCap struct {
+	sync.Mutex
+	//广播令牌桶，持有锁时访问
+	bucket *TokenBucket
+	//排队等待广播的消息，只允许在房间协程中访问
+	backlog []*session.NetPacket
+	//排队的消息数，供外部并发读取
+	backlogLen atomic.Int64
+	drainTimer *time.Timer
+	//发言限制修改的通知
+	changed chan struct{}
+}
+
+//修改房间发言限制，从排队改为其他策略时立即广播排队的消息
+func (cr *ChatRoom) SetLimits(l *RoomLimits) error {
+	limits := *l
+	if err := limits.init(); err != nil {
+		return err
+	}
+	cr.limits.Store(&limits)
+	select {
+	case cr.broadcastCap.changed <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+//当前的房间发言限制
+func (cr *ChatRoom) Limits() *RoomLimits {
+	return cr.limits.Load().(*RoomLimits)
+}
+
+//排队等待广播的消息数
+func (cr *ChatRoom) BacklogLen() int64 {
+	return cr.broadcastCap.backlogLen.Load()
+}
+
+//慢速模式检查玩家能否发言并记录本次发言，返回还需等待的时间
+func (cr *ChatRoom) AllowSlowMode(client *ClientAgent, now time.Time) (bool, time.Duration) {
+	limits := cr.Limits()
+	if limits.slowLimit == nil {
+		return true, 0
+	}
+	return client.Allow(cr.slowModeKey(), limits.slowLimit, now)
+}
+
+//慢速模式检查玩家能否发言，不记录发言，返回还需等待的时间
+func (cr *ChatRoom) CheckSlowMode(client *ClientAgent, now time.Time) (bool, time.Duration) {
+	limits := cr.Limits()
+	if limits.slowLimit == nil {
+		return true, 0
+	}
+	return client.PeekAllow(cr.slowModeKey(), limits.slowLimit, now)
+}
+
+func (cr *ChatRoom) slowModeKey() string {
+	return fmt.Sprintf("slowmode:%d", cr.RoomID)
+}
+
+//拒绝策略时检查房间能否再广播一条玩家消息并占用额度，返回还需等待的时间
+func (cr *ChatRoom) AdmitBroadcast(now time.Time) (bool, time.Duration) {
+	return cr.admitBroadcast(now, true)
+}
+
+//拒绝策略时检查房间能否再广播一条玩家消息，不占用额度，返回还需等待的时间
+func (cr *ChatRoom) CheckBroadcast(now time.Time) (bool, time.Duration) {
+	return cr.admitBroadcast(now, false)
+}
+
+func (cr *ChatRoom) admitBroadcast(now time.Time, take bool) (bool, time.Duration) {
+	limits := cr.Limits()
+	if limits.capLimit == nil || limits.Policy != PolicyReject {
+		return true, 0
+	}
+	var ok bool
+	var retryAfter time.Duration
+	if take {
+		ok, retryAfter = cr.takeCap(limits.capLimit, now)
+	} else {
+		ok, retryAfter = cr.peekCap(limits.capLimit, now)
+	}
+	if !ok {
+		cr.metrics.broadcastRejected.Inc()
+	}
+	return ok, retryAfter
+}
+
+func (cr *ChatRoom) takeCap(limit *RateLimit, now time.Time) (bool, time.Duration) {
+	cr.broadcastCap.Lock()
+	defer cr.broadcastCap.Unlock()
+	return cr.capBucket(limit, now).Take(now)
+}
+
+func (cr *ChatRoom) peekCap(limit *RateLimit, now time.Time) (bool, time.Duration) {
+	cr.broadcastCap.Lock()
+	defer cr.broadcastCap.Unlock()
+	return cr.capBucket(limit, now).Peek(now)
+}
+
+//广播令牌桶，限制参数变化时重建，持有锁时调用
+func (cr *ChatRoom) capBucket(limit *RateLimit, now time.Time) *TokenBucket {
+	if cr.broadcastCap.bucket == nil || cr.broadcastCap.bucket.limit != limit {
+		cr.broadcastCap.bucket = NewTokenBucket(limit, now)
+	}
+	return cr.broadcastCap.bucket
+}
+
+//排队策略下按上限速度广播，超过上限的消息排队
+func (cr *ChatRoom) admitLogic(message *session.NetPacket) {
+	limits := cr.Limits()
+	if limits.capLimit == nil || limits.Policy != PolicyQueue {
+		cr.broadcastLogic(message)
+		return
+	}
+	if len(cr.broadcastCap.backlog) == 0 {
+		if ok, retryAfter := cr.takeCap(limits.capLimit, time.Now()); !ok {
+			cr.resetDrain(retryAfter)
+		} else {
+			cr.broadcastLogic(message)
+			return
+		}
+	}
+	if len(cr.broadcastCap.backlog) >= limits.MaxBacklog {
+		cr.metrics.broadcastDropped.Inc()
+		return
+	}
+	cr.metrics.broadcastDelayed.Inc()
+	cr.broadcastCap.backlog = append(cr.broadcastCap.backlog, message)
+	cr.updateBacklogLen()
+}
+
+//广播排队的消息，令牌不足时等待下次
+func (cr *ChatRoom) drainBacklog(now time.Time) {
+	limits := cr.Limits()
+	for len(cr.broadcastCap.backlog) > 0 {
+		if limits.capLimit != nil && limits.Policy == PolicyQueue {
+			if ok, retryAfter := cr.takeCap(limits.capLimit, now); !ok {
+				cr.resetDrain(retryAfter)
+				break
+			}
+		}
+		message := cr.broadcastCap.backlog[0]
+		cr.broadcastCap.backlog[0] = nil
+		cr.broadcastCap.backlog = cr.broadcastCap.backlog[1:]
+		cr.broadcastLogic(message)
+	}
+	if len(cr.broadcastCap.backlog) == 0 {
+		cr.broadcastCap.backlog = nil
+	}
+	cr.updateBacklogLen()
+}
+
+func (cr *ChatRoom) resetDrain(d time.Duration) {
+	if cr.broadcastCap.drainTimer == nil {
+		cr.broadcastCap.drainTimer = time.NewTimer(d)
+		return
+	}
+	if !cr.broadcastCap.drainTimer.Stop() {
+		select {
+		case <-cr.broadcastCap.drainTimer.C:
+		default:
+		}
+	}
+	cr.broadcastCap.drainTimer.Reset(d)
+}
+
+//排队消息的广播定时器，没有排队时为空
+func (cr *ChatRoom) drainChan() <-chan time.Time {
+	if len(cr.broadcastCap.backlog) == 0 || cr.broadcastCap.drainTimer == nil {
+		return nil
+	}
+	return cr.broadcastCap.drainTimer.C
+}
+
+func (cr *ChatRoom) updateBacklogLen() {
+	cr.broadcastCap.backlogLen.Store(int64(len(cr.broadcastCap.backlog)))
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model/modeltest"
+)
+
+func TestRoomLimits_Init(t *testing.T) {
+	l := &RoomLimits{BroadcastRate: 2.5}
+	require.NoError(t, l.init())
+	require.Equal(t, PolicyQueue, l.Policy)
+	require.Equal(t, 3, l.BroadcastBurst)
+	require.Equal(t, DefaultBroadcastBacklog, l.MaxBacklog)
+	require.Nil(t, l.slowLimit)
+
+	require.Error(t, (&RoomLimits{Policy: "drop"}).init())
+	require.Error(t, (&RoomLimits{SlowMode: -time.Second}).init())
+}
+
+func TestChatRoom_SlowModeAndReject(t *testing.T) {
+	room := NewChatRoom(1, 10, nil)
+	client := NewClientAgent(&session.WsSession{SessionId: 1, CloseState: chanutil.NewDoneChan()})
+	now := time.Now()
+	ok, _ := room.AllowSlowMode(client, now)
+	require.True(t, ok)
+
+	require.NoError(t, room.SetLimits(&RoomLimits{SlowMode: 10 * time.Second, BroadcastRate: 1, Policy: PolicyReject}))
+	ok, _ = room.CheckSlowMode(client, now)
+	require.True(t, ok)
+	ok, _ = room.AllowSlowMode(client, now)
+	require.True(t, ok)
+	ok, retryAfter := room.CheckSlowMode(client, now.Add(4*time.Second))
+	require.False(t, ok)
+	require.Equal(t, 6*time.Second, retryAfter)
+	ok, retryAfter = room.AllowSlowMode(client, now.Add(4*time.Second))
+	require.False(t, ok)
+	require.Equal(t, 6*time.Second, retryAfter)
+
+	//检查不占用额度
+	for i := 0; i < 2; i++ {
+		ok, _ = room.CheckBroadcast(now)
+		require.True(t, ok)
+	}
+	ok, _ = room.AdmitBroadcast(now)
+	require.True(t, ok)
+	ok, retryAfter = room.CheckBroadcast(now)
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+	ok, retryAfter = room.AdmitBroadcast(now)
+	require.False(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+
+	//关闭后不再限制
+	require.NoError(t, room.SetLimits(&RoomLimits{}))
+	ok, _ = room.AllowSlowMode(client, now)
+	require.True(t, ok)
+	ok, _ = room.AdmitBroadcast(now)
+	require.True(t, ok)
+}
+
+func TestChatRoom_BroadcastQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := NewChatRoom(1, 10, nil)
+	require.NoError(t, room.SetLimits(&RoomLimits{BroadcastRate: 20, BroadcastBurst: 1, MaxBacklog: 2}))
+	go room.Run(ctx, wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	sendChan := make(chan *session.NetPacket, 10)
+	client := NewClientAgent(&session.WsSession{SessionId: 9, SendChan: sendChan, CloseState: chanutil.NewDoneChan()})
+	client.State.Store(1)
+	room.Register <- client
+	require.Eventually(t, func() bool { return room.ClientCount() == 1 }, time.Second, time.Millisecond)
+
+	//第一条立即广播，之后两条排队，超出排队上限的丢弃
+	for _, message := range []string{"a", "b", "c", "d"} {
+		room.Broadcast <- modeltest.ChatPacket("bob", message)
+	}
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"a"`)
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"b"`)
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"c"`)
+	require.Eventually(t, func() bool { return room.BacklogLen() == 0 }, time.Second, time.Millisecond)
+	require.Empty(t, sendChan)
+
+	//改为不限制时立即广播排队的消息
+	require.NoError(t, room.SetLimits(&RoomLimits{BroadcastRate: 0.1, BroadcastBurst: 1}))
+	room.Broadcast <- modeltest.ChatPacket("bob", "e")
+	room.Broadcast <- modeltest.ChatPacket("bob", "f")
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"e"`)
+	//系统公告不受上限限制，不排队
+	require.Eventually(t, func() bool { return room.BacklogLen() == 1 }, time.Second, time.Millisecond)
+	room.Announce(modeltest.ChatPacket("system", "notice"))
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"notice"`)
+	require.EqualValues(t, 1, room.BacklogLen())
+	require.NoError(t, room.SetLimits(&RoomLimits{}))
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"f"`)
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zxfonline/IMDemo/core/atomic"
+)
+
+//玩家行为统计，允许并发读取
+type AgentStats struct {
+	//发送的聊天消息数
+	Messages atomic.Int64
+	//聊天消息命中脏字的次数
+	BadwordHits atomic.Int64
+	//进入房间的次数
+	RoomsVisited atomic.Int64
+	//请求被限流拒绝的次数
+	RateLimited atomic.Int64
+	//最后一次收到请求的时间 unix纳秒
+	LastActive atomic.Int64
+}
+
+//记录一次请求
+func (st *AgentStats) Active(now time.Time) {
+	st.LastActive.Store(now.UnixNano())
+}
+
+//玩家统计信息
+type StatsInfo struct {
+	//会话id，对应 /debug/events 中的会话事件日志
+	SessionID    int64  `json:"sessionID"`
+	UserName     string `json:"userName"`
+	RoomID       int64  `json:"roomID"`
+	LoginTime    string `json:"loginTime"`
+	OnlineTime   string `json:"onlineTime"`
+	Messages     int64  `json:"messages"`
+	BytesIn      int64  `json:"bytesIn"`
+	BytesOut     int64  `json:"bytesOut"`
+	RpmHits      int64  `json:"rpmHits"`
+	BadwordHits  int64  `json:"badwordHits"`
+	RoomsVisited int64  `json:"roomsVisited"`
+	RateLimited  int64  `json:"rateLimited"`
+	LastActive   string `json:"lastActive,omitempty"`
+	//距离最后一次请求的时长
+	IdleTime string `json:"idleTime"`
+	PingRTT  string `json:"pingRTT,omitempty"`
+
+	idle time.Duration
+	rtt  time.Duration
+}
+
+//生成玩家当前的统计信息
+func (client *ClientAgent) StatsInfo() *StatsInfo {
+	now := time.Now()
+	lt := client.Session.LoginTime()
+	if lt.IsZero() {
+		lt = now
+	}
+	info := &StatsInfo{
+		SessionID:    client.Session.ID(),
+		UserName:     client.Name(),
+		RoomID:       client.State.Load(),
+		LoginTime:    lt.Format("2006-01-02 15:04:05"),
+		OnlineTime:   now.Sub(lt).String(),
+		Messages:     client.Stats.Messages.Load(),
+		BadwordHits:  client.Stats.BadwordHits.Load(),
+		RoomsVisited: client.Stats.RoomsVisited.Load(),
+		RateLimited:  client.Stats.RateLimited.Load(),
+	}
+	//从未发送过请求的按登录时间计算空闲时长
+	lastActive := lt
+	if nano := client.Stats.LastActive.Load(); nano > 0 {
+		lastActive = time.Unix(0, nano)
+		info.LastActive = lastActive.Format("2006-01-02 15:04:05")
+	}
+	info.idle = now.Sub(lastActive)
+	info.IdleTime = info.idle.String()
+	if st := client.Session.Statistics(); st != nil {
+		info.BytesIn = st.BytesIn.Load()
+		info.BytesOut = st.BytesOut.Load()
+		info.RpmHits = st.RpmHits.Load()
+		if info.rtt = st.RTT(); info.rtt > 0 {
+			info.PingRTT = info.rtt.String()
+		}
+	}
+	return info
+}
+
+//排行榜的排序字段
+var statsSortKeys = map[string]func(info *StatsInfo) int64{
+	"messages":     func(info *StatsInfo) int64 { return info.Messages },
+	"bytesIn":      func(info *StatsInfo) int64 { return info.BytesIn },
+	"bytesOut":     func(info *StatsInfo) int64 { return info.BytesOut },
+	"rpmHits":      func(info *StatsInfo) int64 { return info.RpmHits },
+	"badwordHits":  func(info *StatsInfo) int64 { return info.BadwordHits },
+	"roomsVisited": func(info *StatsInfo) int64 { return info.RoomsVisited },
+	"rateLimited":  func(info *StatsInfo) int64 { return info.RateLimited },
+	"idle":         func(info *StatsInfo) int64 { return int64(info.idle) },
+	"pingRTT":      func(info *StatsInfo) int64 { return int64(info.rtt) },
+}
+
+//排行榜支持的排序字段
+func StatsSortKeys() []string {
+	keys := make([]string, 0, len(statsSortKeys))
+	for k := range statsSortKeys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//按统计字段从大到小排序的前x个在线玩家，by 不支持时返回false
+func TopStats(by string, topX int) ([]*StatsInfo, bool) {
+	key, ok := statsSortKeys[by]
+	if !ok {
+		return nil, false
+	}
+	var infos []*StatsInfo
+	RangeSessions(func(clientAgent *ClientAgent) bool {
+		infos = append(infos, clientAgent.StatsInfo())
+		return true
+	})
+	sort.SliceStable(infos, func(i, j int) bool { return key(infos[i]) > key(infos[j]) })
+	if topX < 0 {
+		topX = 0
+	}
+	if topX < len(infos) {
+		infos = infos[:topX]
+	}
+	return infos, true
+}
@@ -0,0 +1,108 @@
+package plugins
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/model"
+)
+
+//单次最多掷的骰子数和最多面数
+const (
+	DiceMaxCount = 10
+	DiceMaxSides = 1000
+)
+
+func init() {
+	model.RegisterPlugin("dice", NewDice)
+}
+
+//掷骰子，成员发送 "/roll"、"/roll 20"、"/roll 2d6"
+//	command: 指令(默认 /roll)
+//	sides: 默认面数(默认6)
+type Dice struct {
+	model.BasePlugin
+	Command string
+	Sides   int
+	Rand    *rand.Rand
+}
+
+func NewDice(options map[string]string) (model.Plugin, error) {
+	d := &Dice{
+		Command: "/roll",
+		Sides:   6,
+		Rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if command := options["command"]; command != "" {
+		d.Command = command
+	}
+	if sides := options["sides"]; sides != "" {
+		n, err := strconv.Atoi(sides)
+		if err != nil || n < 2 || n > DiceMaxSides {
+			return nil, fmt.Errorf("bad dice sides:%s", sides)
+		}
+		d.Sides = n
+	}
+	return d, nil
+}
+
+//解析 "NdM"、"M" 或空
+func (d *Dice) parse(arg string) (count, sides int, ok bool) {
+	count, sides = 1, d.Sides
+	if arg == "" {
+		return count, sides, true
+	}
+	var err error
+	if i := strings.IndexAny(arg, "dD"); i >= 0 {
+		if i > 0 {
+			if count, err = strconv.Atoi(arg[:i]); err != nil {
+				return 0, 0, false
+			}
+		}
+		arg = arg[i+1:]
+	}
+	if sides, err = strconv.Atoi(arg); err != nil {
+		return 0, 0, false
+	}
+	if count < 1 || count > DiceMaxCount || sides < 2 || sides > DiceMaxSides {
+		return 0, 0, false
+	}
+	return count, sides, true
+}
+
+func (d *Dice) OnMessage(ctx *model.PluginContext, msg *model.ChatMessage) bool {
+	if msg.Bot {
+		return true
+	}
+	fields := strings.Fields(msg.Message)
+	if len(fields) == 0 || fields[0] != d.Command || len(fields) > 2 {
+		return true
+	}
+	var arg string
+	if len(fields) == 2 {
+		arg = fields[1]
+	}
+	count, sides, ok := d.parse(arg)
+	if !ok {
+		if msg.Sender != nil {
+			ctx.Whisper(msg.Sender, fmt.Sprintf("用法: %s [个数d面数]，最多%d个骰子，%d面", d.Command, DiceMaxCount, DiceMaxSides))
+		}
+		return true
+	}
+	rolls := make([]string, count)
+	total := 0
+	for i := range rolls {
+		n := d.Rand.Intn(sides) + 1
+		total += n
+		rolls[i] = strconv.Itoa(n)
+	}
+	if count == 1 {
+		ctx.Say(fmt.Sprintf("%s 掷出 d%d: %d", msg.UserName, sides, total))
+	} else {
+		ctx.Say(fmt.Sprintf("%s 掷出 %dd%d: %s = %d", msg.UserName, count, sides, strings.Join(rolls, "+"), total))
+	}
+	return true
+}
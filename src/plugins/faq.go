@@ -0,0 +1,77 @@
+package plugins
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/model"
+)
+
+func init() {
+	model.RegisterPlugin("faq", NewFAQ)
+}
+
+//常见问题自动回复，消息包含关键词时回复对应答案
+//	cooldown: 同一关键词的回复间隔(默认30s)
+//	其他参数: 关键词: 答案
+type FAQ struct {
+	model.BasePlugin
+	Cooldown time.Duration
+	//关键词按长度降序，优先匹配更具体的关键词
+	keywords []string
+	answers  map[string]string
+	//关键词最后一次回复的时间
+	answered map[string]time.Time
+}
+
+func NewFAQ(options map[string]string) (model.Plugin, error) {
+	f := &FAQ{
+		Cooldown: 30 * time.Second,
+		answers:  make(map[string]string, len(options)),
+		answered: make(map[string]time.Time),
+	}
+	for keyword, answer := range options {
+		if keyword == "cooldown" {
+			d, err := time.ParseDuration(answer)
+			if err != nil {
+				return nil, err
+			}
+			f.Cooldown = d
+			continue
+		}
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" || answer == "" {
+			continue
+		}
+		f.keywords = append(f.keywords, keyword)
+		f.answers[keyword] = answer
+	}
+	sort.Slice(f.keywords, func(i, j int) bool {
+		if len(f.keywords[i]) != len(f.keywords[j]) {
+			return len(f.keywords[i]) > len(f.keywords[j])
+		}
+		return f.keywords[i] < f.keywords[j]
+	})
+	return f, nil
+}
+
+func (f *FAQ) OnMessage(ctx *model.PluginContext, msg *model.ChatMessage) bool {
+	if msg.Bot {
+		return true
+	}
+	text := strings.ToLower(msg.Message)
+	now := time.Now()
+	for _, keyword := range f.keywords {
+		if !strings.Contains(text, keyword) {
+			continue
+		}
+		if last, ok := f.answered[keyword]; ok && now.Sub(last) < f.Cooldown {
+			return true
+		}
+		f.answered[keyword] = now
+		ctx.Say(f.answers[keyword])
+		return true
+	}
+	return true
+}
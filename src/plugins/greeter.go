@@ -0,0 +1,78 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/model"
+)
+
+func init() {
+	model.RegisterPlugin("greeter", NewGreeter)
+}
+
+//欢迎新成员
+//	message: 欢迎语，{user} 替换为成员名字，{room} 替换为房间号
+//	delay: 进入房间后多久发送欢迎语(默认1s，等客户端处理完进入房间的响应)
+//	public: true 发到房间，否则只发给新成员
+type Greeter struct {
+	model.BasePlugin
+	Message string
+	Delay   time.Duration
+	Public  bool
+	//等待欢迎的成员和进入时间
+	pending map[*model.ClientAgent]time.Time
+}
+
+func NewGreeter(options map[string]string) (model.Plugin, error) {
+	g := &Greeter{
+		Message: "欢迎 {user} 加入聊天室 {room}",
+		Delay:   time.Second,
+		pending: make(map[*model.ClientAgent]time.Time),
+	}
+	if message := options["message"]; message != "" {
+		g.Message = message
+	}
+	if delay := options["delay"]; delay != "" {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return nil, err
+		}
+		g.Delay = d
+	}
+	if public := options["public"]; public != "" {
+		b, err := strconv.ParseBool(public)
+		if err != nil {
+			return nil, err
+		}
+		g.Public = b
+	}
+	return g, nil
+}
+
+func (g *Greeter) OnJoin(ctx *model.PluginContext, client *model.ClientAgent) {
+	g.pending[client] = time.Now()
+}
+
+func (g *Greeter) OnLeave(ctx *model.PluginContext, client *model.ClientAgent) {
+	delete(g.pending, client)
+}
+
+func (g *Greeter) OnTick(ctx *model.PluginContext, now time.Time) {
+	for client, joinTime := range g.pending {
+		if now.Sub(joinTime) < g.Delay {
+			continue
+		}
+		delete(g.pending, client)
+		if client.State.Load() != ctx.RoomID() {
+			continue
+		}
+		message := strings.NewReplacer("{user}", client.Name(), "{room}", strconv.FormatInt(ctx.RoomID(), 10)).Replace(g.Message)
+		if g.Public {
+			ctx.Say(message)
+		} else {
+			ctx.Whisper(client, message)
+		}
+	}
+}
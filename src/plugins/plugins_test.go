@@ -0,0 +1,99 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zxfonline/IMDemo/core/chanutil"
+	"github.com/zxfonline/IMDemo/core/session"
+	"github.com/zxfonline/IMDemo/model"
+	"github.com/zxfonline/IMDemo/model/modeltest"
+)
+
+//运行带插件的房间并加入一个成员
+func runRoom(t *testing.T, name string, plugin model.Plugin) (*model.ChatRoom, chan *session.NetPacket) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	room := model.NewChatRoom(1, 10, nil)
+	room.BotPacket = modeltest.BotPacket
+	room.AddPlugin(name, "bot", plugin)
+	go room.Run(ctx, wg)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+	sendChan := make(chan *session.NetPacket, 10)
+	client := model.NewClientAgent(&session.WsSession{SessionId: 1, SendChan: sendChan, CloseState: chanutil.NewDoneChan()})
+	client.UserName = "bob"
+	client.State.Store(1)
+	room.Register <- client
+	require.Eventually(t, func() bool { return room.ClientCount() == 1 }, time.Second, time.Millisecond)
+	return room, sendChan
+}
+
+func TestGreeter(t *testing.T) {
+	model.PluginTickInterval = 10 * time.Millisecond
+	defer func() { model.PluginTickInterval = time.Second }()
+	_, err := NewGreeter(map[string]string{"delay": "soon"})
+	require.Error(t, err)
+	plugin, err := NewGreeter(map[string]string{"message": "hi {user}@{room}", "delay": "0s"})
+	require.NoError(t, err)
+	_, sendChan := runRoom(t, "greeter", plugin)
+	require.JSONEq(t, `{"type":4001,"data":{"userName":"bot","message":"hi bob@1","bot":true}}`, modeltest.Recv(t, sendChan))
+	time.Sleep(50 * time.Millisecond)
+	require.Empty(t, sendChan)
+}
+
+func TestDice(t *testing.T) {
+	_, err := NewDice(map[string]string{"sides": "1"})
+	require.Error(t, err)
+	plugin, err := NewDice(map[string]string{"sides": "20"})
+	require.NoError(t, err)
+	dice := plugin.(*Dice)
+	for arg, want := range map[string][2]int{"": {1, 20}, "6": {1, 6}, "2d6": {2, 6}, "D8": {1, 8}} {
+		count, sides, ok := dice.parse(arg)
+		require.True(t, ok, arg)
+		require.Equal(t, want, [2]int{count, sides}, arg)
+	}
+	for _, arg := range []string{"x", "0d6", "11d6", "2d1", "2d", "d1001"} {
+		_, _, ok := dice.parse(arg)
+		require.False(t, ok, arg)
+	}
+
+	dice.Rand = rand.New(rand.NewSource(1))
+	room, sendChan := runRoom(t, "dice", dice)
+	room.Broadcast <- modeltest.ChatPacket("bob", "/roll 3d1000")
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"/roll 3d1000"`)
+	r := rand.New(rand.NewSource(1))
+	a, b, c := r.Intn(1000)+1, r.Intn(1000)+1, r.Intn(1000)+1
+	require.Contains(t, modeltest.Recv(t, sendChan), fmt.Sprintf(`"message":"bob 掷出 3d1000: %d+%d+%d = %d"`, a, b, c, a+b+c))
+	//不是指令不回复
+	room.Broadcast <- modeltest.ChatPacket("bob", "/rolling")
+	modeltest.Recv(t, sendChan)
+	require.Empty(t, sendChan)
+}
+
+func TestFAQ(t *testing.T) {
+	plugin, err := NewFAQ(map[string]string{"cooldown": "1h", "help": "usage", "help me": "ask admin"})
+	require.NoError(t, err)
+	room, sendChan := runRoom(t, "faq", plugin)
+	room.Broadcast <- modeltest.ChatPacket("bob", "HELP ME please")
+	modeltest.Recv(t, sendChan)
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"ask admin"`)
+	//冷却中不重复回复
+	room.Broadcast <- modeltest.ChatPacket("bob", "help me")
+	modeltest.Recv(t, sendChan)
+	room.Broadcast <- modeltest.ChatPacket("bob", "help")
+	modeltest.Recv(t, sendChan)
+	require.Contains(t, modeltest.Recv(t, sendChan), `"message":"usage"`)
+	//机器人消息不回复
+	room.Broadcast <- modeltest.BotPacket("other", "help", time.Now())
+	modeltest.Recv(t, sendChan)
+	time.Sleep(20 * time.Millisecond)
+	require.Empty(t, sendChan)
+}
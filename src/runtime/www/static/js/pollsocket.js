@@ -0,0 +1,126 @@
+//websocket不可用时的替代连接，通过http长轮询或事件流收发消息
+//用法与WebSocket一致: onopen、onmessage、onclose、send、close、readyState
+function PollSocket(base) {
+    var self = this;
+    self.base = base;
+    self.readyState = PollSocket.CONNECTING;
+    fetch(base + "/open", { method: "POST" })
+        .then(function(resp) {
+            if (!resp.ok) {
+                throw new Error(resp.statusText);
+            }
+            return resp.json();
+        })
+        .then(function(res) {
+            self.query = "?sid=" + res.sid + "&token=" + encodeURIComponent(res.token);
+            self.readyState = PollSocket.OPEN;
+            if (self.onopen) {
+                self.onopen({ type: "open" });
+            }
+            if (window["EventSource"]) {
+                self._stream();
+            } else {
+                self._poll();
+            }
+        })
+        .catch(function(err) {
+            console.log("poll open err", err);
+            self._closed(1006, "");
+        });
+}
+
+PollSocket.CONNECTING = 0;
+PollSocket.OPEN = 1;
+PollSocket.CLOSING = 2;
+PollSocket.CLOSED = 3;
+
+//事件流接收，服务器定时断开后由浏览器自动重连
+PollSocket.prototype._stream = function() {
+    var self = this;
+    var es = new EventSource(self.base + "/stream" + self.query);
+    self.es = es;
+    es.onmessage = function(evt) {
+        self._dispatch(evt.data);
+    };
+    es.addEventListener("close", function(evt) {
+        es.close();
+        var res = JSON.parse(evt.data);
+        self._closed(res.code, res.reason);
+    });
+    es.onerror = function() {
+        //会话已不存在时浏览器不再重连
+        if (es.readyState === EventSource.CLOSED) {
+            self._closed(1006, "");
+        }
+    };
+};
+
+//长轮询接收
+PollSocket.prototype._poll = function() {
+    var self = this;
+    if (self.readyState === PollSocket.CLOSED) {
+        return;
+    }
+    fetch(self.base + "/recv" + self.query, { cache: "no-store" })
+        .then(function(resp) {
+            if (!resp.ok) {
+                throw new Error(resp.statusText);
+            }
+            return resp.json();
+        })
+        .then(function(res) {
+            $.each(res.messages, function(i, message) {
+                self._dispatch(JSON.stringify(message));
+            });
+            if (res.closed) {
+                self._closed(res.code, res.reason);
+            } else {
+                self._poll();
+            }
+        })
+        .catch(function(err) {
+            console.log("poll recv err", err);
+            self._closed(1006, "");
+        });
+};
+
+PollSocket.prototype._dispatch = function(data) {
+    if (this.onmessage) {
+        this.onmessage({ type: "message", data: data });
+    }
+};
+
+PollSocket.prototype._closed = function(code, reason) {
+    if (this.readyState === PollSocket.CLOSED) {
+        return;
+    }
+    this.readyState = PollSocket.CLOSED;
+    if (this.es) {
+        this.es.close();
+    }
+    if (this.onclose) {
+        this.onclose({ type: "close", code: code, reason: reason || "" });
+    }
+};
+
+PollSocket.prototype.send = function(data) {
+    if (this.readyState !== PollSocket.OPEN) {
+        return;
+    }
+    //发送失败时服务器会关闭会话，关闭原因从接收通道返回
+    fetch(this.base + "/send" + this.query, {
+        method: "POST",
+        headers: { "Content-Type": "text/plain; charset=utf-8" },
+        body: data
+    }).catch(function(err) {
+        console.log("poll send err", err);
+    });
+};
+
+PollSocket.prototype.close = function() {
+    if (this.readyState !== PollSocket.OPEN) {
+        return;
+    }
+    this.readyState = PollSocket.CLOSING;
+    fetch(this.base + "/close" + this.query, { method: "POST" });
+};
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zxfonline/IMDemo/clientctl"
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/badword"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/golangtrace"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/strutil"
+	"github.com/zxfonline/IMDemo/core/web"
+)
+
+//管理令牌的请求头、参数和cookie名
+const (
+	AdminTokenHeader = "X-Admin-Token"
+	adminTokenParam  = "token"
+	adminTokenCookie = "admin_token"
+)
+
+//请求携带的管理令牌，参数传入的令牌只用于调试页面写入cookie，避免出现在访问日志中
+func requestAdminToken(req *http.Request) string {
+	if token := req.Header.Get(AdminTokenHeader); token != "" {
+		return token
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	if cookie, err := req.Cookie(adminTokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+//是否是管理员请求，未配置令牌时拒绝访问，开启 adminLocalOnly 后只允许本机访问
+func IsAdminRequest(req *http.Request) bool {
+	if config.Conf.AdminToken == "" {
+		return config.Conf.AdminLocalOnly && isLocalRequest(req)
+	}
+	return isAdminToken(requestAdminToken(req))
+}
+
+func isAdminToken(token string) bool {
+	return config.Conf.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.Conf.AdminToken)) == 1
+}
+
+//是否是本机发起的请求
+func isLocalRequest(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	switch host {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+	return false
+}
+
+//调试页面的访问鉴权
+func adminAuthRequest(req *http.Request) (any, sensitive bool) {
+	ok := IsAdminRequest(req)
+	return ok, ok
+}
+
+//调试页面使用相对链接翻页，通过参数传入的令牌写入cookie供后续请求使用
+func debugHandler(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token := req.URL.Query().Get(adminTokenParam); isAdminToken(token) {
+			cookie := &http.Cookie{Name: adminTokenCookie, Value: token, Path: "/debug/", HttpOnly: true}
+			http.SetCookie(w, cookie)
+			//本次请求也按cookie鉴权
+			req.AddCookie(cookie)
+		}
+		h(w, req)
+	})
+}
+
+//注册调试页面 `/debug/requests` `/debug/events`
+func registerDebugHandlers(server *web.Server) {
+	golangtrace.AuthRequest = adminAuthRequest
+	server.Handler("/debug/requests", "GET", debugHandler(golangtrace.Traces))
+	server.Handler("/debug/events", "GET", debugHandler(golangtrace.Events))
+}
+
+//管理接口的访问鉴权
+func adminFilter(ctx *web.Context) error {
+	if !IsAdminRequest(ctx.Request) {
+		return gerror.NewError(gerror.SERVER_ACCESS_REFUSED, "admin token required")
+	}
+	return nil
+}
+
+//管理接口的通用响应
+type adminResult struct {
+	Code int         `json:"code"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+//注册管理接口 `/admin/...`
+func registerAdminHandlers(server *web.Server) {
+	admin := server.Group("/admin", adminFilter)
+	//房间事件流 `/admin/rooms/(房间号)/feed` text/event-stream
+	var feedDuration time.Duration
+	if server.Config != nil && server.Config.WriteTimeout > 2*time.Second {
+		feedDuration = server.Config.WriteTimeout - time.Second
+	}
+	admin.Handler("/rooms/([1-9]\\d*)/feed", "GET", roomFeedHandler(feedDuration))
+	//房间列表 `/admin/rooms`
+	admin.Get("/rooms", func(ctx *web.Context) (interface{}, error) {
+		return &adminResult{Code: int(gerror.OK), Data: clientctl.SvrCtl.RoomInfos()}, nil
+	})
+	//房间发言限制 `/admin/rooms/(房间号)/limits`
+	admin.Get("/rooms/([1-9]\\d*)/limits", func(ctx *web.Context, room string) (interface{}, error) {
+		info, err := clientctl.SvrCtl.RoomLimits(strutil.Stoi64(room, 0))
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		return &adminResult{Code: int(gerror.OK), Data: info}, nil
+	})
+	//修改房间发言限制，未传的参数保持不变
+	//POST `/admin/rooms/(房间号)/limits` slowMode=(慢速模式间隔，0关闭)&rate=(每秒最多广播数，0不限制)&burst=(突发广播数)&policy=(queue,reject)&backlog=(排队的最大消息数)
+	admin.Post("/rooms/([1-9]\\d*)/limits", func(ctx *web.Context, room string) (interface{}, error) {
+		roomID := strutil.Stoi64(room, 0)
+		chatRoom := clientctl.SvrCtl.Room(roomID)
+		if chatRoom == nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no room found")
+		}
+		limits := *chatRoom.Limits()
+		var err error
+		if v := ctx.Param("slowMode", ""); v != "" {
+			if limits.SlowMode, err = time.ParseDuration(v); err != nil {
+				return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("bad slowMode:%s", v))
+			}
+		}
+		if v := ctx.Param("rate", ""); v != "" {
+			if limits.BroadcastRate, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("bad rate:%s", v))
+			}
+		}
+		if v := ctx.Param("burst", ""); v != "" {
+			if limits.BroadcastBurst, err = strconv.Atoi(v); err != nil {
+				return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("bad burst:%s", v))
+			}
+		}
+		if v := ctx.Param("backlog", ""); v != "" {
+			if limits.MaxBacklog, err = strconv.Atoi(v); err != nil {
+				return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("bad backlog:%s", v))
+			}
+		}
+		limits.Policy = ctx.Param("policy", limits.Policy)
+		if err = clientctl.SvrCtl.SetRoomLimits(roomID, &limits); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		info, _ := clientctl.SvrCtl.RoomLimits(roomID)
+		log.Infof("admin set room limits:%d,limits:%+v,remote:%s", roomID, info, ctx.IP())
+		return &adminResult{Code: int(gerror.OK), Data: info}, nil
+	})
+	//在线会话列表 `/admin/sessions?room=(房间号，为空则全部房间)`
+	admin.Get("/sessions", func(ctx *web.Context) (interface{}, error) {
+		roomID := strutil.Stoi64(ctx.Param("room", "0"), 0)
+		return &adminResult{Code: int(gerror.OK), Data: clientctl.SvrCtl.SessionInfos(roomID)}, nil
+	})
+	//踢下线 POST `/admin/sessions/(会话id)/kick` reason=(关闭原因)
+	admin.Post("/sessions/([1-9]\\d*)/kick", func(ctx *web.Context, sid string) (interface{}, error) {
+		sessionID := strutil.Stoi64(sid, 0)
+		reason := ctx.Param("reason", "")
+		if err := clientctl.SvrCtl.Kick(sessionID, reason); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("admin kick session:%d,reason:%s,remote:%s", sessionID, reason, ctx.IP())
+		return &adminResult{Code: int(gerror.OK)}, nil
+	})
+	//禁言 POST `/admin/sessions/(会话id)/mute` duration=(禁言时长，0解除禁言)
+	admin.Post("/sessions/([1-9]\\d*)/mute", func(ctx *web.Context, sid string) (interface{}, error) {
+		sessionID := strutil.Stoi64(sid, 0)
+		duration := ctx.Param("duration", "0")
+		d, err := time.ParseDuration(duration)
+		if err != nil || d < 0 {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("bad duration:%s", duration))
+		}
+		if err = clientctl.SvrCtl.Mute(sessionID, d); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("admin mute session:%d,duration:%s,remote:%s", sessionID, d, ctx.IP())
+		return &adminResult{Code: int(gerror.OK)}, nil
+	})
+	//移到其他房间 POST `/admin/sessions/(会话id)/move` room=(房间号)
+	admin.Post("/sessions/([1-9]\\d*)/move", func(ctx *web.Context, sid string) (interface{}, error) {
+		sessionID := strutil.Stoi64(sid, 0)
+		roomID := strutil.Stoi64(ctx.Param("room", "0"), 0)
+		if err := clientctl.SvrCtl.MoveClient(sessionID, roomID); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("admin move session:%d,room:%d,remote:%s", sessionID, roomID, ctx.IP())
+		return &adminResult{Code: int(gerror.OK)}, nil
+	})
+	//系统公告 POST `/admin/announce` message=(公告内容)&room=(房间号，为空则全部房间)
+	admin.Post("/announce", func(ctx *web.Context) (interface{}, error) {
+		roomID := strutil.Stoi64(ctx.Param("room", "0"), 0)
+		message := ctx.Param("message", "")
+		rooms, err := clientctl.SvrCtl.Announce(roomID, message)
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("admin announce room:%d,rooms:%d,message:%s,remote:%s", roomID, rooms, message, ctx.IP())
+		return &adminResult{Code: int(gerror.OK), Data: rooms}, nil
+	})
+	//重新加载脏字库 POST `/admin/badword/reload`
+	admin.Post("/badword/reload", func(ctx *web.Context) (interface{}, error) {
+		count, err := badword.Reload(badword.DefaultWordFile)
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("admin reload badword,words:%d,remote:%s", count, ctx.IP())
+		return &adminResult{Code: int(gerror.OK), Data: count}, nil
+	})
+	//当前日志等级 `/admin/log/level`
+	admin.Get("/log/level", func(ctx *web.Context) (interface{}, error) {
+		return &adminResult{Code: int(gerror.OK), Data: config.LogLevel()}, nil
+	})
+	//修改日志等级 POST `/admin/log/level` level=(trace,debug,info,warn,error)
+	admin.Post("/log/level", func(ctx *web.Context) (interface{}, error) {
+		level := ctx.Param("level", "")
+		if err := config.SetLogLevel(level); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Warnf("admin set log level:%s,remote:%s", level, ctx.IP())
+		return &adminResult{Code: int(gerror.OK), Data: config.LogLevel()}, nil
+	})
+	//启动配置(yaml) `/admin/config`
+	admin.Get("/config", func(ctx *web.Context) (interface{}, error) {
+		data, err := config.DumpConfig()
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		return &adminResult{Code: int(gerror.OK), Data: string(data)}, nil
+	})
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/valyala/fastjson"
+	"github.com/zxfonline/IMDemo/clientctl"
+	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/strutil"
+	"github.com/zxfonline/IMDemo/core/web"
+)
+
+//机器人API key的请求头，也可以使用 Authorization: Bearer，不支持放在url参数中避免key写入访问日志
+const BotKeyHeader = "X-Api-Key"
+
+//请求的API key对应的机器人名字，未通过鉴权返回空
+func requestBotName(req *http.Request) string {
+	key := req.Header.Get(BotKeyHeader)
+	if key == "" {
+		if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	if key == "" {
+		return ""
+	}
+	//逐个比较避免按key查找泄露耗时
+	var botName string
+	for botKey, name := range config.Conf.BotKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(botKey)) == 1 {
+			botName = name
+		}
+	}
+	return botName
+}
+
+//解析机器人消息内容，支持两种格式
+//	原生: {"data":{"message":"内容"}} 或 {"message":"内容"}
+//	slack incoming webhook: {"text":"内容"}，也可以是表单参数 payload=(json)
+func parseBotMessage(ctx *web.Context) (string, error) {
+	body := ctx.RequestBody
+	if payload := ctx.Param("payload", ""); payload != "" {
+		body = []byte(payload)
+	} else if body == nil {
+		body = ctx.CopyBody()
+	}
+	v, err := fastjson.ParseBytes(body)
+	if err != nil {
+		return "", err
+	}
+	if message := v.GetStringBytes("data", "message"); len(message) > 0 {
+		return string(message), nil
+	}
+	if message := v.GetStringBytes("message"); len(message) > 0 {
+		return string(message), nil
+	}
+	if text := v.GetStringBytes("text"); len(text) > 0 {
+		return string(text), nil
+	}
+	//slack 只有附件的消息取附件的文字
+	var texts []string
+	for _, attachment := range v.GetArray("attachments") {
+		text := attachment.GetStringBytes("text")
+		if len(text) == 0 {
+			text = attachment.GetStringBytes("fallback")
+		}
+		if len(text) > 0 {
+			texts = append(texts, string(text))
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+//注册机器人接口
+func registerBotHandlers(server *web.Server) {
+	//机器人发送聊天消息 POST `/rooms/(房间号)/messages` 请求头 X-Api-Key 或 Authorization: Bearer 携带API key
+	server.Post("/rooms/([1-9]\\d*)/messages", func(ctx *web.Context, room string) (interface{}, error) {
+		botName := requestBotName(ctx.Request)
+		if botName == "" {
+			return nil, gerror.NewError(gerror.SERVER_ACCESS_REFUSED, "api key required")
+		}
+		roomID := strutil.Stoi64(room, 0)
+		message, err := parseBotMessage(ctx)
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "parse payload err:"+err.Error())
+		}
+		if message, err = clientctl.SvrCtl.PostBotMessage(roomID, botName, message); err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		log.Infof("bot message room:%d,bot:%s,remote:%s", roomID, botName, ctx.IP())
+		return &struct {
+			Code int    `json:"code"`
+			Data string `json:"data"`
+		}{
+			Code: int(gerror.OK),
+			Data: message,
+		}, nil
+	})
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/zxfonline/IMDemo/clientctl"
+	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/strutil"
+)
+
+//房间事件流的心跳间隔
+var FeedHeartbeat = 15 * time.Second
+
+//断开后浏览器重连的等待时间
+const feedRetry = time.Second
+
+var feedPathRegexp = regexp.MustCompile(`^/admin/rooms/([1-9]\d*)/feed$`)
+
+//房间事件流(Server-Sent Events)
+//maxDuration:>0 时到时结束事件流，避免被http服务器的写超时强制断开，浏览器会自动重连
+func roomFeedHandler(maxDuration time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		match := feedPathRegexp.FindStringSubmatch(req.URL.Path)
+		if match == nil {
+			http.NotFound(w, req)
+			return
+		}
+		room := clientctl.SvrCtl.Room(strutil.Stoi64(match[1], 0))
+		if room == nil {
+			http.Error(w, "no room found", http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		sub := room.Feed().Subscribe(0)
+		defer sub.Close()
+		log.Infof("room feed subscribe,room:%d,subscribers:%d,remote:%s", room.RoomID, room.Feed().Subscribers(), req.RemoteAddr)
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream; charset=utf-8")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, "retry: %d\n\n", feedRetry/time.Millisecond)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(FeedHeartbeat)
+		defer heartbeat.Stop()
+		var deadline <-chan time.Time
+		if maxDuration > 0 {
+			timer := time.NewTimer(maxDuration)
+			defer timer.Stop()
+			deadline = timer.C
+		}
+		var id, reported int64
+		for {
+			var err error
+			select {
+			case <-req.Context().Done():
+				return
+			case <-deadline:
+				return
+			case <-heartbeat.C:
+				_, err = fmt.Fprint(w, ": ping\n\n")
+			case event := <-sub.C:
+				var data []byte
+				if data, err = json.Marshal(event); err != nil {
+					log.Warnf("marshal room event err:%v", err)
+					continue
+				}
+				id++
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event.Type, data)
+			}
+			//读取太慢丢弃了事件，告知读取方
+			if dropped := sub.Dropped(); err == nil && dropped > reported {
+				reported = dropped
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", dropped)
+			}
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -2,12 +2,16 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/zxfonline/IMDemo/clientctl"
+	"github.com/zxfonline/IMDemo/config"
 	"github.com/zxfonline/IMDemo/core/gerror"
+	"github.com/zxfonline/IMDemo/core/hotword"
 	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/metrics"
 	"github.com/zxfonline/IMDemo/core/strutil"
 	"github.com/zxfonline/IMDemo/model"
 
@@ -15,6 +19,33 @@ import (
 	"github.com/zxfonline/IMDemo/core/web"
 )
 
+//热词、补全和趋势查询的响应
+type hotResult struct {
+	Code   int    `json:"code"`
+	Window string `json:"window"`
+	//趋势的基线窗口
+	Baseline string      `json:"baseline,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+//解析请求参数 window 指定的热词统计窗口，为空使用快照的默认窗口
+func parseHotWindow(ctx *web.Context, snapshot *model.HotSnapshot) (time.Duration, error) {
+	return parseWindow(ctx, snapshot.DefaultWindow, snapshot.Hots, fmt.Sprintf("windows:%v", snapshot.Windows))
+}
+
+//解析请求参数 window，为空使用默认窗口，只能查询快照中已统计的窗口
+func parseWindow(ctx *web.Context, def time.Duration, hots map[time.Duration][]*hotword.HotWord, hint string) (time.Duration, error) {
+	w := ctx.Param("window", "")
+	if w == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(w)
+	if _, ok := hots[d]; err != nil || !ok {
+		return 0, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("unsupport window:%s,%s", w, hint))
+	}
+	return d, nil
+}
+
 func RegisterHandlers(ctxt context.Context, wg *sync.WaitGroup, server *web.Server) {
 	server.Get("/chat", func(ctx *web.Context) (interface{}, error) {
 		conn, err := session.WSUpgrader.Upgrade(ctx.ResponseWriter, ctx.Request, nil)
@@ -22,10 +53,38 @@ func RegisterHandlers(ctxt context.Context, wg *sync.WaitGroup, server *web.Serv
 			log.Error(err)
 			return nil, err
 		}
-		clientctl.SvrCtl.ClientLogic(ctxt, wg, conn)
+		clientctl.SvrCtl.ClientLogic(ctxt, wg, session.NewWsSessionWithOptions(conn, clientctl.SvrCtl.SessionOptions()))
 		return nil, nil
 	})
-	//当前最热的话 `/popular/(房间号1-4)`
+	//不支持websocket时的长轮询和事件流 `/poll/(open|send|recv|stream|close)`
+	transport := session.NewHttpTransport(clientctl.SvrCtl.SessionOptions, func(s session.Session) {
+		clientctl.SvrCtl.ClientLogic(ctxt, wg, s)
+	})
+	//长连接请求需要在http服务器的写超时前结束
+	if server.Config != nil && server.Config.WriteTimeout > 2*time.Second {
+		transport.StreamDuration = server.Config.WriteTimeout - time.Second
+		if transport.PollWait > transport.StreamDuration {
+			transport.PollWait = transport.StreamDuration
+		}
+	}
+	server.Handler("/poll/(open|send|close)", "POST", transport)
+	server.Handler("/poll/(recv|stream)", "GET", transport)
+	registerDebugHandlers(server)
+	registerAdminHandlers(server)
+	registerBotHandlers(server)
+	//Prometheus 指标 `/metrics`
+	server.Handler("/metrics", "GET", metrics.Handler())
+	//客户端协议描述，由请求注册表生成 `/protocol`
+	server.Get("/protocol", func(ctx *web.Context) (interface{}, error) {
+		return &struct {
+			Code int `json:"code"`
+			*clientctl.Protocol
+		}{
+			Code:     int(gerror.OK),
+			Protocol: clientctl.DescribeProtocol(),
+		}, nil
+	})
+	//当前最热的话 `/popular/(房间号1-4)/(前x条)?window=(统计窗口，hotWindows 配置的窗口之一)`
 	server.Get("/popular/([1-9]+)/([1-9]\\d*)", func(ctx *web.Context, room string, topX string) (interface{}, error) {
 		roomID := strutil.Stoi64(room, 0)
 		hotNum := strutil.Stoi(topX, 1)
@@ -33,13 +92,134 @@ func RegisterHandlers(ctxt context.Context, wg *sync.WaitGroup, server *web.Serv
 		if roomInfo == nil {
 			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no room found")
 		}
-		hots := roomInfo.HotMsg.HotTopX(hotNum)
+		snapshot := roomInfo.HotSnapshot()
+		window, err := parseHotWindow(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		return &hotResult{Code: int(gerror.OK), Window: window.String(), Data: snapshot.HotTopX(hotNum, window)}, nil
+	})
+	//所有房间合并后的热词 `/popular/global?top=(前x条)&window=(统计窗口，hotWindows 配置的窗口之一)`
+	server.Get("/popular/global", func(ctx *web.Context) (interface{}, error) {
+		hotNum := strutil.Stoi(ctx.Param("top", "10"), 10)
+		var window time.Duration
+		lists := make([][]*hotword.HotWord, 0, len(clientctl.SvrCtl.Rooms))
+		for _, roomInfo := range clientctl.SvrCtl.Rooms {
+			snapshot := roomInfo.HotSnapshot()
+			var err error
+			if window, err = parseHotWindow(ctx, snapshot); err != nil {
+				return nil, err
+			}
+			//单个房间只取快照内的热词，合并结果为近似值
+			lists = append(lists, snapshot.HotTopX(model.HotSnapshotTopX, window))
+		}
+		return &hotResult{Code: int(gerror.OK), Window: window.String(), Data: hotword.MergeTopX(hotNum, lists...)}, nil
+	})
+	//以前缀开头的热词补全 `/suggest/(房间号1-4)?prefix=(前缀)&top=(前x条)&window=(统计窗口)`
+	server.Get("/suggest/([1-9]+)", func(ctx *web.Context, room string) (interface{}, error) {
+		roomID := strutil.Stoi64(room, 0)
+		roomInfo := clientctl.SvrCtl.Room(roomID)
+		if roomInfo == nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no room found")
+		}
+		prefix := ctx.Param("prefix", "")
+		if prefix == "" {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "empty prefix")
+		}
+		hotNum := strutil.Stoi(ctx.Param("top", "10"), 10)
+		snapshot := roomInfo.HotSnapshot()
+		window, err := parseHotWindow(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		suggests, err := roomInfo.SuggestTopX(prefix, hotNum, window)
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		return &hotResult{Code: int(gerror.OK), Window: window.String(), Data: suggests}, nil
+	})
+	//房间活跃度 `/rooms/(房间号1-4)/activity?range=(1h|24h|7d)`
+	server.Get("/rooms/([1-9]\\d*)/activity", func(ctx *web.Context, room string) (interface{}, error) {
+		roomID := strutil.Stoi64(room, 0)
+		roomInfo := clientctl.SvrCtl.Room(roomID)
+		if roomInfo == nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no room found")
+		}
+		rangeName := ctx.Param("range", "1h")
+		r, ok := model.ActivityRanges[rangeName]
+		if !ok {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("unsupport range:%s", rangeName))
+		}
+		points, err := roomInfo.Activity(rangeName)
+		if err != nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, err.Error())
+		}
+		return &struct {
+			Code  int                    `json:"code"`
+			Range string                 `json:"range"`
+			Step  string                 `json:"step"`
+			Data  []*model.ActivityPoint `json:"data"`
+		}{
+			Code:  int(gerror.OK),
+			Range: rangeName,
+			Step:  r.Step.String(),
+			Data:  points,
+		}, nil
+	})
+	//趋势上升最快的热词 `/trending/(房间号1-4)?top=(前x条)&window=(最近统计窗口)&minCount=(最近窗口内的最少次数)`
+	server.Get("/trending/([1-9]+)", func(ctx *web.Context, room string) (interface{}, error) {
+		roomID := strutil.Stoi64(room, 0)
+		roomInfo := clientctl.SvrCtl.Room(roomID)
+		if roomInfo == nil {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no room found")
+		}
+		hotNum := strutil.Stoi(ctx.Param("top", "10"), 10)
+		minCount := strutil.Stoi64(ctx.Param("minCount", ""), config.Conf.TrendingMinCount)
+		snapshot := roomInfo.HotSnapshot()
+		window, err := parseWindow(ctx, clientctl.TrendingWindow(), snapshot.Trends, fmt.Sprintf("max window:%s", snapshot.MaxWindow))
+		if err != nil {
+			return nil, err
+		}
+		return &hotResult{
+			Code:     int(gerror.OK),
+			Window:   window.String(),
+			Baseline: snapshot.MaxWindow.String(),
+			Data:     snapshot.TrendingTopX(hotNum, window, minCount),
+		}, nil
+	})
+	//按名字前缀查询在线玩家 `/users/search?prefix=(名字前缀)&top=(前x个)&room=(房间号，为空不限制)`
+	server.Get("/users/search", func(ctx *web.Context) (interface{}, error) {
+		prefix := ctx.Param("prefix", "")
+		if prefix == "" {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "empty prefix")
+		}
+		limit := strutil.Stoi(ctx.Param("top", "10"), 10)
+		if limit <= 0 {
+			limit = 1
+		} else if limit > 100 {
+			limit = 100
+		}
+		roomID := strutil.Stoi64(ctx.Param("room", ""), 0)
+		var filter func(*model.ClientAgent) bool
+		if roomID > 0 {
+			filter = func(findAgent *model.ClientAgent) bool {
+				return findAgent.State.Load() == roomID
+			}
+		}
+		type userInfo struct {
+			UserName string `json:"userName"`
+			RoomID   int64  `json:"roomID"`
+		}
+		users := make([]*userInfo, 0, limit)
+		for _, clientAgent := range model.SearchClientAgents(prefix, limit, filter) {
+			users = append(users, &userInfo{UserName: clientAgent.Name(), RoomID: clientAgent.State.Load()})
+		}
 		return &struct {
 			Code int         `json:"code"`
-			Data interface{} `json:"data,omitempty"`
+			Data interface{} `json:"data"`
 		}{
 			Code: int(gerror.OK),
-			Data: hots,
+			Data: users,
 		}, nil
 	})
 	//查询在线玩家的信息 `/stats/(角色名)`
@@ -47,35 +227,35 @@ func RegisterHandlers(ctxt context.Context, wg *sync.WaitGroup, server *web.Serv
 		name := ctx.Param("name", "")
 		var clientAgent *model.ClientAgent
 		if name != "" {
-			model.RangeSessions(func(findAgent *model.ClientAgent) bool {
-				if findAgent.UserName == name {
-					clientAgent = findAgent
-					return false
-				}
-				return true
-			})
+			clientAgent = model.ClientAgentFind(name)
 		}
 		if clientAgent == nil {
 			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, "no player found")
 		}
-		now := time.Now()
-		lt := clientAgent.Session.OnLineTime
-		if lt == nil {
-			lt = &now
+		return &struct {
+			Code int `json:"code"`
+			*model.StatsInfo
+		}{
+			Code:      int(gerror.OK),
+			StatsInfo: clientAgent.StatsInfo(),
+		}, nil
+	})
+	//在线玩家统计排行 `/stats/top?by=(排序字段 messages,bytesIn,bytesOut,rpmHits,badwordHits,roomsVisited,rateLimited,idle,pingRTT)&top=(前x个)`
+	server.Get("/stats/top", func(ctx *web.Context) (interface{}, error) {
+		by := ctx.Param("by", "messages")
+		topX := strutil.Stoi(ctx.Param("top", "10"), 10)
+		infos, ok := model.TopStats(by, topX)
+		if !ok {
+			return nil, gerror.NewError(gerror.SERVER_CMSG_ERROR, fmt.Sprintf("unsupport by:%s,keys:%v", by, model.StatsSortKeys()))
 		}
-		loginTime := lt.Format("2006-01-02 15:04:05")
 		return &struct {
-			Code       int    `json:"code"`
-			UserName   string `json:"userName"`
-			LoginTime  string `json:"loginTime"`
-			OnlineTime string `json:"onlineTime"`
-			RoomID     int64  `json:"roomID"`
+			Code int         `json:"code"`
+			By   string      `json:"by"`
+			Data interface{} `json:"data"`
 		}{
-			Code:       int(gerror.OK),
-			UserName:   clientAgent.UserName,
-			LoginTime:  loginTime,
-			OnlineTime: time.Since(*lt).String(),
-			RoomID:     clientAgent.State.Load(),
+			Code: int(gerror.OK),
+			By:   by,
+			Data: infos,
 		}, nil
 	})
 }
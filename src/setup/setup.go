@@ -7,22 +7,109 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/zxfonline/IMDemo/clientctl"
 	"github.com/zxfonline/IMDemo/config"
+	"github.com/zxfonline/IMDemo/core/badword"
 	"github.com/zxfonline/IMDemo/core/fileutil"
+	"github.com/zxfonline/IMDemo/core/hotword"
 	"github.com/zxfonline/IMDemo/core/log"
+	"github.com/zxfonline/IMDemo/core/session"
 	"github.com/zxfonline/IMDemo/core/web"
+	"github.com/zxfonline/IMDemo/model"
 	"github.com/zxfonline/IMDemo/service"
 )
 
 func Setup() {
+	config.Load()
 	initEnv()
 	startService()
 }
 func initEnv() {
 	fileutil.SetOSEnv("GOTRACEBACK", "crash")
+	if _, err := badword.Reload(badword.DefaultWordFile); err != nil {
+		panic(fmt.Errorf("load badword file err:%v", err))
+	}
+	initHotword()
+	model.ChatTraceSampling = config.Conf.ChatTraceSampling
+}
+
+//初始化热词分词器
+func initHotword() {
+	stopwords := hotword.DefaultStopwords
+	if config.Conf.HotStopwordFile != "" {
+		words, err := hotword.LoadWordFile(config.Conf.HotStopwordFile)
+		if err != nil {
+			panic(fmt.Errorf("load hot stopword file err:%v", err))
+		}
+		stopwords = words
+	}
+	switch config.Conf.HotTokenizer {
+	case "sentence":
+		hotword.SetTokenizer(hotword.NewSentenceTokenizer(hotword.NewStopwords(stopwords...)))
+	case "", "word":
+		var dict *hotword.Dict
+		if config.Conf.HotDictFile != "" {
+			words, err := hotword.LoadWordFile(config.Conf.HotDictFile)
+			if err != nil {
+				panic(fmt.Errorf("load hot dict file err:%v", err))
+			}
+			dict = hotword.NewDict(words...)
+		}
+		hotword.SetTokenizer(hotword.NewWordTokenizer(dict, hotword.NewStopwords(stopwords...)))
+	default:
+		panic(fmt.Errorf("unsupport hotTokenizer:%s", config.Conf.HotTokenizer))
+	}
+	if len(config.Conf.HotWindows) > 0 {
+		windows := make([]time.Duration, 0, len(config.Conf.HotWindows))
+		for _, w := range config.Conf.HotWindows {
+			d, err := time.ParseDuration(w)
+			if err != nil || d < hotword.WindowBuckets*time.Second {
+				panic(fmt.Errorf("bad hotWindows:%s", w))
+			}
+			windows = append(windows, d)
+		}
+		hotword.SetDefaultWindows(windows...)
+	}
+	//默认引擎和各房间单独配置的引擎
+	engines := map[string]bool{config.Conf.HotEngine: true}
+	for _, name := range config.Conf.HotEngines {
+		engines[name] = true
+	}
+	for name := range engines {
+		switch name {
+		case "", "trie":
+		case "spacesaving":
+			if config.Conf.HotCapacity <= 0 {
+				panic(fmt.Errorf("bad hotCapacity:%d", config.Conf.HotCapacity))
+			}
+			var halfLife time.Duration
+			if config.Conf.HotHalfLife != "" {
+				d, err := time.ParseDuration(config.Conf.HotHalfLife)
+				if err != nil || d <= 0 {
+					panic(fmt.Errorf("bad hotHalfLife:%s", config.Conf.HotHalfLife))
+				}
+				halfLife = d
+			}
+			hotword.RegisterEngine(name, func() hotword.Engine {
+				return hotword.NewSpaceSaving(config.Conf.HotCapacity, halfLife)
+			})
+		default:
+			panic(fmt.Errorf("unsupport hotEngine:%s", name))
+		}
+	}
+	if config.Conf.HotEngine != "" {
+		if _, err := hotword.NewEngineByName(config.Conf.HotEngine); err != nil {
+			panic(err)
+		}
+		name := config.Conf.HotEngine
+		hotword.SetEngine(func() hotword.Engine {
+			engine, _ := hotword.NewEngineByName(name)
+			return engine
+		})
+	}
 }
 
 func startService() {
@@ -37,6 +124,10 @@ func startService() {
 	webServer := startHttp(config.Conf.HttpAddr)
 	service.RegisterHandlers(ctx, wg, webServer)
 	defer webServer.Close()
+	if config.Conf.TcpAddr != "" {
+		tcpServer := startTcp(ctx, wg, config.Conf.TcpAddr)
+		defer tcpServer.Close()
+	}
 
 	signal.Notify(config.ExitSignal, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	log.Info("started")
@@ -73,6 +164,18 @@ func startHttp(address string) *web.Server {
 	return sev
 }
 
+//创建tcp服务器，会话与websocket共用聊天逻辑，会话参数单独配置
+func startTcp(ctx context.Context, wg *sync.WaitGroup, address string) *session.TcpServer {
+	sev := session.NewTcpServer(clientctl.SvrCtl.TcpSessionOptions, func(s session.Session) {
+		clientctl.SvrCtl.ClientLogic(ctx, wg, s)
+	})
+	if err := sev.ListenAndServe(address); err != nil {
+		panic(fmt.Errorf("bad TcpAddr:%s,err:%v", address, err))
+	}
+	log.Infof("tcp listen:%s", sev.Addr())
+	return sev
+}
+
 var exitOnce sync.Once
 
 //关服流程